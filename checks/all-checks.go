@@ -5,25 +5,123 @@ import (
 	"container-checker/utils"
 	"context"
 	"fmt"
+	"log"
+	"sort"
+	"time"
 
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/client"
 )
 
 // ContainerInfo holds the unified information for each container.
 type ContainerInfo struct {
-	ID                        string   `json:"id"`
-	ContainerName             string   `json:"containerName"`
-	IsRunningAsRoot           bool     `json:"isRunningAsRoot"`
-	PrivilegedContainer       bool     `json:"privilegedContainer"`
-	ReadOnlyRootFilesystem    bool     `json:"readOnlyRootFilesystem"`
-	PrivilegedContainerImage  string   `json:"privilegedContainerImage"`
-	PrivilegedContainerStatus string   `json:"privilegedContainerStatus"`
-	SecurityOptions           []string `json:"securityOptions"`
-	AdvancedCapabilities      []string `json:"advancedCapabilities"`
-	RestartPolicy             string   `json:"restartPolicy"`
-	MaxProcesses              string   `json:"maxProcesses"`
-	Recommendations           string   `json:"recommendations"`
+	ID                        string               `json:"id"`
+	ContainerName             string               `json:"containerName"`
+	IsRunningAsRoot           bool                 `json:"isRunningAsRoot"`
+	PrivilegedContainer       bool                 `json:"privilegedContainer"`
+	ReadOnlyRootFilesystem    bool                 `json:"readOnlyRootFilesystem"`
+	PrivilegedContainerImage  string               `json:"privilegedContainerImage"`
+	PrivilegedContainerStatus string               `json:"privilegedContainerStatus"`
+	SecurityOptions           []string             `json:"securityOptions"`
+	AdvancedCapabilities      []string             `json:"advancedCapabilities"`
+	Capabilities              []string             `json:"capabilities"` // effective set after cap_add and cap_drop
+	RestartPolicy             string               `json:"restartPolicy"`
+	MaxProcesses              string               `json:"maxProcesses"`
+	Recommendations           string               `json:"recommendations"`
+	Runtime                   RuntimeInfo          `json:"runtime"`
+	Findings                  []Finding            `json:"findings"`
+	ImageID                   string               `json:"imageId"`
+	ImageOS                   string               `json:"imageOs,omitempty"`
+	ImageVulnerabilities      []Vulnerability      `json:"imageVulnerabilities,omitempty"`
+	SBOM                      *SBOMReference       `json:"sbom,omitempty"`
+	BaseImage                 *BaseImage           `json:"baseImage,omitempty"`
+	Signature                 *SignatureResult     `json:"signature,omitempty"`
+	Remediation               *RunRemediation      `json:"remediation,omitempty"`
+	ComposePatch              *ComposeServicePatch `json:"composePatch,omitempty"`
+	Mounts                    []string             `json:"mounts,omitempty"`
+	PublishedPorts            []string             `json:"publishedPorts,omitempty"`
+	Labels                    map[string]string    `json:"labels,omitempty"`
+	Created                   time.Time            `json:"created"`
+	State                     string               `json:"state"`
+}
+
+// DaemonInfo identifies the Docker daemon a scan ran against.
+type DaemonInfo struct {
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	ServerVersion   string `json:"serverVersion"`
+	OperatingSystem string `json:"operatingSystem"`
+	KernelVersion   string `json:"kernelVersion"`
+	Architecture    string `json:"architecture"`
+	DefaultRuntime  string `json:"defaultRuntime"`
+}
+
+// GetDaemonInfo reads the identity and version of the Docker daemon.
+func GetDaemonInfo(cli *client.Client) (DaemonInfo, error) {
+	info, err := cli.Info(context.Background())
+	if err != nil {
+		return DaemonInfo{}, fmt.Errorf("error reading daemon info: %v", err)
+	}
+	return DaemonInfo{
+		ID:              info.ID,
+		Name:            info.Name,
+		ServerVersion:   info.ServerVersion,
+		OperatingSystem: info.OperatingSystem,
+		KernelVersion:   info.KernelVersion,
+		Architecture:    info.Architecture,
+		DefaultRuntime:  info.DefaultRuntime,
+	}, nil
+}
+
+// RunScan checks all containers and records when the scan ran, how long it
+// took and which daemon it ran against.
+func RunScan(cli *client.Client, imageScanner *ImageScanner, signatureVerifier *SignatureVerifier) (*Scan, error) {
+	startedAt := time.Now()
+	containerInfo, err := CheckAllContainers(cli, imageScanner, signatureVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	scan := &Scan{StartedAt: startedAt, Containers: containerInfo}
+	if daemon, err := GetDaemonInfo(cli); err != nil {
+		log.Printf("Error reading daemon info: %v", err)
+	} else {
+		scan.Daemon = daemon
+	}
+	scan.Duration = time.Since(startedAt)
+	return scan, nil
+}
+
+// containerMounts describes the mounts of a container as "type source:target:mode".
+func containerMounts(c types.ContainerJSON) []string {
+	var mounts []string
+	for _, m := range c.Mounts {
+		source := m.Source
+		if m.Type == mount.TypeVolume && m.Name != "" {
+			source = m.Name
+		}
+		mode := "ro"
+		if m.RW {
+			mode = "rw"
+		}
+		mounts = append(mounts, fmt.Sprintf("%s %s:%s:%s", m.Type, source, m.Destination, mode))
+	}
+	sort.Strings(mounts)
+	return mounts
+}
+
+// publishedPorts describes the port bindings of a container as "hostIP:hostPort->port/proto".
+func publishedPorts(hostConfig *container.HostConfig) []string {
+	var ports []string
+	for port, bindings := range hostConfig.PortBindings {
+		for _, binding := range bindings {
+			ports = append(ports, fmt.Sprintf("%s:%s->%s", binding.HostIP, binding.HostPort, port))
+		}
+	}
+	sort.Strings(ports)
+	return ports
 }
 
 func hasAdvancedCapabilities(hostConfig *container.HostConfig) bool {
@@ -59,89 +157,189 @@ func isAdvancedCapability(capability string) bool {
 }
 
 // CheckAllContainers lists all containers and checks their privileged status, security options, and read-only root filesystem.
-func CheckAllContainers(cli *client.Client) ([]ContainerInfo, error) {
+// When an image scanner is given, the vulnerabilities of each container's image are attached to its report,
+// and when a signature verifier is given, the signature status of each container's image.
+func CheckAllContainers(cli *client.Client, imageScanner *ImageScanner, signatureVerifier *SignatureVerifier) ([]ContainerInfo, error) {
 	// List all containers
 	containers, err := utils.ListContainers(cli)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(containers) == 0 {
-		return nil, fmt.Errorf("no containers found")
+	if imageScanner != nil {
+		inUse := make(map[string]bool)
+		for _, container := range containers {
+			inUse[container.ImageID] = true
+		}
+		imageScanner.Retain(inUse)
 	}
 
-	var containerInfo []ContainerInfo
+	daemonRuntimes, err := GetDaemonRuntimes(cli)
+	if err != nil {
+		log.Printf("Error reading daemon runtimes: %v", err)
+	}
+
+	containerInfo := []ContainerInfo{}
 
 	for _, container := range containers {
-		containerJSON, err := cli.ContainerInspect(context.Background(), container.ID)
+		info, err := CheckContainer(cli, container, daemonRuntimes, imageScanner, signatureVerifier)
 		if err != nil {
 			return nil, err
 		}
+		containerInfo = append(containerInfo, info)
+	}
 
-		isPrivileged := containerJSON.HostConfig.Privileged
-		isRunningAsRoot := containerJSON.Config.User == "root"
-		isReadOnlyRootFilesystem := containerJSON.HostConfig.ReadonlyRootfs
-		hasAdvancedCapabilities := hasAdvancedCapabilities(containerJSON.HostConfig)
-		capabilities := containerJSON.HostConfig.CapAdd
-		restartPolicy := containerJSON.HostConfig.RestartPolicy.Name
-		maxProcesses := containerJSON.HostConfig.Resources.PidsLimit
+	return containerInfo, nil
+}
 
-		var recommendations string
+// CheckContainer inspects one container from a container listing and runs the checks against it.
+func CheckContainer(cli *client.Client, container types.Container, daemonRuntimes DaemonRuntimes, imageScanner *ImageScanner, signatureVerifier *SignatureVerifier) (ContainerInfo, error) {
+	containerJSON, err := cli.ContainerInspect(context.Background(), container.ID)
+	if err != nil {
+		return ContainerInfo{}, err
+	}
 
-		if isPrivileged {
-			recommendations = fmt.Sprintf("Configure a user Container %s  with low privileges or run the container in rootless mode.\n", container.ID[:12])
-		}
-		if isRunningAsRoot {
-			recommendations += fmt.Sprintf("Configure Container %s a user with low privileges or run container in rootless mode.\n", container.ID[:12])
-		}
-		if isReadOnlyRootFilesystem {
-			recommendations += fmt.Sprintf("\nConfigure Container %s  to use a read-only root filesystem.\n", container.ID[:12])
-		}
-		if containerJSON.HostConfig.SecurityOpt == nil {
-			recommendations += fmt.Sprintf("\nContainer %s needs to be relaunched either with SECCOMP or use the --security-opt=no-new-privileges flag when running Docker images to prevent priviledge escalation.\n", container.ID[:12])
-		}
-		if containerJSON.HostConfig.CapAdd == nil {
-			recommendations += fmt.Sprintf("\nContainer %s needs to be relaunched either with lower prvileges or use the --cap-add= flag when running Docker images to prevent priviledge escalation.\n", container.ID[:12])
-		}
-		if hasAdvancedCapabilities {
-			recommendations += fmt.Sprintf("\nContainer %s has advanced capabilities that can pose a security risk: %v. Minimize the use of capabilities and run the container with the least privileges required.\n", container.ID[:12], containerJSON.HostConfig.CapAdd)
-		}
-		if capabilities != nil {
-			recommendations += fmt.Sprintf("\nContainer %s has capabilities that can pose a security risk: %v. Minimize the use of capabilities and run the container with the least privileges required.\n", container.ID[:12], containerJSON.HostConfig.CapAdd)
-		}
+	isPrivileged := containerJSON.HostConfig.Privileged
+	isRunningAsRoot := containerJSON.Config.User == "root"
+	isReadOnlyRootFilesystem := containerJSON.HostConfig.ReadonlyRootfs
+	hasAdvancedCapabilities := hasAdvancedCapabilities(containerJSON.HostConfig)
+	capabilities := containerJSON.HostConfig.CapAdd
+	restartPolicy := containerJSON.HostConfig.RestartPolicy.Name
+	maxProcesses := containerJSON.HostConfig.Resources.PidsLimit
 
-		if restartPolicy == "0" {
-			recommendations += fmt.Sprintf("\nConfigure a restart policy of on-failure or no-restart for Container %s \n", container.ID[:12])
-		}
-		if maxProcesses != nil && *maxProcesses == 0 {
-			recommendations += fmt.Sprintf("\nConfigure a maximum number of processes to prevent DOS attacks for Container %s \n", container.ID[:12])
+	var recommendations string
+
+	if isPrivileged {
+		recommendations = fmt.Sprintf("Configure a user Container %s  with low privileges or run the container in rootless mode.\n", container.ID[:12])
+	}
+	if isRunningAsRoot {
+		recommendations += fmt.Sprintf("Configure Container %s a user with low privileges or run container in rootless mode.\n", container.ID[:12])
+	}
+	if isReadOnlyRootFilesystem {
+		recommendations += fmt.Sprintf("\nConfigure Container %s  to use a read-only root filesystem.\n", container.ID[:12])
+	}
+	if containerJSON.HostConfig.SecurityOpt == nil {
+		recommendations += fmt.Sprintf("\nContainer %s needs to be relaunched either with SECCOMP or use the --security-opt=no-new-privileges flag when running Docker images to prevent priviledge escalation.\n", container.ID[:12])
+	}
+	if containerJSON.HostConfig.CapAdd == nil {
+		recommendations += fmt.Sprintf("\nContainer %s needs to be relaunched either with lower prvileges or use the --cap-add= flag when running Docker images to prevent priviledge escalation.\n", container.ID[:12])
+	}
+	if hasAdvancedCapabilities {
+		recommendations += fmt.Sprintf("\nContainer %s has advanced capabilities that can pose a security risk: %v. Minimize the use of capabilities and run the container with the least privileges required.\n", container.ID[:12], containerJSON.HostConfig.CapAdd)
+	}
+	if capabilities != nil {
+		recommendations += fmt.Sprintf("\nContainer %s has capabilities that can pose a security risk: %v. Minimize the use of capabilities and run the container with the least privileges required.\n", container.ID[:12], containerJSON.HostConfig.CapAdd)
+	}
+
+	if restartPolicy == "0" {
+		recommendations += fmt.Sprintf("\nConfigure a restart policy of on-failure or no-restart for Container %s \n", container.ID[:12])
+	}
+	if maxProcesses != nil && *maxProcesses == 0 {
+		recommendations += fmt.Sprintf("\nConfigure a maximum number of processes to prevent DOS attacks for Container %s \n", container.ID[:12])
+	}
+
+	var maxProcessesStr string
+	if maxProcesses != nil {
+		maxProcessesStr = fmt.Sprintf("%d", *maxProcesses)
+	} else {
+		maxProcessesStr = "no limt set"
+		recommendations += fmt.Sprintf("\nConfigure a maximum number of processes to prevent DOS attacks for Container %s \n", container.ID[:12])
+
+	}
+
+	var imageInspect *types.ImageInspect
+	if inspect, _, err := cli.ImageInspectWithRaw(context.Background(), containerJSON.Image); err != nil {
+		log.Printf("Error inspecting image %s: %v", containerJSON.Image, err)
+	} else {
+		imageInspect = &inspect
+	}
+
+	var report *ImageContentReport
+	if imageScanner != nil {
+		report, err = imageScanner.Scan(containerJSON.Image)
+		if err != nil {
+			log.Printf("Error scanning image %s: %v", containerJSON.Image, err)
 		}
+	}
 
-		var maxProcessesStr string
-		if maxProcesses != nil {
-			maxProcessesStr = fmt.Sprintf("%d", *maxProcesses)
-		} else {
-			maxProcessesStr = "no limt set"
-			recommendations += fmt.Sprintf("\nConfigure a maximum number of processes to prevent DOS attacks for Container %s \n", container.ID[:12])
+	var baseImage *BaseImage
+	if imageInspect != nil || report != nil {
+		base := IdentifyBaseImage(imageInspect, report)
+		baseImage = &base
+	}
 
+	var signature *SignatureResult
+	if signatureVerifier != nil && imageInspect != nil {
+		result, err := signatureVerifier.VerifyImage(imageInspect)
+		if err != nil {
+			log.Printf("Error verifying signatures of image %s: %v", containerJSON.Image, err)
+		} else {
+			signature = &result
 		}
+	}
+
+	runtime := daemonRuntimes.Resolve(containerJSON.HostConfig.Runtime)
+	findings := EvaluateContainer(&RuleContext{
+		Container:        containerJSON,
+		Runtime:          runtime,
+		Image:            imageInspect,
+		BaseImage:        baseImage,
+		ReferenceImageID: ResolveImageReference(cli, containerJSON.Config.Image),
+		Signature:        signature,
+	})
 
-		info := ContainerInfo{
-			ID:                        container.ID[:12],
-			ContainerName:             container.Names[0],
-			IsRunningAsRoot:           isRunningAsRoot,
-			PrivilegedContainer:       isPrivileged,
-			ReadOnlyRootFilesystem:    isReadOnlyRootFilesystem,
-			PrivilegedContainerImage:  container.Image,
-			PrivilegedContainerStatus: container.Status,
-			SecurityOptions:           containerJSON.HostConfig.SecurityOpt,
-			AdvancedCapabilities:      capabilities,
-			RestartPolicy:             string(restartPolicy),
-			MaxProcesses:              maxProcessesStr,
-			Recommendations:           recommendations,
+	if imageInspect != nil {
+		findings = append(findings, EvaluateContainerImage(*imageInspect)...)
+		sortFindings(findings)
+	}
+
+	var imageOS string
+	var imageVulnerabilities []Vulnerability
+	var sbom *SBOMReference
+	if report != nil {
+		imageOS = report.OS.PrettyName
+		imageVulnerabilities = report.Vulnerabilities
+		sbom = report.SBOM
+		if finding, ok := vulnerabilityFinding(report.Vulnerabilities); ok {
+			findings = append(findings, finding)
 		}
-		containerInfo = append(containerInfo, info)
+		if finding, ok := layerSecretFinding(report.Secrets); ok {
+			findings = append(findings, finding)
+		}
+		sortFindings(findings)
 	}
 
-	return containerInfo, nil
+	remediation := BuildRunRemediation(containerJSON, imageInspect, findings)
+
+	info := ContainerInfo{
+		ID:                        container.ID[:12],
+		ContainerName:             container.Names[0],
+		IsRunningAsRoot:           isRunningAsRoot,
+		PrivilegedContainer:       isPrivileged,
+		ReadOnlyRootFilesystem:    isReadOnlyRootFilesystem,
+		PrivilegedContainerImage:  container.Image,
+		PrivilegedContainerStatus: container.Status,
+		SecurityOptions:           containerJSON.HostConfig.SecurityOpt,
+		AdvancedCapabilities:      capabilities,
+		Capabilities:              effectiveCapabilities(isPrivileged, containerJSON.HostConfig.CapAdd, containerJSON.HostConfig.CapDrop),
+		RestartPolicy:             string(restartPolicy),
+		MaxProcesses:              maxProcessesStr,
+		Recommendations:           recommendations,
+		Runtime:                   runtime,
+		Findings:                  findings,
+		ImageID:                   containerJSON.Image,
+		ImageOS:                   imageOS,
+		ImageVulnerabilities:      imageVulnerabilities,
+		SBOM:                      sbom,
+		BaseImage:                 baseImage,
+		Signature:                 signature,
+		Remediation:               &remediation,
+		ComposePatch:              BuildComposeServicePatch(containerJSON, findings),
+		Mounts:                    containerMounts(containerJSON),
+		PublishedPorts:            publishedPorts(containerJSON.HostConfig),
+		Labels:                    redactLabels(container.Labels),
+		Created:                   time.Unix(container.Created, 0).UTC(),
+		State:                     container.State,
+	}
+	return info, nil
 }
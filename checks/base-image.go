@@ -0,0 +1,332 @@
+package checks
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// Distributions recognized as image bases.
+const (
+	DistroAlpine     = "alpine"
+	DistroDebian     = "debian"
+	DistroUbuntu     = "ubuntu"
+	DistroUBI        = "ubi"
+	DistroRHEL       = "rhel"
+	DistroCentOS     = "centos"
+	DistroDistroless = "distroless"
+)
+
+var distroNames = map[string]string{
+	DistroAlpine:     "Alpine",
+	DistroDebian:     "Debian",
+	DistroUbuntu:     "Ubuntu",
+	DistroUBI:        "Red Hat UBI",
+	DistroRHEL:       "Red Hat Enterprise Linux",
+	DistroCentOS:     "CentOS",
+	DistroDistroless: "Distroless",
+}
+
+// BaseImage is the distribution an image is built on.
+type BaseImage struct {
+	Distro  string `json:"distro"`
+	Version string `json:"version"`
+	Source  string `json:"source"` // os-release, history or labels
+	EOL     bool   `json:"eol"`
+	EOLDate string `json:"eolDate,omitempty"`
+}
+
+// String returns the distribution name and version, e.g. "Alpine 3.18".
+func (b BaseImage) String() string {
+	if b.Distro == "" {
+		return "unknown"
+	}
+	name, ok := distroNames[b.Distro]
+	if !ok {
+		name = b.Distro
+	}
+	if b.Version == "" {
+		return name
+	}
+	return name + " " + b.Version
+}
+
+//go:embed eol.json
+var bundledEOLTable []byte
+
+// eolEntry is one release cycle of the end-of-life table.
+type eolEntry struct {
+	Distro string `json:"distro"`
+	Cycle  string `json:"cycle"`
+	EOL    string `json:"eol"`
+}
+
+// eolTable maps a distribution and release cycle to its end-of-life date.
+var eolTable map[string]map[string]time.Time
+
+func init() {
+	table, err := parseEOLTable(bundledEOLTable)
+	if err != nil {
+		panic(fmt.Sprintf("bundled EOL table: %v", err))
+	}
+	eolTable = table
+}
+
+// LoadEOLTable replaces the bundled end-of-life table with the one in path,
+// so that release dates can be updated without rebuilding the checker.
+func LoadEOLTable(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading EOL table %s: %v", path, err)
+	}
+	table, err := parseEOLTable(data)
+	if err != nil {
+		return fmt.Errorf("error parsing EOL table %s: %v", path, err)
+	}
+	eolTable = table
+	return nil
+}
+
+func parseEOLTable(data []byte) (map[string]map[string]time.Time, error) {
+	var entries []eolEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	table := make(map[string]map[string]time.Time)
+	for _, e := range entries {
+		date, err := time.Parse("2006-01-02", e.EOL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date for %s %s: %v", e.Distro, e.Cycle, err)
+		}
+		if table[e.Distro] == nil {
+			table[e.Distro] = make(map[string]time.Time)
+		}
+		table[e.Distro][e.Cycle] = date
+	}
+	return table, nil
+}
+
+// lookupEOL returns the end-of-life date of a release, trying the full
+// version first and then dropping trailing components ("3.18.4" -> "3.18").
+// Distroless images follow the Debian release they are built from.
+func lookupEOL(distro, version string) (time.Time, bool) {
+	if distro == DistroDistroless {
+		distro = DistroDebian
+	}
+	cycles := eolTable[distro]
+	for version != "" {
+		if date, ok := cycles[version]; ok {
+			return date, true
+		}
+		i := strings.LastIndex(version, ".")
+		if i < 0 {
+			break
+		}
+		version = version[:i]
+	}
+	return time.Time{}, false
+}
+
+// releaseCodenames maps Debian and Ubuntu codenames to release versions, for
+// images identified from their history or from testing releases.
+var releaseCodenames = map[string][2]string{
+	"stretch":  {DistroDebian, "9"},
+	"buster":   {DistroDebian, "10"},
+	"bullseye": {DistroDebian, "11"},
+	"bookworm": {DistroDebian, "12"},
+	"trixie":   {DistroDebian, "13"},
+	"bionic":   {DistroUbuntu, "18.04"},
+	"focal":    {DistroUbuntu, "20.04"},
+	"jammy":    {DistroUbuntu, "22.04"},
+	"noble":    {DistroUbuntu, "24.04"},
+	"oracular": {DistroUbuntu, "24.10"},
+	"plucky":   {DistroUbuntu, "25.04"},
+}
+
+var (
+	alpineRootfsPattern = regexp.MustCompile(`alpine-minirootfs-(\d+\.\d+)`)
+	codenamePattern     = regexp.MustCompile(`\b(stretch|buster|bullseye|bookworm|trixie|bionic|focal|jammy|noble|oracular|plucky)\b`)
+)
+
+// IdentifyBaseImage works out the distribution an image is built on. The
+// os-release file found in its layers is authoritative; otherwise the layer
+// history and the image labels are used as hints. report may be nil when the
+// image contents were not scanned.
+func IdentifyBaseImage(imageInspect *types.ImageInspect, report *ImageContentReport) BaseImage {
+	var labels map[string]string
+	if imageInspect != nil && imageInspect.Config != nil {
+		labels = imageInspect.Config.Labels
+	}
+
+	var base BaseImage
+	if report != nil && report.OS.ID != "" {
+		base = baseFromOSRelease(report.OS, labels)
+	}
+	if base.Distro == "" && report != nil {
+		base = baseFromHistory(report.Layers)
+	}
+	if base.Distro == "" {
+		base = baseFromLabels(labels)
+	}
+
+	if date, ok := lookupEOL(base.Distro, base.Version); ok {
+		base.EOLDate = date.Format("2006-01-02")
+		base.EOL = !time.Now().Before(date)
+	}
+	return base
+}
+
+// baseFromOSRelease identifies the distribution from an os-release file.
+func baseFromOSRelease(release OSRelease, labels map[string]string) BaseImage {
+	base := BaseImage{Distro: release.ID, Version: release.VersionID, Source: "os-release"}
+
+	switch release.ID {
+	case DistroAlpine:
+		// Alpine releases are supported per minor version
+		if parts := strings.SplitN(release.VersionID, ".", 3); len(parts) >= 2 {
+			base.Version = parts[0] + "." + parts[1]
+		}
+	case DistroDebian:
+		if base.Version == "" {
+			// testing and unstable have no VERSION_ID
+			if codename, ok := releaseCodenames[release.VersionCodename]; ok {
+				base.Version = codename[1]
+			} else {
+				base.Version = release.VersionCodename
+			}
+		}
+	case DistroRHEL, DistroCentOS:
+		// UBI images carry the RHEL os-release; their labels tell them apart
+		if strings.HasPrefix(labels["com.redhat.component"], "ubi") || strings.HasPrefix(labels["name"], "ubi") {
+			base.Distro = DistroUBI
+		}
+		base.Version, _, _ = strings.Cut(release.VersionID, ".")
+	}
+
+	if strings.Contains(strings.ToLower(release.PrettyName), "distroless") {
+		base.Distro = DistroDistroless
+	}
+	return base
+}
+
+// baseFromHistory recognizes the root filesystem of official images from the
+// instructions that created their layers, for images without an os-release.
+func baseFromHistory(layers []ArchivedLayer) BaseImage {
+	for _, layer := range layers {
+		if m := alpineRootfsPattern.FindStringSubmatch(layer.Instruction); m != nil {
+			return BaseImage{Distro: DistroAlpine, Version: m[1], Source: "history"}
+		}
+		if m := codenamePattern.FindStringSubmatch(layer.Instruction); m != nil {
+			codename := releaseCodenames[m[1]]
+			return BaseImage{Distro: codename[0], Version: codename[1], Source: "history"}
+		}
+	}
+	return BaseImage{}
+}
+
+// baseFromLabels uses the OCI labels official images set on their base layer.
+func baseFromLabels(labels map[string]string) BaseImage {
+	if strings.HasPrefix(labels["com.redhat.component"], "ubi") {
+		version, _, _ := strings.Cut(labels["version"], ".")
+		return BaseImage{Distro: DistroUBI, Version: version, Source: "labels"}
+	}
+
+	name := labels["org.opencontainers.image.ref.name"]
+	version := labels["org.opencontainers.image.version"]
+	if _, ok := distroNames[name]; ok && version != "" {
+		if codename, ok := releaseCodenames[version]; ok {
+			version = codename[1]
+		}
+		return BaseImage{Distro: name, Version: version, Source: "labels"}
+	}
+	return BaseImage{}
+}
+
+// imageReferenceTag returns the tag of an image reference such as
+// "registry:5000/app:1.2", "latest" when the reference has no tag, and ""
+// when the reference is pinned by digest or is an image ID.
+func imageReferenceTag(reference string) string {
+	if strings.Contains(reference, "@") || isImageID(reference) {
+		return ""
+	}
+	name := reference[strings.LastIndex(reference, "/")+1:]
+	if _, tag, ok := strings.Cut(name, ":"); ok {
+		return tag
+	}
+	return "latest"
+}
+
+var imageIDPattern = regexp.MustCompile(`^(sha256:)?[0-9a-f]{12,64}$`)
+
+// isImageID reports whether a container was started from an image ID rather
+// than a named reference.
+func isImageID(reference string) bool {
+	return imageIDPattern.MatchString(reference)
+}
+
+// isUntagged reports whether an image has no repository tags left, which
+// happens when its tag was moved to a newer build.
+func isUntagged(imageInspect *types.ImageInspect) bool {
+	for _, tag := range imageInspect.RepoTags {
+		if tag != "<none>:<none>" {
+			return false
+		}
+	}
+	return true
+}
+
+func init() {
+	registerContainerRules(
+		ContainerRule{
+			ID:          "base-image-eol",
+			Family:      FamilySecurity,
+			Severity:    SeverityHigh,
+			Title:       "Image is built on an end-of-life distribution",
+			Remediation: "Rebuild the image on a supported release of its base distribution.",
+			Check: func(rc *RuleContext) []string {
+				if rc.BaseImage == nil || !rc.BaseImage.EOL {
+					return nil
+				}
+				return []string{fmt.Sprintf("%s reached end of life on %s (identified from %s)", rc.BaseImage, rc.BaseImage.EOLDate, rc.BaseImage.Source)}
+			},
+		},
+		ContainerRule{
+			ID:          "image-latest-tag",
+			Family:      FamilySecurity,
+			Severity:    SeverityMedium,
+			Title:       "Container uses the latest tag",
+			Remediation: "Run the container from an explicit version tag or an image digest.",
+			Check: func(rc *RuleContext) []string {
+				reference := rc.Container.Config.Image
+				if imageReferenceTag(reference) != "latest" {
+					return nil
+				}
+				return []string{fmt.Sprintf("Config.Image is %q", reference)}
+			},
+		},
+		ContainerRule{
+			ID:          "image-untagged",
+			Family:      FamilySecurity,
+			Severity:    SeverityLow,
+			Title:       "Container runs an untagged image",
+			Remediation: "Recreate the container from a tagged image so the running version can be identified.",
+			Check: func(rc *RuleContext) []string {
+				reference := rc.Container.Config.Image
+				if isImageID(reference) {
+					return []string{fmt.Sprintf("Config.Image is the image ID %q", reference)}
+				}
+				if rc.Image != nil && isUntagged(rc.Image) {
+					return []string{fmt.Sprintf("Image %s has no repository tags (<none>)", rc.Image.ID)}
+				}
+				return nil
+			},
+		},
+	)
+}
@@ -0,0 +1,218 @@
+package checks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// baselineVersion is the version of the baseline file format.
+const baselineVersion = 1
+
+// Baseline records the findings that are known and accepted, so that later
+// scans only report regressions.
+type Baseline struct {
+	Version   int             `json:"version"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+	Findings  []BaselineEntry `json:"findings"`
+}
+
+// BaselineEntry is one accepted finding.
+type BaselineEntry struct {
+	Fingerprint string    `json:"fingerprint"`
+	RuleID      string    `json:"ruleId"`
+	Container   string    `json:"container"`
+	Image       string    `json:"image"`
+	Severity    Severity  `json:"severity"`
+	Title       string    `json:"title"`
+	FirstSeen   time.Time `json:"firstSeen"`
+}
+
+// BaselineFinding is a finding of the current scan with its fingerprint.
+type BaselineFinding struct {
+	Finding
+	Fingerprint string `json:"fingerprint"`
+	Container   string `json:"container"`
+	Image       string `json:"image"`
+}
+
+// BaselineComparison splits the findings of a scan against a baseline.
+type BaselineComparison struct {
+	New      []BaselineFinding `json:"new"`
+	Resolved []BaselineEntry   `json:"resolved"`
+	Known    int               `json:"known"`
+}
+
+// FindingFingerprint identifies a finding across scans from its rule, the
+// container name, the image reference and the evidence. Container IDs are
+// left out so that recreating a container keeps its fingerprints.
+func FindingFingerprint(f Finding, container, image string) string {
+	evidence := append([]string(nil), f.Evidence...)
+	sort.Strings(evidence)
+
+	h := sha256.New()
+	for _, part := range append([]string{f.RuleID, strings.TrimPrefix(container, "/"), image}, evidence...) {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// scanFindings returns every finding of the containers with its fingerprint.
+func scanFindings(containers []ContainerInfo) []BaselineFinding {
+	var findings []BaselineFinding
+	for _, c := range containers {
+		name := strings.TrimPrefix(c.ContainerName, "/")
+		for _, f := range c.Findings {
+			findings = append(findings, BaselineFinding{
+				Finding:     f,
+				Fingerprint: FindingFingerprint(f, name, c.PrivilegedContainerImage),
+				Container:   name,
+				Image:       c.PrivilegedContainerImage,
+			})
+		}
+	}
+	return findings
+}
+
+// LoadBaseline reads a baseline file.
+func LoadBaseline(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading baseline %s: %v", path, err)
+	}
+	var baseline Baseline
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("error parsing baseline %s: %v", path, err)
+	}
+	if baseline.Version != baselineVersion {
+		return nil, fmt.Errorf("baseline %s has unsupported version %d", path, baseline.Version)
+	}
+	return &baseline, nil
+}
+
+// NewBaseline builds a baseline from the findings of a scan. Entries that
+// are already in the previous baseline keep the time they were first seen.
+func NewBaseline(containers []ContainerInfo, previous *Baseline) *Baseline {
+	now := time.Now().UTC()
+	firstSeen := make(map[string]time.Time)
+	if previous != nil {
+		for _, entry := range previous.Findings {
+			firstSeen[entry.Fingerprint] = entry.FirstSeen
+		}
+	}
+
+	baseline := &Baseline{Version: baselineVersion, UpdatedAt: now, Findings: []BaselineEntry{}}
+	seen := make(map[string]bool)
+	for _, f := range scanFindings(containers) {
+		if seen[f.Fingerprint] {
+			continue
+		}
+		seen[f.Fingerprint] = true
+
+		entry := f.entry()
+		entry.FirstSeen = now
+		if t, ok := firstSeen[f.Fingerprint]; ok {
+			entry.FirstSeen = t
+		}
+		baseline.Findings = append(baseline.Findings, entry)
+	}
+	sort.Slice(baseline.Findings, func(i, j int) bool {
+		a, b := baseline.Findings[i], baseline.Findings[j]
+		if a.Container != b.Container {
+			return a.Container < b.Container
+		}
+		if a.RuleID != b.RuleID {
+			return a.RuleID < b.RuleID
+		}
+		return a.Fingerprint < b.Fingerprint
+	})
+	return baseline
+}
+
+func (f BaselineFinding) entry() BaselineEntry {
+	return BaselineEntry{
+		Fingerprint: f.Fingerprint,
+		RuleID:      f.RuleID,
+		Container:   f.Container,
+		Image:       f.Image,
+		Severity:    f.Severity,
+		Title:       f.Title,
+	}
+}
+
+// Save writes the baseline to path, replacing the file atomically.
+func (b *Baseline) Save(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding baseline: %v", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".baseline-*")
+	if err != nil {
+		return fmt.Errorf("error writing baseline %s: %v", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing baseline %s: %v", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing baseline %s: %v", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing baseline %s: %v", path, err)
+	}
+	return nil
+}
+
+// Compare reports the findings of the containers that are not in the
+// baseline, and the baseline entries that no longer occur.
+func (b *Baseline) Compare(containers []ContainerInfo) BaselineComparison {
+	known := make(map[string]bool, len(b.Findings))
+	for _, entry := range b.Findings {
+		known[entry.Fingerprint] = true
+	}
+
+	comparison := BaselineComparison{New: []BaselineFinding{}, Resolved: []BaselineEntry{}}
+	current := make(map[string]bool)
+	for _, f := range scanFindings(containers) {
+		current[f.Fingerprint] = true
+		if known[f.Fingerprint] {
+			comparison.Known++
+		} else {
+			comparison.New = append(comparison.New, f)
+		}
+	}
+	for _, entry := range b.Findings {
+		if !current[entry.Fingerprint] {
+			comparison.Resolved = append(comparison.Resolved, entry)
+		}
+	}
+	return comparison
+}
+
+// PrintBaselineComparison prints the new and resolved findings.
+func PrintBaselineComparison(comparison BaselineComparison) {
+	if len(comparison.New) > 0 {
+		fmt.Println("New findings:")
+		for _, f := range comparison.New {
+			fmt.Printf("  %s: [%s] %s (%s)\n", f.Container, f.Severity, f.Title, f.RuleID)
+			for _, e := range f.Evidence {
+				fmt.Printf("      %s\n", e)
+			}
+		}
+	}
+	if len(comparison.Resolved) > 0 {
+		fmt.Println("Resolved findings:")
+		for _, entry := range comparison.Resolved {
+			fmt.Printf("  %s: [%s] %s (%s)\n", entry.Container, entry.Severity, entry.Title, entry.RuleID)
+		}
+	}
+	fmt.Printf("%d new, %d resolved, %d known findings suppressed by the baseline.\n", len(comparison.New), len(comparison.Resolved), comparison.Known)
+}
@@ -0,0 +1,202 @@
+package checks
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Labels docker compose sets on the containers it creates.
+const (
+	composeProjectLabel     = "com.docker.compose.project"
+	composeServiceLabel     = "com.docker.compose.service"
+	composeConfigFilesLabel = "com.docker.compose.project.config_files"
+)
+
+// ComposeHardening holds the compose service keys that resolve the findings
+// of a container. Keys that need no change are left empty.
+type ComposeHardening struct {
+	Privileged  *bool         `yaml:"privileged,omitempty" json:"privileged,omitempty"`
+	User        quotedString  `yaml:"user,omitempty" json:"user,omitempty"`
+	CapDrop     overrideList  `yaml:"cap_drop,omitempty" json:"cap_drop,omitempty"`
+	CapAdd      *overrideList `yaml:"cap_add,omitempty" json:"cap_add,omitempty"` // empty to remove every added capability
+	SecurityOpt overrideList  `yaml:"security_opt,omitempty" json:"security_opt,omitempty"`
+	ReadOnly    bool          `yaml:"read_only,omitempty" json:"read_only,omitempty"`
+	Tmpfs       []string      `yaml:"tmpfs,omitempty" json:"tmpfs,omitempty"` // only new targets, merged with the current ones
+	PidsLimit   int64         `yaml:"pids_limit,omitempty" json:"pids_limit,omitempty"`
+	MemLimit    string        `yaml:"mem_limit,omitempty" json:"mem_limit,omitempty"`
+}
+
+// quotedString is written double-quoted in YAML, so that a "uid:gid" user
+// is not read as a base 60 number by YAML 1.1 parsers.
+type quotedString string
+
+func (s quotedString) MarshalYAML() (interface{}, error) {
+	return &yaml.Node{Kind: yaml.ScalarNode, Style: yaml.DoubleQuotedStyle, Value: string(s)}, nil
+}
+
+// overrideList is a list that replaces the service's current value when the
+// patch is merged. Compose appends cap_add, cap_drop and security_opt from
+// every file, so the list is tagged !override, or !reset when it is empty.
+// Both tags need Compose 2.24 or later.
+type overrideList []string
+
+func (l overrideList) MarshalYAML() (interface{}, error) {
+	node := &yaml.Node{}
+	if err := node.Encode([]string(l)); err != nil {
+		return nil, err
+	}
+	node.Tag = "!override"
+	if len(l) == 0 {
+		node.Tag = "!reset"
+		node.Style = yaml.FlowStyle
+	}
+	return node, nil
+}
+
+// ComposeServicePatch is the hardening for the compose service a running
+// container was created from.
+type ComposeServicePatch struct {
+	Project     string           `json:"project"`
+	Service     string           `json:"service"`
+	ConfigFiles string           `json:"configFiles,omitempty"`
+	Hardening   ComposeHardening `json:"hardening"`
+}
+
+// ComposeProjectPatch groups the service patches of one compose project.
+type ComposeProjectPatch struct {
+	Project     string                      `json:"project"`
+	ConfigFiles string                      `json:"configFiles,omitempty"`
+	Services    map[string]ComposeHardening `json:"services"`
+}
+
+// BuildComposeServicePatch returns the hardening for a container created by
+// docker compose, or nil when the container has no compose labels or needs
+// no change. The keys come from the same fixes as the hardened run command.
+func BuildComposeServicePatch(c types.ContainerJSON, findings []Finding) *ComposeServicePatch {
+	project, service := c.Config.Labels[composeProjectLabel], c.Config.Labels[composeServiceLabel]
+	if project == "" || service == "" {
+		return nil
+	}
+
+	hardened, _ := HardenContainer(c, findings)
+	before, after := c.HostConfig, hardened.HostConfig
+	var h ComposeHardening
+	if before.Privileged && !after.Privileged {
+		privileged := false
+		h.Privileged = &privileged
+	}
+	if hardened.Config.User != c.Config.User {
+		h.User = quotedString(hardened.Config.User)
+	}
+	if !equalStrings(before.CapDrop, after.CapDrop) || !equalStrings(before.CapAdd, after.CapAdd) {
+		h.CapDrop = overrideList(after.CapDrop)
+		if len(after.CapAdd) > 0 || len(before.CapAdd) > 0 {
+			capAdd := append(overrideList{}, after.CapAdd...)
+			h.CapAdd = &capAdd
+		}
+	}
+	if !equalStrings(before.SecurityOpt, after.SecurityOpt) {
+		h.SecurityOpt = after.SecurityOpt
+	}
+	if after.ReadonlyRootfs && !before.ReadonlyRootfs {
+		h.ReadOnly = true
+		for _, target := range sortedKeys(after.Tmpfs) {
+			if _, ok := before.Tmpfs[target]; !ok {
+				h.Tmpfs = append(h.Tmpfs, target)
+			}
+		}
+	}
+	if after.PidsLimit != nil && (before.PidsLimit == nil || *before.PidsLimit != *after.PidsLimit) {
+		h.PidsLimit = *after.PidsLimit
+	}
+	if after.Memory != before.Memory {
+		h.MemLimit = formatBytes(after.Memory)
+	}
+
+	if h.isEmpty() {
+		return nil
+	}
+	return &ComposeServicePatch{
+		Project:     project,
+		Service:     service,
+		ConfigFiles: c.Config.Labels[composeConfigFilesLabel],
+		Hardening:   h,
+	}
+}
+
+func (h ComposeHardening) isEmpty() bool {
+	return h.Privileged == nil && h.User == "" && h.CapDrop == nil && h.CapAdd == nil && h.SecurityOpt == nil &&
+		!h.ReadOnly && h.Tmpfs == nil && h.PidsLimit == 0 && h.MemLimit == ""
+}
+
+// GroupComposePatches groups the compose patches of the containers per
+// project. Replicas of a scaled service share one entry.
+func GroupComposePatches(containerInfo []ContainerInfo) []ComposeProjectPatch {
+	projects := make(map[string]*ComposeProjectPatch)
+	for _, info := range containerInfo {
+		patch := info.ComposePatch
+		if patch == nil {
+			continue
+		}
+		project, ok := projects[patch.Project]
+		if !ok {
+			project = &ComposeProjectPatch{
+				Project:     patch.Project,
+				ConfigFiles: patch.ConfigFiles,
+				Services:    make(map[string]ComposeHardening),
+			}
+			projects[patch.Project] = project
+		}
+		if _, ok := project.Services[patch.Service]; !ok {
+			project.Services[patch.Service] = patch.Hardening
+		}
+	}
+
+	var patches []ComposeProjectPatch
+	for _, name := range sortedKeys(projects) {
+		patches = append(patches, *projects[name])
+	}
+	return patches
+}
+
+// YAML renders the patch as a compose override file.
+func (p ComposeProjectPatch) YAML() (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Hardening for compose project %s\n", p.Project)
+	if p.ConfigFiles != "" {
+		fmt.Fprintf(&b, "# Merge into %s\n", strings.ReplaceAll(p.ConfigFiles, ",", ", "))
+	}
+	b.WriteString("# !override and !reset replace the service's current lists and need Compose 2.24 or later.\n")
+
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	err := encoder.Encode(struct {
+		Services map[string]ComposeHardening `yaml:"services"`
+	}{p.Services})
+	if err != nil {
+		return "", fmt.Errorf("error encoding compose patch for project %s: %v", p.Project, err)
+	}
+	return b.String(), nil
+}
+
+// PrintComposePatches prints one YAML patch per compose project.
+func PrintComposePatches(patches []ComposeProjectPatch) {
+	if len(patches) == 0 {
+		fmt.Println("No compose services need hardening.")
+		return
+	}
+	for i, patch := range patches {
+		text, err := patch.YAML()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			continue
+		}
+		if i > 0 {
+			fmt.Println("---")
+		}
+		fmt.Print(text)
+	}
+}
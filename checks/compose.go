@@ -0,0 +1,500 @@
+package checks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-connections/nat"
+	"github.com/docker/go-units"
+	"gopkg.in/yaml.v3"
+)
+
+// ComposeProject is a compose file with its services mapped onto the
+// container model the container rules evaluate.
+type ComposeProject struct {
+	Path     string
+	Name     string
+	Services []ComposeService
+}
+
+// ComposeService is one service of a compose file.
+type ComposeService struct {
+	Name      string
+	Line      int
+	Runtime   string
+	Container types.ContainerJSON
+}
+
+// ComposeFinding is a finding for a service of a compose file.
+type ComposeFinding struct {
+	Finding
+	File    string `json:"file"`
+	Project string `json:"project"`
+	Service string `json:"service"`
+	Line    int    `json:"line"`
+}
+
+// composeServiceSpec is the part of the compose specification that maps onto
+// HostConfig and Config.
+type composeServiceSpec struct {
+	Image         string              `yaml:"image"`
+	ContainerName string              `yaml:"container_name"`
+	Privileged    bool                `yaml:"privileged"`
+	CapAdd        []string            `yaml:"cap_add"`
+	CapDrop       []string            `yaml:"cap_drop"`
+	SecurityOpt   []string            `yaml:"security_opt"`
+	NetworkMode   string              `yaml:"network_mode"`
+	Pid           string              `yaml:"pid"`
+	Ipc           string              `yaml:"ipc"`
+	Userns        string              `yaml:"userns_mode"`
+	Volumes       []composeVolume     `yaml:"volumes"`
+	Tmpfs         composeStrings      `yaml:"tmpfs"`
+	Devices       []composeDevice     `yaml:"devices"`
+	Ports         []composePort       `yaml:"ports"`
+	Expose        []composeScalar     `yaml:"expose"`
+	User          string              `yaml:"user"`
+	ReadOnly      bool                `yaml:"read_only"`
+	PidsLimit     *int64              `yaml:"pids_limit"`
+	MemLimit      composeBytes        `yaml:"mem_limit"`
+	Environment   composeMapping      `yaml:"environment"`
+	Labels        composeMapping      `yaml:"labels"`
+	Command       composeCommand      `yaml:"command"`
+	Entrypoint    composeCommand      `yaml:"entrypoint"`
+	Healthcheck   *composeHealthcheck `yaml:"healthcheck"`
+	Logging       *struct {
+		Driver  string            `yaml:"driver"`
+		Options map[string]string `yaml:"options"`
+	} `yaml:"logging"`
+	Init    *bool  `yaml:"init"`
+	Restart string `yaml:"restart"`
+	Runtime string `yaml:"runtime"`
+	Deploy  struct {
+		Resources struct {
+			Limits struct {
+				Memory composeBytes `yaml:"memory"`
+				Pids   *int64       `yaml:"pids"`
+			} `yaml:"limits"`
+		} `yaml:"resources"`
+	} `yaml:"deploy"`
+}
+
+// composeScalar accepts a string or number.
+type composeScalar string
+
+func (s *composeScalar) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: expected a scalar value", node.Line)
+	}
+	*s = composeScalar(node.Value)
+	return nil
+}
+
+// composeStrings accepts a single string or a list of strings.
+type composeStrings []string
+
+func (s *composeStrings) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*s = []string{node.Value}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+// composeCommand accepts a command as a string or a list.
+type composeCommand []string
+
+func (c *composeCommand) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		for _, word := range splitQuoted(node.Value) {
+			*c = append(*c, strings.Trim(word, `"'`))
+		}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*c = list
+	return nil
+}
+
+// composeMapping accepts KEY=value lists and KEY: value maps, and returns
+// the KEY=value form.
+type composeMapping []string
+
+func (m *composeMapping) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.SequenceNode {
+		var list []string
+		if err := node.Decode(&list); err != nil {
+			return err
+		}
+		*m = list
+		return nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: expected a list or mapping", node.Line)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		if value.Tag == "!!null" {
+			*m = append(*m, key)
+		} else {
+			*m = append(*m, key+"="+value.Value)
+		}
+	}
+	return nil
+}
+
+// labels returns the mapping as a label map.
+func (m composeMapping) labels() map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	labels := make(map[string]string, len(m))
+	for _, pair := range m {
+		key, value, _ := strings.Cut(pair, "=")
+		labels[key] = value
+	}
+	return labels
+}
+
+// composeBytes accepts a byte count as a number or a string such as "512m".
+type composeBytes int64
+
+func (b *composeBytes) UnmarshalYAML(node *yaml.Node) error {
+	if n, err := strconv.ParseInt(node.Value, 10, 64); err == nil {
+		*b = composeBytes(n)
+		return nil
+	}
+	n, err := units.RAMInBytes(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid size %q", node.Line, node.Value)
+	}
+	*b = composeBytes(n)
+	return nil
+}
+
+// composeVolume accepts the short "source:target:mode" and long volume syntax.
+type composeVolume struct {
+	Type     string `yaml:"type"`
+	Source   string `yaml:"source"`
+	Target   string `yaml:"target"`
+	ReadOnly bool   `yaml:"read_only"`
+}
+
+func (v *composeVolume) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		type plain composeVolume
+		return node.Decode((*plain)(v))
+	}
+
+	parts := strings.Split(node.Value, ":")
+	if len(parts) == 1 {
+		v.Type, v.Target = "volume", parts[0] // anonymous volume
+		return nil
+	}
+	v.Source, v.Target = parts[0], parts[1]
+	if len(parts) > 2 {
+		for _, option := range strings.Split(parts[2], ",") {
+			v.ReadOnly = v.ReadOnly || option == "ro"
+		}
+	}
+	v.Type = "volume"
+	if strings.HasPrefix(v.Source, "/") || strings.HasPrefix(v.Source, ".") || strings.HasPrefix(v.Source, "~") {
+		v.Type = "bind"
+	}
+	return nil
+}
+
+// composeDevice accepts the short "host:container:permissions" and long syntax.
+type composeDevice struct {
+	Source      string `yaml:"source"`
+	Target      string `yaml:"target"`
+	Permissions string `yaml:"permissions"`
+}
+
+func (d *composeDevice) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		type plain composeDevice
+		return node.Decode((*plain)(d))
+	}
+	parts := strings.SplitN(node.Value, ":", 3)
+	d.Source, d.Target = parts[0], parts[0]
+	if len(parts) > 1 {
+		d.Target = parts[1]
+	}
+	if len(parts) > 2 {
+		d.Permissions = parts[2]
+	}
+	return nil
+}
+
+// composePort accepts the short port syntax and the long syntax, keeping the
+// short form for nat.ParsePortSpecs.
+type composePort string
+
+func (p *composePort) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*p = composePort(node.Value)
+		return nil
+	}
+
+	var long struct {
+		Target    string `yaml:"target"`
+		Published string `yaml:"published"`
+		HostIP    string `yaml:"host_ip"`
+		Protocol  string `yaml:"protocol"`
+	}
+	if err := node.Decode(&long); err != nil {
+		return err
+	}
+	spec := long.Target
+	if long.Published != "" {
+		spec = long.Published + ":" + spec
+		if long.HostIP != "" {
+			spec = long.HostIP + ":" + spec
+		}
+	}
+	if long.Protocol != "" {
+		spec += "/" + long.Protocol
+	}
+	*p = composePort(spec)
+	return nil
+}
+
+// composeHealthcheck is the healthcheck section of a service.
+type composeHealthcheck struct {
+	Test     composeCommand `yaml:"test"`
+	Interval string         `yaml:"interval"`
+	Timeout  string         `yaml:"timeout"`
+	Retries  int            `yaml:"retries"`
+	Disable  bool           `yaml:"disable"`
+}
+
+// UnmarshalYAML keeps a string test as a single CMD-SHELL command rather than
+// splitting it into words.
+func (h *composeHealthcheck) UnmarshalYAML(node *yaml.Node) error {
+	type plain composeHealthcheck
+	if err := node.Decode((*plain)(h)); err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "test" && node.Content[i+1].Kind == yaml.ScalarNode {
+			h.Test = composeCommand{"CMD-SHELL", node.Content[i+1].Value}
+		}
+	}
+	return nil
+}
+
+// LoadComposeFile reads a compose file and maps each service onto the
+// container model. Relative bind mount sources are resolved against the
+// directory of the file.
+func LoadComposeFile(path string) (*ComposeProject, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading compose file %s: %v", path, err)
+	}
+
+	var file struct {
+		Name     string    `yaml:"name"`
+		Services yaml.Node `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing compose file %s: %v", path, err)
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		absPath = path
+	}
+	project := &ComposeProject{Path: path, Name: file.Name}
+	if project.Name == "" {
+		project.Name = filepath.Base(filepath.Dir(absPath))
+	}
+
+	// Services are read from the mapping node to keep their order and the
+	// line of each service name.
+	services := file.Services.Content
+	for i := 0; i+1 < len(services); i += 2 {
+		name, node := services[i].Value, services[i+1]
+		var spec composeServiceSpec
+		if err := node.Decode(&spec); err != nil {
+			return nil, fmt.Errorf("error parsing service %s in %s: %v", name, path, err)
+		}
+		service, err := spec.toService(name, filepath.Dir(absPath))
+		if err != nil {
+			return nil, fmt.Errorf("error in service %s in %s: %v", name, path, err)
+		}
+		service.Line = services[i].Line
+		project.Services = append(project.Services, service)
+	}
+
+	return project, nil
+}
+
+// toService builds the HostConfig and Config docker would create for the service.
+func (spec composeServiceSpec) toService(name, baseDir string) (ComposeService, error) {
+	hostConfig := &container.HostConfig{
+		Privileged:     spec.Privileged,
+		CapAdd:         spec.CapAdd,
+		CapDrop:        spec.CapDrop,
+		SecurityOpt:    spec.SecurityOpt,
+		NetworkMode:    container.NetworkMode(spec.NetworkMode),
+		PidMode:        container.PidMode(spec.Pid),
+		IpcMode:        container.IpcMode(spec.Ipc),
+		UsernsMode:     container.UsernsMode(spec.Userns),
+		ReadonlyRootfs: spec.ReadOnly,
+		Init:           spec.Init,
+		Runtime:        spec.Runtime,
+	}
+
+	hostConfig.PidsLimit = spec.PidsLimit
+	if hostConfig.PidsLimit == nil {
+		hostConfig.PidsLimit = spec.Deploy.Resources.Limits.Pids
+	}
+	hostConfig.Memory = int64(spec.MemLimit)
+	if hostConfig.Memory == 0 {
+		hostConfig.Memory = int64(spec.Deploy.Resources.Limits.Memory)
+	}
+
+	if spec.Restart != "" {
+		policy, retries, _ := strings.Cut(spec.Restart, ":")
+		hostConfig.RestartPolicy.Name = container.RestartPolicyMode(policy)
+		hostConfig.RestartPolicy.MaximumRetryCount, _ = strconv.Atoi(retries)
+	}
+	if spec.Logging != nil {
+		hostConfig.LogConfig = container.LogConfig{Type: spec.Logging.Driver, Config: spec.Logging.Options}
+	}
+
+	for _, v := range spec.Volumes {
+		source := v.Source
+		if v.Type == "bind" {
+			if strings.HasPrefix(source, "~") {
+				if home, err := os.UserHomeDir(); err == nil {
+					source = filepath.Join(home, source[1:])
+				}
+			} else if !filepath.IsAbs(source) {
+				source = filepath.Join(baseDir, source)
+			}
+		}
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+			Type:     mount.Type(v.Type),
+			Source:   source,
+			Target:   v.Target,
+			ReadOnly: v.ReadOnly,
+		})
+	}
+	for _, target := range spec.Tmpfs {
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{Type: mount.TypeTmpfs, Target: target})
+	}
+
+	for _, d := range spec.Devices {
+		permissions := d.Permissions
+		if permissions == "" {
+			permissions = "rwm"
+		}
+		hostConfig.Devices = append(hostConfig.Devices, container.DeviceMapping{
+			PathOnHost:        d.Source,
+			PathInContainer:   d.Target,
+			CgroupPermissions: permissions,
+		})
+	}
+
+	var portSpecs []string
+	for _, p := range spec.Ports {
+		portSpecs = append(portSpecs, string(p))
+	}
+	for _, p := range spec.Expose {
+		portSpecs = append(portSpecs, string(p))
+	}
+	exposedPorts, portBindings, err := nat.ParsePortSpecs(portSpecs)
+	if err != nil {
+		return ComposeService{}, fmt.Errorf("invalid ports: %v", err)
+	}
+	hostConfig.PortBindings = portBindings
+
+	config := &container.Config{
+		Image:        spec.Image,
+		User:         spec.User,
+		Env:          spec.Environment,
+		Labels:       spec.Labels.labels(),
+		Cmd:          []string(spec.Command),
+		Entrypoint:   []string(spec.Entrypoint),
+		ExposedPorts: exposedPorts,
+	}
+	if hc := spec.Healthcheck; hc != nil {
+		config.Healthcheck = &container.HealthConfig{Test: hc.Test, Retries: hc.Retries}
+		if hc.Disable {
+			config.Healthcheck.Test = []string{"NONE"}
+		}
+		config.Healthcheck.Interval, _ = time.ParseDuration(hc.Interval)
+		config.Healthcheck.Timeout, _ = time.ParseDuration(hc.Timeout)
+	}
+
+	containerName := spec.ContainerName
+	if containerName == "" {
+		containerName = name
+	}
+	return ComposeService{
+		Name:    name,
+		Runtime: spec.Runtime,
+		Container: types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				Name:       "/" + containerName,
+				HostConfig: hostConfig,
+			},
+			Config: config,
+		},
+	}, nil
+}
+
+// EvaluateComposeProject runs the container rules against every service of a
+// compose project. Runtimes are classified by name, since the daemon that
+// will run the project may not be reachable.
+func EvaluateComposeProject(project *ComposeProject) []ComposeFinding {
+	var findings []ComposeFinding
+	for _, service := range project.Services {
+		rc := &RuleContext{
+			Container: service.Container,
+			Runtime:   DaemonRuntimes{}.Resolve(service.Runtime),
+		}
+		for _, f := range EvaluateContainer(rc) {
+			findings = append(findings, ComposeFinding{
+				Finding: f,
+				File:    project.Path,
+				Project: project.Name,
+				Service: service.Name,
+				Line:    service.Line,
+			})
+		}
+	}
+	return findings
+}
+
+// PrintComposeFindings prints the findings of a compose project per service.
+func PrintComposeFindings(project *ComposeProject, findings []ComposeFinding) {
+	if len(findings) == 0 {
+		fmt.Printf("%s: no issues found in project %s.\n", project.Path, project.Name)
+		return
+	}
+
+	for _, f := range findings {
+		fmt.Printf("%s:%d: service %s: [%s] %s (%s)\n", f.File, f.Line, f.Service, f.Severity, f.Title, f.RuleID)
+		for _, e := range f.Evidence {
+			fmt.Printf("    %s\n", e)
+		}
+		fmt.Printf("  Recommendation: %s\n", f.Remediation)
+	}
+}
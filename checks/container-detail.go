@@ -0,0 +1,246 @@
+package checks
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// dockerDefaultCapabilities are the capabilities Docker grants a container
+// that does not drop them.
+var dockerDefaultCapabilities = []string{
+	"AUDIT_WRITE", "CHOWN", "DAC_OVERRIDE", "FOWNER", "FSETID", "KILL", "MKNOD",
+	"NET_BIND_SERVICE", "NET_RAW", "SETFCAP", "SETGID", "SETPCAP", "SETUID", "SYS_CHROOT",
+}
+
+// NamespaceMode is how a container joins one kind of namespace.
+type NamespaceMode struct {
+	Name string `json:"name"`
+	Mode string `json:"mode"`
+	Host bool   `json:"host"`
+}
+
+// ContainerDetail is everything the detail page shows about a container.
+type ContainerDetail struct {
+	ID                     string             `json:"id"`
+	Name                   string             `json:"name"`
+	Image                  string             `json:"image"`
+	ImageID                string             `json:"imageId"`
+	Digests                []string           `json:"digests"`
+	Created                string             `json:"created"`
+	Status                 string             `json:"status"`
+	Labels                 map[string]string  `json:"labels"`
+	User                   string             `json:"user"`
+	Privileged             bool               `json:"privileged"`
+	ReadOnlyRootFilesystem bool               `json:"readOnlyRootFilesystem"`
+	NoNewPrivileges        bool               `json:"noNewPrivileges"`
+	Capabilities           []string           `json:"capabilities"`
+	Seccomp                string             `json:"seccomp"`
+	AppArmor               string             `json:"appArmor"`
+	SELinux                string             `json:"selinux"`
+	Namespaces             []NamespaceMode    `json:"namespaces"`
+	Mounts                 []types.MountPoint `json:"mounts"`
+	Devices                []string           `json:"devices"`
+	Ports                  []string           `json:"ports"`
+	Findings               []Finding          `json:"findings"`
+	Inspect                string             `json:"inspect"`
+}
+
+// BuildContainerDetail describes a container from its inspect data, the
+// inspect data of its image when available, and its findings. Credentials in
+// the raw inspect JSON are redacted.
+func BuildContainerDetail(c types.ContainerJSON, imageInspect *types.ImageInspect, findings []Finding) (ContainerDetail, error) {
+	redacted, err := redactContainer(c)
+	if err != nil {
+		return ContainerDetail{}, err
+	}
+	inspect, err := json.MarshalIndent(redacted, "", "  ")
+	if err != nil {
+		return ContainerDetail{}, fmt.Errorf("error encoding container %s: %v", c.ID, err)
+	}
+
+	detail := ContainerDetail{
+		ID:       c.ID,
+		Name:     strings.TrimPrefix(c.Name, "/"),
+		ImageID:  c.Image,
+		Created:  c.Created,
+		Ports:    publishedPorts(c.HostConfig),
+		Mounts:   c.Mounts,
+		Findings: findings,
+		AppArmor: c.AppArmorProfile,
+		Inspect:  string(inspect),
+	}
+	if c.State != nil {
+		detail.Status = c.State.Status
+	}
+	if c.Config != nil {
+		detail.Image = c.Config.Image
+		detail.Labels = redacted.Config.Labels
+		detail.User = c.Config.User
+	}
+	if detail.User == "" {
+		detail.User = "root (default)"
+	}
+	if imageInspect != nil {
+		detail.Digests = imageInspect.RepoDigests
+	}
+
+	hostConfig := c.HostConfig
+	detail.Privileged = hostConfig.Privileged
+	detail.ReadOnlyRootFilesystem = hostConfig.ReadonlyRootfs
+	detail.Capabilities = effectiveCapabilities(hostConfig.Privileged, hostConfig.CapAdd, hostConfig.CapDrop)
+
+	detail.Seccomp = "default"
+	var labels []string
+	for _, opt := range hostConfig.SecurityOpt {
+		name, value, _ := strings.Cut(opt, "=")
+		if value == "" {
+			name, value, _ = strings.Cut(opt, ":")
+		}
+		switch name {
+		case "no-new-privileges":
+			detail.NoNewPrivileges = value == "" || value == "true"
+		case "seccomp":
+			if value == "unconfined" {
+				detail.Seccomp = "unconfined"
+			} else {
+				detail.Seccomp = "custom profile"
+			}
+		case "label":
+			labels = append(labels, value)
+		}
+	}
+	if hostConfig.Privileged {
+		detail.Seccomp = "unconfined (privileged)"
+	}
+	if detail.AppArmor == "" {
+		detail.AppArmor = "none"
+	}
+	switch {
+	case c.ProcessLabel != "":
+		detail.SELinux = c.ProcessLabel
+	case len(labels) > 0:
+		detail.SELinux = strings.Join(labels, ", ")
+	default:
+		detail.SELinux = "none"
+	}
+
+	for _, ns := range []struct{ name, mode string }{
+		{"network", string(hostConfig.NetworkMode)},
+		{"pid", string(hostConfig.PidMode)},
+		{"ipc", string(hostConfig.IpcMode)},
+		{"uts", string(hostConfig.UTSMode)},
+		{"user", string(hostConfig.UsernsMode)},
+		{"cgroup", string(hostConfig.CgroupnsMode)},
+	} {
+		mode := ns.mode
+		if mode == "" {
+			mode = "private"
+		}
+		detail.Namespaces = append(detail.Namespaces, NamespaceMode{Name: ns.name, Mode: mode, Host: mode == "host"})
+	}
+
+	for _, d := range hostConfig.Devices {
+		detail.Devices = append(detail.Devices, fmt.Sprintf("%s:%s:%s", d.PathOnHost, d.PathInContainer, d.CgroupPermissions))
+	}
+	return detail, nil
+}
+
+// effectiveCapabilities applies --cap-add and --cap-drop to Docker's default
+// set the way the daemon does. Privileged containers get every capability.
+func effectiveCapabilities(privileged bool, capAdd, capDrop []string) []string {
+	if privileged {
+		return []string{"ALL"}
+	}
+	set := make(map[string]bool)
+	dropAll := false
+	for _, capability := range capDrop {
+		if normalizeCapability(capability) == "ALL" {
+			dropAll = true
+		}
+	}
+	if !dropAll {
+		for _, capability := range dockerDefaultCapabilities {
+			set[capability] = true
+		}
+		for _, capability := range capDrop {
+			delete(set, normalizeCapability(capability))
+		}
+	}
+	for _, capability := range capAdd {
+		if normalizeCapability(capability) == "ALL" {
+			return []string{"ALL"}
+		}
+		set[normalizeCapability(capability)] = true
+	}
+	return sortedKeys(set)
+}
+
+// redactContainer returns a copy of the inspect data with the credentials in
+// environment variables, arguments and labels masked.
+func redactContainer(c types.ContainerJSON) (types.ContainerJSON, error) {
+	// Round-trip through JSON for a deep copy the redaction can modify.
+	var redacted types.ContainerJSON
+	data, err := json.Marshal(c)
+	if err != nil {
+		return redacted, fmt.Errorf("error encoding container %s: %v", c.ID, err)
+	}
+	if err := json.Unmarshal(data, &redacted); err != nil {
+		return redacted, fmt.Errorf("error decoding container %s: %v", c.ID, err)
+	}
+
+	if redacted.ContainerJSONBase != nil {
+		redacted.Args = redactArguments(redacted.Args)
+	}
+	if config := redacted.Config; config != nil {
+		for i, kv := range config.Env {
+			name, value, _ := strings.Cut(kv, "=")
+			if isSecretValue(name, value) {
+				config.Env[i] = name + "=" + RedactSecret(value)
+			}
+		}
+		config.Cmd = redactArguments(config.Cmd)
+		config.Entrypoint = redactArguments(config.Entrypoint)
+		config.Labels = redactLabels(config.Labels)
+	}
+	return redacted, nil
+}
+
+// redactLabels returns a copy of the labels with credential values masked.
+func redactLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(labels))
+	for name, value := range labels {
+		if isSecretValue(name, value) {
+			value = RedactSecret(value)
+		}
+		redacted[name] = value
+	}
+	return redacted
+}
+
+// redactArguments masks the secrets scanArguments would report.
+func redactArguments(args []string) []string {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if _, found := matchSecretValue(arg); found != "" {
+			args[i] = strings.ReplaceAll(arg, found, RedactSecret(found))
+			continue
+		}
+		flag, value, hasValue := strings.Cut(arg, "=")
+		if !secretFlagPattern.MatchString(flag) {
+			continue
+		}
+		if hasValue && value != "" {
+			args[i] = flag + "=" + RedactSecret(value)
+		} else if !hasValue && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			args[i+1] = RedactSecret(args[i+1])
+			i++
+		}
+	}
+	return args
+}
@@ -0,0 +1,319 @@
+package checks
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"debug/buildinfo"
+	"encoding/json"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Package types for language dependencies catalogued from image layers.
+const (
+	PackageTypeGo     = "go-module"
+	PackageTypePython = "python"
+	PackageTypeNPM    = "npm"
+	PackageTypeJava   = "java-archive"
+	// PackageTypeJavaManifest is a jar identified only by its manifest.
+	// Its name is not a Maven coordinate, so it is inventoried and listed in
+	// SBOMs but not matched against advisories.
+	PackageTypeJavaManifest = "java-manifest"
+)
+
+const (
+	// minGoBinarySize skips small executables, which are scripts or C
+	// binaries rather than Go programs.
+	minGoBinarySize = 512 << 10
+	// maxNestedArchiveDepth bounds how deep jars inside jars are opened.
+	maxNestedArchiveDepth = 2
+)
+
+var elfMagic = []byte("\x7fELF")
+
+// dependencyCataloger records the language dependencies found in each layer,
+// keyed by the file they were read from.
+type dependencyCataloger struct {
+	dependencies map[string]map[string][]Package // layer -> file path -> packages
+}
+
+func newDependencyCataloger() *dependencyCataloger {
+	return &dependencyCataloger{dependencies: make(map[string]map[string][]Package)}
+}
+
+func (c *dependencyCataloger) wantsFile(hdr *tar.Header) bool {
+	name := hdr.Name
+	switch {
+	case strings.HasSuffix(name, ".dist-info/METADATA"), strings.HasSuffix(name, ".egg-info/PKG-INFO"):
+		return true
+	case isNodeModulePackageJSON(name):
+		return true
+	case isJavaArchive(name):
+		return true
+	case hdr.Mode&0o111 != 0 && hdr.Size >= minGoBinarySize:
+		return true
+	}
+	return false
+}
+
+func (c *dependencyCataloger) visitFile(layer string, hdr *tar.Header, content []byte) error {
+	name := hdr.Name
+	var packages []Package
+	switch {
+	case strings.HasSuffix(name, ".dist-info/METADATA"), strings.HasSuffix(name, ".egg-info/PKG-INFO"):
+		packages = parsePythonMetadata(content)
+	case isNodeModulePackageJSON(name):
+		packages = parseNodePackageJSON(content)
+	case isJavaArchive(name):
+		packages = parseJavaArchive(content, 0)
+	case bytes.HasPrefix(content, elfMagic):
+		packages = parseGoBinary(content)
+	}
+	if len(packages) == 0 {
+		return nil
+	}
+
+	for i := range packages {
+		packages[i].Location = "/" + name
+	}
+	if c.dependencies[layer] == nil {
+		c.dependencies[layer] = make(map[string][]Package)
+	}
+	c.dependencies[layer][name] = packages
+	return nil
+}
+
+// resolve returns the dependencies of the files present in the image's final
+// filesystem.
+func (c *dependencyCataloger) resolve(img ArchivedImage) []Package {
+	files := make(map[string][]Package)
+	for _, layer := range img.Layers {
+		for filePath := range files {
+			if layer.deletes(filePath) {
+				delete(files, filePath)
+			}
+		}
+		for filePath, packages := range c.dependencies[layer.path] {
+			files[filePath] = packages
+		}
+	}
+
+	var packages []Package
+	for _, filePackages := range files {
+		packages = append(packages, filePackages...)
+	}
+	sort.Slice(packages, func(i, j int) bool {
+		if packages[i].Location != packages[j].Location {
+			return packages[i].Location < packages[j].Location
+		}
+		return packages[i].Name < packages[j].Name
+	})
+	return packages
+}
+
+// isNodeModulePackageJSON matches node_modules/<name>/package.json and
+// node_modules/@scope/<name>/package.json.
+func isNodeModulePackageJSON(name string) bool {
+	if path.Base(name) != "package.json" {
+		return false
+	}
+	dir := path.Dir(name)
+	parent := path.Dir(dir)
+	if path.Base(parent) == "node_modules" {
+		return true
+	}
+	return strings.HasPrefix(path.Base(parent), "@") && path.Base(path.Dir(parent)) == "node_modules"
+}
+
+func isJavaArchive(name string) bool {
+	switch path.Ext(name) {
+	case ".jar", ".war", ".ear":
+		return true
+	}
+	return false
+}
+
+// parseGoBinary reads the module build information embedded in a Go binary.
+func parseGoBinary(content []byte) []Package {
+	info, err := buildinfo.Read(bytes.NewReader(content))
+	if err != nil {
+		return nil
+	}
+
+	var packages []Package
+	if version := strings.TrimPrefix(info.GoVersion, "go"); version != "" {
+		packages = append(packages, Package{Name: "stdlib", Version: version, Type: PackageTypeGo, Ecosystem: "Go"})
+	}
+	if info.Main.Path != "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		packages = append(packages, Package{Name: info.Main.Path, Version: info.Main.Version, Type: PackageTypeGo, Ecosystem: "Go"})
+	}
+	for _, dep := range info.Deps {
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		if dep.Version == "" || dep.Version == "(devel)" {
+			continue
+		}
+		packages = append(packages, Package{Name: dep.Path, Version: dep.Version, Type: PackageTypeGo, Ecosystem: "Go"})
+	}
+	return packages
+}
+
+// parsePythonMetadata reads the Name and Version headers of a Python
+// distribution's METADATA or PKG-INFO file.
+func parsePythonMetadata(content []byte) []Package {
+	var pkg Package
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break // end of the header section
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Name":
+			pkg.Name = strings.TrimSpace(value)
+		case "Version":
+			pkg.Version = strings.TrimSpace(value)
+		}
+	}
+	if pkg.Name == "" || pkg.Version == "" {
+		return nil
+	}
+	pkg.Type = PackageTypePython
+	pkg.Ecosystem = "PyPI"
+	return []Package{pkg}
+}
+
+// parseNodePackageJSON reads the name and version of an installed npm package.
+func parseNodePackageJSON(content []byte) []Package {
+	var manifest struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(content, &manifest); err != nil || manifest.Name == "" || manifest.Version == "" {
+		return nil
+	}
+	return []Package{{Name: manifest.Name, Version: manifest.Version, Type: PackageTypeNPM, Ecosystem: "npm"}}
+}
+
+// parseJavaArchive reads Maven coordinates from the pom.properties files of a
+// jar, falling back to its manifest, and descends into nested jars such as
+// the BOOT-INF/lib directory of Spring Boot applications.
+func parseJavaArchive(content []byte, depth int) []Package {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil
+	}
+
+	var packages []Package
+	var manifest *zip.File
+	hasPom := false
+	for _, f := range archive.File {
+		switch {
+		case strings.HasPrefix(f.Name, "META-INF/maven/") && strings.HasSuffix(f.Name, "/pom.properties"):
+			if pkg, ok := readPomProperties(f); ok {
+				packages = append(packages, pkg)
+				hasPom = true
+			}
+		case f.Name == "META-INF/MANIFEST.MF":
+			manifest = f
+		case isJavaArchive(f.Name) && depth < maxNestedArchiveDepth && f.UncompressedSize64 <= maxLayerFileSize:
+			if nested, err := readZipFile(f); err == nil {
+				packages = append(packages, parseJavaArchive(nested, depth+1)...)
+			}
+		}
+	}
+
+	if !hasPom && manifest != nil {
+		if pkg, ok := readJarManifest(manifest); ok {
+			packages = append(packages, pkg)
+		}
+	}
+	return packages
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readPomProperties reads groupId, artifactId and version from pom.properties.
+func readPomProperties(f *zip.File) (Package, bool) {
+	content, err := readZipFile(f)
+	if err != nil {
+		return Package{}, false
+	}
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if key, value, ok := strings.Cut(line, "="); ok && !strings.HasPrefix(line, "#") {
+			values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	if values["groupId"] == "" || values["artifactId"] == "" || values["version"] == "" {
+		return Package{}, false
+	}
+	return Package{
+		Name:      values["groupId"] + ":" + values["artifactId"],
+		Version:   values["version"],
+		Type:      PackageTypeJava,
+		Ecosystem: "Maven",
+	}, true
+}
+
+// readJarManifest identifies a jar without Maven metadata from the OSGi or
+// implementation attributes of its manifest.
+func readJarManifest(f *zip.File) (Package, bool) {
+	content, err := readZipFile(f)
+	if err != nil {
+		return Package{}, false
+	}
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		if key, value, ok := strings.Cut(scanner.Text(), ":"); ok {
+			values[key] = strings.TrimSpace(value)
+		}
+	}
+
+	name, version := values["Bundle-SymbolicName"], values["Bundle-Version"]
+	if name == "" || version == "" {
+		name, version = values["Implementation-Title"], values["Implementation-Version"]
+	}
+	name, _, _ = strings.Cut(name, ";")
+	if name == "" || version == "" {
+		return Package{}, false
+	}
+	return Package{Name: name, Version: version, Type: PackageTypeJavaManifest}, true
+}
+
+var pythonNameSeparators = regexp.MustCompile(`[-_.]+`)
+
+// normalizePackageName puts a package name in the form advisories use for its
+// ecosystem. PyPI names compare case-insensitively with -, _ and . equivalent.
+func normalizePackageName(ecosystem, name string) string {
+	if base, _, _ := strings.Cut(ecosystem, ":"); base == "PyPI" {
+		return pythonNameSeparators.ReplaceAllString(strings.ToLower(name), "-")
+	}
+	return name
+}
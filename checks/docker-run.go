@@ -0,0 +1,559 @@
+package checks
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+)
+
+// RunCommand is a docker run command line, one option per element so that
+// two commands can be compared line by line. Elements are shell-quoted.
+type RunCommand []string
+
+// String formats the command over several lines with backslash continuations.
+func (r RunCommand) String() string {
+	return strings.Join(r, " \\\n    ")
+}
+
+// DiffLine is one line of a diff between two run commands. Op is "+" for an
+// added line, "-" for a removed one and " " for an unchanged one.
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// RunRemediation is the docker run command of a container next to a
+// hardened variant that resolves its findings.
+type RunRemediation struct {
+	Original RunCommand `json:"original"`
+	Hardened RunCommand `json:"hardened"`
+	Diff     []DiffLine `json:"diff"`
+	Changes  []string   `json:"changes"`
+}
+
+// Settings applied by the hardened variant when the container has none.
+const (
+	hardenedUser      = "65534:65534" // nobody:nogroup
+	hardenedPidsLimit = 256
+	hardenedMemory    = 512 << 20
+)
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes a word for a POSIX shell when it needs quoting.
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// option formats a flag and its value as one line of a run command.
+func option(flag, value string) string {
+	return flag + " " + shellQuote(value)
+}
+
+// formatBytes formats a byte count the way it would be passed to --memory.
+func formatBytes(n int64) string {
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"g", 1 << 30}, {"m", 1 << 20}, {"k", 1 << 10}} {
+		if n%unit.size == 0 {
+			return strconv.FormatInt(n/unit.size, 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// BuildRunCommand reconstructs a docker run command that creates an
+// equivalent container. When the image is known, settings inherited from it
+// (environment, labels, user, command) are left out.
+func BuildRunCommand(c types.ContainerJSON, imageInspect *types.ImageInspect) RunCommand {
+	hc, cfg := c.HostConfig, c.Config
+	imageCfg := &container.Config{}
+	if imageInspect != nil && imageInspect.Config != nil {
+		imageCfg = imageInspect.Config
+	}
+
+	start := "docker run -d"
+	if cfg.OpenStdin && cfg.Tty {
+		start += " -it"
+	} else if cfg.Tty {
+		start += " -t"
+	} else if cfg.OpenStdin {
+		start += " -i"
+	}
+	cmd := RunCommand{start}
+	add := func(flag, value string) { cmd = append(cmd, option(flag, value)) }
+
+	if name := strings.TrimPrefix(c.Name, "/"); name != "" {
+		add("--name", name)
+	}
+	if cfg.Hostname != "" && !strings.HasPrefix(c.ID, cfg.Hostname) {
+		add("--hostname", cfg.Hostname)
+	}
+	if cfg.User != imageCfg.User {
+		add("--user", cfg.User)
+	}
+	if cfg.WorkingDir != imageCfg.WorkingDir {
+		add("--workdir", cfg.WorkingDir)
+	}
+	// Credentials are not copied into the command: a secret variable is
+	// passed by name so that docker run takes it from the caller's
+	// environment, and secret labels and arguments are masked.
+	for _, env := range difference(cfg.Env, imageCfg.Env) {
+		name, value, _ := strings.Cut(env, "=")
+		if isSecretValue(name, value) {
+			env = name
+		}
+		add("-e", env)
+	}
+	labels := redactLabels(cfg.Labels)
+	for _, key := range sortedKeys(cfg.Labels) {
+		if value, ok := imageCfg.Labels[key]; !ok || value != cfg.Labels[key] {
+			add("--label", key+"="+labels[key])
+		}
+	}
+
+	// docker run takes a single --entrypoint word; the rest of the
+	// entrypoint moves in front of the command.
+	var args []string
+	entrypointChanged := !equalStrings(cfg.Entrypoint, imageCfg.Entrypoint)
+	if entrypointChanged {
+		if len(cfg.Entrypoint) == 0 {
+			add("--entrypoint", "")
+		} else {
+			add("--entrypoint", cfg.Entrypoint[0])
+			args = append(args, cfg.Entrypoint[1:]...)
+		}
+	}
+	if entrypointChanged || !equalStrings(cfg.Cmd, imageCfg.Cmd) {
+		args = append(args, cfg.Cmd...)
+	}
+
+	if mode := string(hc.NetworkMode); mode != "" && mode != "default" && mode != "bridge" {
+		add("--network", mode)
+	}
+	if c.NetworkSettings != nil {
+		for _, name := range sortedKeys(c.NetworkSettings.Networks) {
+			if name != string(hc.NetworkMode) && name != "bridge" && !hc.NetworkMode.IsContainer() && !hc.NetworkMode.IsHost() && !hc.NetworkMode.IsNone() {
+				add("--network", name)
+			}
+		}
+	}
+	for _, ns := range []struct{ flag, mode string }{
+		{"--pid", string(hc.PidMode)},
+		{"--ipc", string(hc.IpcMode)},
+		{"--uts", string(hc.UTSMode)},
+		{"--userns", string(hc.UsernsMode)},
+	} {
+		if ns.mode != "" && ns.mode != "private" && ns.mode != "shareable" {
+			add(ns.flag, ns.mode)
+		}
+	}
+
+	if hc.PublishAllPorts {
+		cmd = append(cmd, "-P")
+	}
+	ports := make([]string, 0, len(hc.PortBindings))
+	for port := range hc.PortBindings {
+		ports = append(ports, string(port))
+	}
+	sort.Strings(ports)
+	for _, port := range ports {
+		for _, binding := range hc.PortBindings[nat.Port(port)] {
+			spec := port
+			if binding.HostPort != "" {
+				spec = binding.HostPort + ":" + spec
+			}
+			if binding.HostIP != "" {
+				spec = binding.HostIP + ":" + spec
+			}
+			add("-p", strings.TrimSuffix(spec, "/tcp"))
+		}
+	}
+	var exposed []string
+	for port := range cfg.ExposedPorts {
+		if _, published := hc.PortBindings[port]; published {
+			continue
+		}
+		if _, inherited := imageCfg.ExposedPorts[port]; inherited {
+			continue
+		}
+		exposed = append(exposed, string(port))
+	}
+	sort.Strings(exposed)
+	for _, port := range exposed {
+		add("--expose", strings.TrimSuffix(port, "/tcp"))
+	}
+
+	for _, bind := range hc.Binds {
+		add("-v", bind)
+	}
+	for _, m := range hc.Mounts {
+		spec := "type=" + string(m.Type)
+		if m.Source != "" {
+			spec += ",source=" + m.Source
+		}
+		spec += ",target=" + m.Target
+		if m.ReadOnly {
+			spec += ",readonly"
+		}
+		add("--mount", spec)
+	}
+	for _, target := range sortedKeys(hc.Tmpfs) {
+		if options := hc.Tmpfs[target]; options != "" {
+			add("--tmpfs", target+":"+options)
+		} else {
+			add("--tmpfs", target)
+		}
+	}
+	for _, d := range hc.Devices {
+		add("--device", d.PathOnHost+":"+d.PathInContainer+":"+d.CgroupPermissions)
+	}
+
+	if hc.Privileged {
+		cmd = append(cmd, "--privileged")
+	}
+	for _, capability := range hc.CapDrop {
+		add("--cap-drop", capability)
+	}
+	for _, capability := range hc.CapAdd {
+		add("--cap-add", capability)
+	}
+	for _, opt := range hc.SecurityOpt {
+		add("--security-opt", opt)
+	}
+	if hc.ReadonlyRootfs {
+		cmd = append(cmd, "--read-only")
+	}
+	if hc.Init != nil && *hc.Init {
+		cmd = append(cmd, "--init")
+	}
+	if hc.Runtime != "" && hc.Runtime != "runc" {
+		add("--runtime", hc.Runtime)
+	}
+
+	if hc.Memory > 0 {
+		add("--memory", formatBytes(hc.Memory))
+	}
+	if hc.MemoryReservation > 0 {
+		add("--memory-reservation", formatBytes(hc.MemoryReservation))
+	}
+	if hc.MemorySwap != 0 && hc.MemorySwap != hc.Memory*2 {
+		if hc.MemorySwap < 0 {
+			add("--memory-swap", "-1")
+		} else {
+			add("--memory-swap", formatBytes(hc.MemorySwap))
+		}
+	}
+	if hc.NanoCPUs > 0 {
+		add("--cpus", strconv.FormatFloat(float64(hc.NanoCPUs)/1e9, 'f', -1, 64))
+	}
+	if hc.CPUShares > 0 {
+		add("--cpu-shares", strconv.FormatInt(hc.CPUShares, 10))
+	}
+	if hc.CpusetCpus != "" {
+		add("--cpuset-cpus", hc.CpusetCpus)
+	}
+	if hc.PidsLimit != nil && *hc.PidsLimit > 0 {
+		add("--pids-limit", strconv.FormatInt(*hc.PidsLimit, 10))
+	}
+	for _, ulimit := range hc.Ulimits {
+		add("--ulimit", ulimit.String())
+	}
+
+	if policy := hc.RestartPolicy; policy.Name != "" && policy.Name != container.RestartPolicyDisabled {
+		value := string(policy.Name)
+		if policy.IsOnFailure() && policy.MaximumRetryCount > 0 {
+			value += ":" + strconv.Itoa(policy.MaximumRetryCount)
+		}
+		add("--restart", value)
+	}
+	if hc.LogConfig.Type != "" && hc.LogConfig.Type != "json-file" {
+		add("--log-driver", hc.LogConfig.Type)
+	}
+	for _, key := range sortedKeys(hc.LogConfig.Config) {
+		add("--log-opt", key+"="+hc.LogConfig.Config[key])
+	}
+	for _, host := range hc.ExtraHosts {
+		add("--add-host", host)
+	}
+	for _, dns := range hc.DNS {
+		add("--dns", dns)
+	}
+
+	if health := cfg.Healthcheck; health != nil && !healthcheckEqual(health, imageCfg.Healthcheck) {
+		switch {
+		case len(health.Test) > 0 && health.Test[0] == "NONE":
+			cmd = append(cmd, "--no-healthcheck")
+		case len(health.Test) > 1 && health.Test[0] == "CMD-SHELL":
+			add("--health-cmd", health.Test[1])
+		case len(health.Test) > 1 && health.Test[0] == "CMD":
+			quoted := make([]string, 0, len(health.Test)-1)
+			for _, word := range health.Test[1:] {
+				quoted = append(quoted, shellQuote(word))
+			}
+			add("--health-cmd", strings.Join(quoted, " "))
+		}
+		if health.Interval > 0 {
+			add("--health-interval", health.Interval.String())
+		}
+		if health.Timeout > 0 {
+			add("--health-timeout", health.Timeout.String())
+		}
+		if health.Retries > 0 {
+			add("--health-retries", strconv.Itoa(health.Retries))
+		}
+	}
+
+	image := shellQuote(cfg.Image)
+	for _, arg := range redactArguments(args) {
+		image += " " + shellQuote(arg)
+	}
+	return append(cmd, image)
+}
+
+// HardenContainer returns a copy of the container with the fixes for its
+// findings applied, and a description of each change.
+func HardenContainer(c types.ContainerJSON, findings []Finding) (types.ContainerJSON, []string) {
+	hc := *c.HostConfig
+	cfg := *c.Config
+	base := *c.ContainerJSONBase
+	base.HostConfig = &hc
+	hardened := c
+	hardened.ContainerJSONBase = &base
+	hardened.Config = &cfg
+
+	var changes []string
+	found := make(map[string]bool)
+	for _, f := range findings {
+		found[f.RuleID] = true
+	}
+
+	if hc.Privileged {
+		hc.Privileged = false
+		changes = append(changes, "Removed --privileged")
+	}
+
+	// Drop every capability and add back only the ones the container
+	// already asked for that are not risky, plus NET_BIND_SERVICE when it
+	// listens on a privileged port.
+	var kept []string
+	for _, capability := range hc.CapAdd {
+		normalized := normalizeCapability(capability)
+		if normalized == "ALL" || found[CapabilityRuleID(normalized)] {
+			changes = append(changes, "Removed --cap-add "+capability)
+			continue
+		}
+		kept = append(kept, capability)
+	}
+	for port := range cfg.ExposedPorts {
+		if port.Int() < 1024 && !containsCapability(kept, "NET_BIND_SERVICE") {
+			kept = append(kept, "NET_BIND_SERVICE")
+			changes = append(changes, fmt.Sprintf("Added --cap-add NET_BIND_SERVICE for port %s", port))
+		}
+	}
+	hc.CapAdd = kept
+	if !containsCapability(hc.CapDrop, "ALL") {
+		hc.CapDrop = []string{"ALL"}
+		changes = append(changes, "Added --cap-drop ALL")
+	}
+
+	var securityOpt []string
+	for _, opt := range hc.SecurityOpt {
+		if isUnconfinedProfile(opt) {
+			changes = append(changes, "Removed --security-opt "+opt)
+			continue
+		}
+		securityOpt = append(securityOpt, opt)
+	}
+	if !hasNoNewPrivileges(securityOpt) {
+		securityOpt = append(securityOpt, "no-new-privileges:true")
+		changes = append(changes, "Added --security-opt no-new-privileges:true")
+	}
+	hc.SecurityOpt = securityOpt
+
+	if !hc.ReadonlyRootfs {
+		hc.ReadonlyRootfs = true
+		changes = append(changes, "Added --read-only")
+		if _, ok := hc.Tmpfs["/tmp"]; !ok && !hasMountTarget(c, "/tmp") {
+			tmpfs := map[string]string{"/tmp": ""}
+			for target, options := range hc.Tmpfs {
+				tmpfs[target] = options
+			}
+			hc.Tmpfs = tmpfs
+			changes = append(changes, "Added --tmpfs /tmp for scratch files")
+		}
+	}
+
+	if hc.PidsLimit == nil || *hc.PidsLimit <= 0 {
+		limit := int64(hardenedPidsLimit)
+		hc.PidsLimit = &limit
+		changes = append(changes, fmt.Sprintf("Added --pids-limit %d", limit))
+	}
+
+	if hc.Memory <= 0 {
+		hc.Memory = hardenedMemory
+		changes = append(changes, "Added --memory "+formatBytes(hardenedMemory)+"; adjust it to the workload")
+	}
+
+	if isRootUser(cfg.User) {
+		cfg.User = hardenedUser
+		changes = append(changes, "Set --user "+hardenedUser+"; use the UID the image expects if it has one")
+	}
+
+	return hardened, changes
+}
+
+// BuildRunRemediation reconstructs the run command of a container and a
+// hardened variant, and diffs them.
+func BuildRunRemediation(c types.ContainerJSON, imageInspect *types.ImageInspect, findings []Finding) RunRemediation {
+	hardened, changes := HardenContainer(c, findings)
+	original := BuildRunCommand(c, imageInspect)
+	hardenedCommand := BuildRunCommand(hardened, imageInspect)
+	return RunRemediation{
+		Original: original,
+		Hardened: hardenedCommand,
+		Diff:     diffLines(original, hardenedCommand),
+		Changes:  changes,
+	}
+}
+
+// PrintRunRemediation prints the original command, the hardened one and the
+// diff between them.
+func PrintRunRemediation(name string, remediation RunRemediation) {
+	fmt.Printf("Container %s\n", name)
+	fmt.Printf("  Current:\n    %s\n", remediation.Original)
+	fmt.Printf("  Hardened:\n    %s\n", remediation.Hardened)
+	fmt.Println("  Diff:")
+	for _, line := range remediation.Diff {
+		fmt.Printf("    %s %s\n", line.Op, line.Text)
+	}
+	for _, change := range remediation.Changes {
+		fmt.Printf("  - %s\n", change)
+	}
+}
+
+// diffLines computes a line diff from the longest common subsequence.
+func diffLines(a, b []string) []DiffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []DiffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, DiffLine{Op: " ", Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{Op: "-", Text: a[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{Op: "+", Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, DiffLine{Op: "-", Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, DiffLine{Op: "+", Text: b[j]})
+	}
+	return diff
+}
+
+// difference returns the elements of a that are not in b, in order.
+func difference(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, s := range b {
+		in[s] = true
+	}
+	var out []string
+	for _, s := range a {
+		if !in[s] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func healthcheckEqual(a, b *container.HealthConfig) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return equalStrings(a.Test, b.Test) && a.Interval == b.Interval && a.Timeout == b.Timeout && a.Retries == b.Retries
+}
+
+// sortedKeys returns the keys of a string-keyed map in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func containsCapability(capabilities []string, capability string) bool {
+	for _, c := range capabilities {
+		if normalizeCapability(c) == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMountTarget reports whether anything is mounted at target.
+func hasMountTarget(c types.ContainerJSON, target string) bool {
+	for _, m := range c.Mounts {
+		if m.Destination == target {
+			return true
+		}
+	}
+	for _, m := range c.HostConfig.Mounts {
+		if m.Target == target {
+			return true
+		}
+	}
+	for _, bind := range c.HostConfig.Binds {
+		if parts := strings.Split(bind, ":"); len(parts) > 1 && parts[1] == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,413 @@
+package checks
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DockerfileMatch is one place in a Dockerfile where a rule matched.
+type DockerfileMatch struct {
+	Line     int
+	Evidence string
+}
+
+// DockerfileRule is a single check run against a Dockerfile.
+type DockerfileRule struct {
+	ID          string
+	Family      string
+	Severity    Severity
+	Title       string
+	Remediation string
+	Check       func(df *Dockerfile) []DockerfileMatch
+}
+
+// DockerfileFinding is a finding located at a line of a Dockerfile.
+type DockerfileFinding struct {
+	Finding
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// dockerfileRules is the registry of rules evaluated for every Dockerfile.
+var dockerfileRules []DockerfileRule
+
+// registerDockerfileRules adds rules to the registry.
+func registerDockerfileRules(rules ...DockerfileRule) {
+	dockerfileRules = append(dockerfileRules, rules...)
+}
+
+// DockerfileRules returns the registered Dockerfile rules.
+func DockerfileRules() []DockerfileRule {
+	return dockerfileRules
+}
+
+// EvaluateDockerfile runs every registered rule against a Dockerfile and
+// returns one finding per match, in line order.
+func EvaluateDockerfile(df *Dockerfile) []DockerfileFinding {
+	var findings []DockerfileFinding
+	for _, rule := range dockerfileRules {
+		for _, match := range rule.Check(df) {
+			findings = append(findings, DockerfileFinding{
+				Finding: Finding{
+					RuleID:      rule.ID,
+					Family:      rule.Family,
+					Severity:    clampToFamilyBand(rule.Family, rule.Severity),
+					Title:       rule.Title,
+					Evidence:    []string{match.Evidence},
+					Remediation: rule.Remediation,
+				},
+				File: df.Path,
+				Line: match.Line,
+			})
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Line != findings[j].Line {
+			return findings[i].Line < findings[j].Line
+		}
+		return findings[i].Severity > findings[j].Severity
+	})
+	return findings
+}
+
+// PrintDockerfileFindings prints findings in the file:line form editors and CI
+// logs link to.
+func PrintDockerfileFindings(path string, findings []DockerfileFinding) {
+	if len(findings) == 0 {
+		fmt.Printf("%s: no issues found.\n", path)
+		return
+	}
+
+	for _, f := range findings {
+		fmt.Printf("%s:%d: [%s] %s (%s)\n", path, f.Line, f.Severity, f.Title, f.RuleID)
+		for _, e := range f.Evidence {
+			fmt.Printf("    %s\n", e)
+		}
+		fmt.Printf("  Recommendation: %s\n", f.Remediation)
+	}
+}
+
+// finalStage returns the index of the stage the built image comes from.
+func (df *Dockerfile) finalStage() int {
+	return len(df.Stages) - 1
+}
+
+// stageUser returns the USER instruction in effect at the end of a stage,
+// following FROM references to earlier stages. ok is false when no stage in
+// the chain sets a user, so the image runs as its base image's user.
+func (df *Dockerfile) stageUser(stage int) (DockerfileInstruction, bool) {
+	for depth := 0; stage >= 0 && depth < len(df.Stages); depth++ {
+		instructions := df.StageInstructions(stage)
+		for i := len(instructions) - 1; i >= 0; i-- {
+			if instructions[i].Command == "USER" {
+				return instructions[i], true
+			}
+		}
+		stage = df.stageIndex(df.Stages[stage].Image)
+	}
+	return DockerfileInstruction{}, false
+}
+
+// runCommand returns the shell command of a RUN instruction.
+func (inst DockerfileInstruction) runCommand() string {
+	if inst.JSONForm {
+		return strings.Join(inst.Args, " ")
+	}
+	return inst.Raw
+}
+
+var (
+	pipeToShellPattern = regexp.MustCompile(`\b(curl|wget)\b[^|;&]*\|\s*(sudo\s+)?(\S*/)?(ba|da|z|k)?sh\b`)
+	worldWritePattern  = regexp.MustCompile(`\bchmod\s+(-\S+\s+)*(0?777|[ugo]*a[ugo]*\+rwx|ugo\+rwx|o\+w|a\+w)\b`)
+	aptInstallPattern  = regexp.MustCompile(`\bapt(-get)?\s+(\S+\s+)*install\b`)
+	aptCleanupPattern  = regexp.MustCompile(`rm\s+-\S*r\S*\s+(\S+\s+)*/var/lib/apt/lists`)
+	commandSeparators  = regexp.MustCompile(`&&|\|\||;|\||\n`)
+)
+
+// unpinnedAptPackages returns the packages of apt-get install commands that
+// are not pinned to a version with name=version.
+func unpinnedAptPackages(command string) []string {
+	var unpinned []string
+	for _, segment := range commandSeparators.Split(command, -1) {
+		loc := aptInstallPattern.FindStringIndex(segment)
+		if loc == nil {
+			continue
+		}
+		for _, word := range strings.Fields(segment[loc[1]:]) {
+			if strings.HasPrefix(word, "-") || strings.Contains(word, "=") || strings.HasPrefix(word, "$") {
+				continue
+			}
+			unpinned = append(unpinned, word)
+		}
+	}
+	return unpinned
+}
+
+func init() {
+	registerDockerfileRules(
+		DockerfileRule{
+			ID:          "dockerfile-invalid-instruction",
+			Family:      FamilySecurity,
+			Severity:    SeverityMedium,
+			Title:       "Invalid Dockerfile instruction or flag",
+			Remediation: "Remove the instruction or flag. Privileges, seccomp profiles and capabilities are set when the container is run (docker run --security-opt, --cap-add), not in the Dockerfile.",
+			Check: func(df *Dockerfile) []DockerfileMatch {
+				var matches []DockerfileMatch
+				for _, inst := range df.Instructions {
+					allowed, known := dockerfileFlags[inst.Command]
+					if !known {
+						matches = append(matches, DockerfileMatch{inst.Line, fmt.Sprintf("unknown instruction %s", inst.Command)})
+						continue
+					}
+					for _, flag := range inst.Flags {
+						name, _, _ := strings.Cut(strings.TrimPrefix(flag, "--"), "=")
+						valid := false
+						for _, a := range allowed {
+							valid = valid || name == a
+						}
+						if !valid {
+							matches = append(matches, DockerfileMatch{inst.Line, fmt.Sprintf("%s does not accept the flag %s", inst.Command, flag)})
+						}
+					}
+					if inst.Command == "RUN" && len(inst.Args) == 0 {
+						matches = append(matches, DockerfileMatch{inst.Line, "RUN has no command"})
+					}
+				}
+				return matches
+			},
+		},
+		DockerfileRule{
+			ID:          "dockerfile-run-insecure",
+			Family:      FamilySecurity,
+			Severity:    SeverityHigh,
+			Title:       "RUN step executes with elevated privileges",
+			Remediation: "Remove --security=insecure; build steps should not need privileged access to the build host.",
+			Check: func(df *Dockerfile) []DockerfileMatch {
+				var matches []DockerfileMatch
+				for _, inst := range df.Instructions {
+					for _, flag := range inst.Flags {
+						if inst.Command == "RUN" && flag == "--security=insecure" {
+							matches = append(matches, DockerfileMatch{inst.Line, "RUN " + flag})
+						}
+					}
+				}
+				return matches
+			},
+		},
+		DockerfileRule{
+			ID:          "dockerfile-user-root",
+			Family:      FamilySecurity,
+			Severity:    SeverityHigh,
+			Title:       "Image runs as root",
+			Remediation: "End the final stage with a USER instruction for an unprivileged user.",
+			Check: func(df *Dockerfile) []DockerfileMatch {
+				user, ok := df.stageUser(df.finalStage())
+				if ok && len(user.Args) > 0 && isRootUser(user.Args[0]) {
+					return []DockerfileMatch{{user.Line, "USER " + strings.Join(user.Args, " ")}}
+				}
+				return nil
+			},
+		},
+		DockerfileRule{
+			ID:          "dockerfile-user-missing",
+			Family:      FamilySecurity,
+			Severity:    SeverityMedium,
+			Title:       "No USER instruction",
+			Remediation: "Add a USER instruction for an unprivileged user to the final stage; without one the image runs as root unless its base image sets a user.",
+			Check: func(df *Dockerfile) []DockerfileMatch {
+				stage := df.finalStage()
+				if stage < 0 {
+					return nil
+				}
+				if _, ok := df.stageUser(stage); ok || strings.Contains(df.Stages[stage].Image, "nonroot") {
+					return nil
+				}
+				return []DockerfileMatch{{df.Stages[stage].Line, fmt.Sprintf("final stage FROM %s sets no user", df.Stages[stage].Image)}}
+			},
+		},
+		DockerfileRule{
+			ID:          "dockerfile-latest-tag",
+			Family:      FamilySecurity,
+			Severity:    SeverityMedium,
+			Title:       "Base image uses the latest tag",
+			Remediation: "Pin the base image to a version tag or, better, a digest (image:tag@sha256:...).",
+			Check: func(df *Dockerfile) []DockerfileMatch {
+				var matches []DockerfileMatch
+				for i, s := range df.Stages {
+					image := df.expandArgs(s.Image)
+					if image == "" || image == "scratch" || strings.Contains(image, "$") {
+						continue
+					}
+					if ref := df.stageIndex(image); ref >= 0 && ref < i {
+						continue // an earlier build stage
+					}
+					if imageReferenceTag(image) == "latest" {
+						matches = append(matches, DockerfileMatch{s.Line, "FROM " + s.Image})
+					}
+				}
+				return matches
+			},
+		},
+		DockerfileRule{
+			ID:          "dockerfile-add-url",
+			Family:      FamilySecurity,
+			Severity:    SeverityMedium,
+			Title:       "ADD downloads a remote file",
+			Remediation: "Download with curl or wget in a RUN step and verify a checksum, or use ADD --checksum.",
+			Check: func(df *Dockerfile) []DockerfileMatch {
+				var matches []DockerfileMatch
+				for _, inst := range df.Instructions {
+					if inst.Command != "ADD" {
+						continue
+					}
+					hasChecksum := false
+					for _, flag := range inst.Flags {
+						hasChecksum = hasChecksum || strings.HasPrefix(flag, "--checksum=")
+					}
+					for _, src := range inst.Args {
+						if (strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://")) && !hasChecksum {
+							matches = append(matches, DockerfileMatch{inst.Line, "ADD " + src})
+						}
+					}
+				}
+				return matches
+			},
+		},
+		DockerfileRule{
+			ID:          "dockerfile-pipe-to-shell",
+			Family:      FamilySecurity,
+			Severity:    SeverityHigh,
+			Title:       "Remote script piped into a shell",
+			Remediation: "Download the script, verify its checksum or signature, and then run it.",
+			Check: func(df *Dockerfile) []DockerfileMatch {
+				var matches []DockerfileMatch
+				for _, inst := range df.Instructions {
+					if inst.Command != "RUN" {
+						continue
+					}
+					if m := pipeToShellPattern.FindString(inst.runCommand()); m != "" {
+						matches = append(matches, DockerfileMatch{inst.Line, m})
+					}
+				}
+				return matches
+			},
+		},
+		DockerfileRule{
+			ID:          "dockerfile-chmod-777",
+			Family:      FamilySecurity,
+			Severity:    SeverityMedium,
+			Title:       "Files made world-writable",
+			Remediation: "Grant only the permissions the process needs, and change ownership with --chown instead of opening permissions to everyone.",
+			Check: func(df *Dockerfile) []DockerfileMatch {
+				var matches []DockerfileMatch
+				for _, inst := range df.Instructions {
+					if inst.Command != "RUN" {
+						continue
+					}
+					if m := worldWritePattern.FindString(inst.runCommand()); m != "" {
+						matches = append(matches, DockerfileMatch{inst.Line, m})
+					}
+				}
+				return matches
+			},
+		},
+		DockerfileRule{
+			ID:          "dockerfile-secrets",
+			Family:      FamilySecurity,
+			Severity:    SeverityHigh,
+			Title:       "Secret in ARG or ENV",
+			Remediation: "Pass secrets with RUN --mount=type=secret; ARG and ENV values are stored in the image history and configuration.",
+			Check: func(df *Dockerfile) []DockerfileMatch {
+				var matches []DockerfileMatch
+				for _, inst := range df.Instructions {
+					if inst.Command != "ARG" && inst.Command != "ENV" {
+						continue
+					}
+					for _, pair := range inst.envPairs() {
+						if found := scanNamedValue(strings.ToLower(inst.Command), pair.Name, pair.Value); len(found) > 0 {
+							for _, m := range found {
+								matches = append(matches, DockerfileMatch{inst.Line, m.String()})
+							}
+							continue
+						}
+						key := strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(pair.Name))
+						if !secretNamePattern.MatchString(key) || strings.HasPrefix(pair.Value, "$") {
+							continue
+						}
+						switch {
+						case pair.HasValue && pair.Value != "":
+							matches = append(matches, DockerfileMatch{inst.Line, fmt.Sprintf("%s %s is set to %s", inst.Command, pair.Name, RedactSecret(pair.Value))})
+						case inst.Command == "ARG":
+							matches = append(matches, DockerfileMatch{inst.Line, fmt.Sprintf("ARG %s takes a secret as a build argument", pair.Name)})
+						}
+					}
+				}
+				return matches
+			},
+		},
+		DockerfileRule{
+			ID:          "dockerfile-apt-unpinned",
+			Family:      FamilyOperational,
+			Severity:    SeverityLow,
+			Title:       "apt-get install without version pinning",
+			Remediation: "Pin package versions (apt-get install package=version) so rebuilds are reproducible.",
+			Check: func(df *Dockerfile) []DockerfileMatch {
+				var matches []DockerfileMatch
+				for _, inst := range df.Instructions {
+					if inst.Command != "RUN" {
+						continue
+					}
+					if unpinned := unpinnedAptPackages(inst.runCommand()); len(unpinned) > 0 {
+						matches = append(matches, DockerfileMatch{inst.Line, "unpinned packages: " + strings.Join(unpinned, ", ")})
+					}
+				}
+				return matches
+			},
+		},
+		DockerfileRule{
+			ID:          "dockerfile-apt-cleanup",
+			Family:      FamilyOperational,
+			Severity:    SeverityLow,
+			Title:       "apt-get lists not cleaned up",
+			Remediation: "Remove /var/lib/apt/lists/* in the same RUN step as apt-get install so the package index is not kept in the layer.",
+			Check: func(df *Dockerfile) []DockerfileMatch {
+				var matches []DockerfileMatch
+				for _, inst := range df.Instructions {
+					if inst.Command != "RUN" {
+						continue
+					}
+					command := inst.runCommand()
+					if aptInstallPattern.MatchString(command) && !aptCleanupPattern.MatchString(command) {
+						matches = append(matches, DockerfileMatch{inst.Line, "apt-get install without rm -rf /var/lib/apt/lists/*"})
+					}
+				}
+				return matches
+			},
+		},
+		DockerfileRule{
+			ID:          "dockerfile-healthcheck-missing",
+			Family:      FamilyOperational,
+			Severity:    SeverityLow,
+			Title:       "No HEALTHCHECK instruction",
+			Remediation: "Add a HEALTHCHECK instruction to the final stage.",
+			Check: func(df *Dockerfile) []DockerfileMatch {
+				stage := df.finalStage()
+				if stage < 0 {
+					return nil
+				}
+				for _, inst := range df.StageInstructions(stage) {
+					if inst.Command == "HEALTHCHECK" {
+						if len(inst.Args) > 0 && strings.EqualFold(inst.Args[0], "NONE") {
+							return []DockerfileMatch{{inst.Line, "HEALTHCHECK NONE disables the health check"}}
+						}
+						return nil
+					}
+				}
+				return []DockerfileMatch{{df.Stages[stage].Line, "final stage has no HEALTHCHECK"}}
+			},
+		},
+	)
+}
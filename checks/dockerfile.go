@@ -0,0 +1,292 @@
+package checks
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Dockerfile is a parsed Dockerfile.
+type Dockerfile struct {
+	Path         string
+	Instructions []DockerfileInstruction
+	Stages       []DockerfileStage
+	GlobalArgs   map[string]string // ARG defaults declared before the first FROM
+}
+
+// DockerfileInstruction is one instruction, with continuation lines joined.
+type DockerfileInstruction struct {
+	Command  string   // upper-case instruction name, e.g. RUN
+	Flags    []string // --flag[=value] options written before the arguments
+	Args     []string // JSON array elements, or whitespace-separated words
+	Raw      string   // arguments as written, including heredoc bodies
+	JSONForm bool
+	Line     int // first line of the instruction
+	EndLine  int
+	Stage    int // index of the build stage, -1 before the first FROM
+}
+
+// DockerfileStage is a build stage started by FROM.
+type DockerfileStage struct {
+	Name  string
+	Image string
+	Line  int
+}
+
+// dockerfileFlags lists the options each instruction accepts.
+var dockerfileFlags = map[string][]string{
+	"FROM":        {"platform"},
+	"RUN":         {"mount", "network", "security"},
+	"COPY":        {"from", "chown", "chmod", "link", "parents", "exclude"},
+	"ADD":         {"chown", "chmod", "link", "checksum", "keep-git-dir", "exclude"},
+	"HEALTHCHECK": {"interval", "timeout", "start-period", "start-interval", "retries"},
+	"CMD":         nil,
+	"LABEL":       nil,
+	"MAINTAINER":  nil,
+	"EXPOSE":      nil,
+	"ENV":         nil,
+	"ENTRYPOINT":  nil,
+	"VOLUME":      nil,
+	"USER":        nil,
+	"WORKDIR":     nil,
+	"ARG":         nil,
+	"ONBUILD":     nil,
+	"STOPSIGNAL":  nil,
+	"SHELL":       nil,
+}
+
+var (
+	escapeDirective = regexp.MustCompile(`^#\s*escape\s*=\s*(\S)\s*$`)
+	heredocMarker   = regexp.MustCompile(`<<(-?)["']?([A-Za-z_][A-Za-z0-9_]*)["']?`)
+)
+
+// ParseDockerfileFile reads and parses the Dockerfile at path.
+func ParseDockerfileFile(path string) (*Dockerfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening Dockerfile %s: %v", path, err)
+	}
+	defer f.Close()
+
+	df, err := ParseDockerfile(f)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing Dockerfile %s: %v", path, err)
+	}
+	df.Path = path
+	return df, nil
+}
+
+// ParseDockerfile parses a Dockerfile, following the escape parser directive,
+// line continuations and heredocs the way BuildKit does. Instructions are
+// kept even when they are not valid, so that rules can report them.
+func ParseDockerfile(r io.Reader) (*Dockerfile, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	df := &Dockerfile{GlobalArgs: make(map[string]string)}
+	escape := `\`
+	directives := true
+	stage := -1
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(line, "#") {
+			if directives {
+				if m := escapeDirective.FindStringSubmatch(line); m != nil {
+					escape = m[1]
+				}
+			}
+			continue
+		}
+		directives = false
+		if line == "" {
+			continue
+		}
+
+		// Join continuation lines; comments and blank lines inside an
+		// instruction are dropped.
+		start := i
+		text := line
+		for strings.HasSuffix(text, escape) && i+1 < len(lines) {
+			text = strings.TrimSuffix(text, escape)
+			i++
+			next := strings.TrimSpace(lines[i])
+			for (next == "" || strings.HasPrefix(next, "#")) && i+1 < len(lines) {
+				i++
+				next = strings.TrimSpace(lines[i])
+			}
+			text += " " + next
+		}
+		text = strings.TrimSuffix(text, escape)
+
+		command, rest, _ := strings.Cut(text, " ")
+		inst := DockerfileInstruction{
+			Command: strings.ToUpper(command),
+			Line:    start + 1,
+		}
+
+		rest = strings.TrimSpace(rest)
+		for strings.HasPrefix(rest, "--") {
+			flag, remaining, _ := strings.Cut(rest, " ")
+			inst.Flags = append(inst.Flags, flag)
+			rest = strings.TrimSpace(remaining)
+		}
+
+		// Heredoc bodies follow the instruction line up to their terminator.
+		raw := rest
+		if inst.Command == "RUN" || inst.Command == "COPY" || inst.Command == "ADD" {
+			for _, loc := range heredocMarker.FindAllStringSubmatchIndex(rest, -1) {
+				if (loc[0] > 0 && rest[loc[0]-1] == '<') || strings.HasPrefix(rest[loc[0]:], "<<<") {
+					continue // a here-string, not a heredoc
+				}
+				stripTabs, terminator := loc[3] > loc[2], rest[loc[4]:loc[5]]
+				for i+1 < len(lines) {
+					i++
+					body := lines[i]
+					if stripTabs {
+						body = strings.TrimLeft(body, "\t")
+					}
+					if body == terminator {
+						break
+					}
+					raw += "\n" + body
+				}
+			}
+		}
+		inst.Raw = raw
+		inst.EndLine = i + 1
+
+		if strings.HasPrefix(rest, "[") {
+			var args []string
+			if err := json.Unmarshal([]byte(rest), &args); err == nil {
+				inst.Args = args
+				inst.JSONForm = true
+			}
+		}
+		if !inst.JSONForm {
+			inst.Args = strings.Fields(rest)
+		}
+
+		switch inst.Command {
+		case "FROM":
+			stage++
+			s := DockerfileStage{Line: inst.Line}
+			if len(inst.Args) > 0 {
+				s.Image = inst.Args[0]
+			}
+			if len(inst.Args) >= 3 && strings.EqualFold(inst.Args[1], "AS") {
+				s.Name = inst.Args[2]
+			}
+			df.Stages = append(df.Stages, s)
+		case "ARG":
+			if stage < 0 {
+				for _, arg := range inst.Args {
+					name, value, _ := strings.Cut(arg, "=")
+					df.GlobalArgs[name] = strings.Trim(value, `"'`)
+				}
+			}
+		}
+		inst.Stage = stage
+		df.Instructions = append(df.Instructions, inst)
+	}
+
+	return df, nil
+}
+
+// StageInstructions returns the instructions of a build stage.
+func (df *Dockerfile) StageInstructions(stage int) []DockerfileInstruction {
+	var instructions []DockerfileInstruction
+	for _, inst := range df.Instructions {
+		if inst.Stage == stage {
+			instructions = append(instructions, inst)
+		}
+	}
+	return instructions
+}
+
+// stageIndex returns the index of the stage with the given name, or -1.
+func (df *Dockerfile) stageIndex(name string) int {
+	for i, s := range df.Stages {
+		if s.Name != "" && strings.EqualFold(s.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// expandArgs substitutes the global ARG defaults into a FROM image reference.
+func (df *Dockerfile) expandArgs(value string) string {
+	return os.Expand(value, func(name string) string {
+		name, fallback, _ := strings.Cut(name, ":-")
+		if v, ok := df.GlobalArgs[name]; ok && v != "" {
+			return v
+		}
+		if fallback != "" {
+			return fallback
+		}
+		return "$" + name
+	})
+}
+
+// envPairs returns the variables set by an ENV or ARG instruction, in both
+// the KEY=value and the legacy "ENV KEY value" forms. hasValue is false for
+// an ARG without a default.
+func (inst DockerfileInstruction) envPairs() []envPair {
+	if inst.Command == "ENV" && len(inst.Args) >= 2 && !strings.Contains(inst.Args[0], "=") {
+		return []envPair{{Name: inst.Args[0], Value: strings.Join(inst.Args[1:], " "), HasValue: true}}
+	}
+
+	var pairs []envPair
+	for _, word := range splitQuoted(inst.Raw) {
+		name, value, hasValue := strings.Cut(word, "=")
+		pairs = append(pairs, envPair{Name: name, Value: strings.Trim(value, `"'`), HasValue: hasValue})
+	}
+	return pairs
+}
+
+type envPair struct {
+	Name     string
+	Value    string
+	HasValue bool
+}
+
+// splitQuoted splits on whitespace outside single or double quotes.
+func splitQuoted(s string) []string {
+	var words []string
+	var current strings.Builder
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			current.WriteRune(r)
+		case r == ' ' || r == '\t' || r == '\n':
+			if current.Len() > 0 {
+				words = append(words, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		words = append(words, current.String())
+	}
+	return words
+}
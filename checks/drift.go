@@ -0,0 +1,213 @@
+package checks
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DriftKind names a configuration change between two scans.
+type DriftKind string
+
+const (
+	DriftContainerAdded     DriftKind = "container-added"
+	DriftContainerRemoved   DriftKind = "container-removed"
+	DriftContainerRecreated DriftKind = "container-recreated"
+	DriftImageChanged       DriftKind = "image-changed"
+	DriftPrivilegedEnabled  DriftKind = "privileged-enabled"
+	DriftPrivilegedDisabled DriftKind = "privileged-disabled"
+	DriftCapabilityAdded    DriftKind = "capability-added"
+	DriftCapabilityRemoved  DriftKind = "capability-removed"
+	DriftSecurityOptAdded   DriftKind = "security-option-added"
+	DriftSecurityOptRemoved DriftKind = "security-option-removed"
+	DriftMountAdded         DriftKind = "mount-added"
+	DriftMountRemoved       DriftKind = "mount-removed"
+	DriftPortPublished      DriftKind = "port-published"
+	DriftPortUnpublished    DriftKind = "port-unpublished"
+	DriftRootfsWritable     DriftKind = "rootfs-writable"
+	DriftRootfsReadOnly     DriftKind = "rootfs-read-only"
+)
+
+// DriftEvent is one change to a container between two consecutive scans.
+// Severity rates how much the change weakens the container; changes that
+// harden it are info.
+type DriftEvent struct {
+	Kind        DriftKind `json:"kind"`
+	Severity    Severity  `json:"severity"`
+	Container   string    `json:"container"`
+	ContainerID string    `json:"containerId"`
+	Detail      string    `json:"detail"`
+	Before      string    `json:"before,omitempty"`
+	After       string    `json:"after,omitempty"`
+	FromScan    uint64    `json:"fromScan"`
+	ToScan      uint64    `json:"toScan"`
+	DetectedAt  time.Time `json:"detectedAt"`
+}
+
+// DiffScans compares two scans container by container. Containers are
+// matched by name, so a container recreated by compose or a deploy script is
+// compared with its predecessor.
+func DiffScans(previous, current *Scan) []DriftEvent {
+	var events []DriftEvent
+	emit := func(kind DriftKind, severity Severity, c ContainerInfo, detail, before, after string) {
+		events = append(events, DriftEvent{
+			Kind:        kind,
+			Severity:    severity,
+			Container:   strings.TrimPrefix(c.ContainerName, "/"),
+			ContainerID: c.ID,
+			Detail:      detail,
+			Before:      before,
+			After:       after,
+			FromScan:    previous.ID,
+			ToScan:      current.ID,
+			DetectedAt:  current.StartedAt,
+		})
+	}
+
+	before := make(map[string]ContainerInfo, len(previous.Containers))
+	for _, c := range previous.Containers {
+		before[c.ContainerName] = c
+	}
+	seen := make(map[string]bool, len(current.Containers))
+
+	for _, c := range current.Containers {
+		seen[c.ContainerName] = true
+		old, ok := before[c.ContainerName]
+		if !ok {
+			emit(DriftContainerAdded, SeverityInfo, c, fmt.Sprintf("Container appeared running %s", c.PrivilegedContainerImage), "", c.PrivilegedContainerImage)
+			continue
+		}
+
+		if old.ID != c.ID {
+			emit(DriftContainerRecreated, SeverityInfo, c, "Container was recreated", old.ID, c.ID)
+		}
+		if old.ImageID != c.ImageID {
+			emit(DriftImageChanged, SeverityLow, c, fmt.Sprintf("Image changed from %s to %s", shortImageID(old.ImageID), shortImageID(c.ImageID)), old.PrivilegedContainerImage, c.PrivilegedContainerImage)
+		}
+		if !old.PrivilegedContainer && c.PrivilegedContainer {
+			emit(DriftPrivilegedEnabled, SeverityCritical, c, "Privileged mode was enabled", "false", "true")
+		} else if old.PrivilegedContainer && !c.PrivilegedContainer {
+			emit(DriftPrivilegedDisabled, SeverityInfo, c, "Privileged mode was disabled", "true", "false")
+		}
+		if old.ReadOnlyRootFilesystem && !c.ReadOnlyRootFilesystem {
+			emit(DriftRootfsWritable, SeverityLow, c, "Root filesystem became writable", "read-only", "writable")
+		} else if !old.ReadOnlyRootFilesystem && c.ReadOnlyRootFilesystem {
+			emit(DriftRootfsReadOnly, SeverityInfo, c, "Root filesystem became read-only", "writable", "read-only")
+		}
+
+		// The effective sets also catch dropped capabilities. Scans stored
+		// before they were recorded only have the added ones, and a change
+		// of privileged mode is already reported above.
+		var added, removed []string
+		switch {
+		case old.Capabilities == nil:
+			added, removed = diffSets(old.AdvancedCapabilities, c.AdvancedCapabilities)
+		case old.PrivilegedContainer == c.PrivilegedContainer:
+			added, removed = diffSets(old.Capabilities, c.Capabilities)
+		}
+		for _, capability := range added {
+			severity := SeverityMedium
+			if score, ok := capabilityRiskScores[normalizeCapability(capability)]; ok {
+				severity = capabilitySeverity(score)
+			}
+			emit(DriftCapabilityAdded, severity, c, "Capability added: "+capability, "", capability)
+		}
+		for _, capability := range removed {
+			emit(DriftCapabilityRemoved, SeverityInfo, c, "Capability removed: "+capability, capability, "")
+		}
+
+		added, removed = diffSets(old.SecurityOptions, c.SecurityOptions)
+		for _, opt := range added {
+			severity := SeverityInfo
+			if isUnconfinedProfile(opt) {
+				severity = SeverityHigh
+			}
+			emit(DriftSecurityOptAdded, severity, c, "Security option added: "+opt, "", opt)
+		}
+		for _, opt := range removed {
+			emit(DriftSecurityOptRemoved, SeverityMedium, c, "Security option removed: "+opt, opt, "")
+		}
+
+		added, removed = diffSets(old.Mounts, c.Mounts)
+		for _, m := range added {
+			emit(DriftMountAdded, mountDriftSeverity(m), c, "Mount added: "+m, "", m)
+		}
+		for _, m := range removed {
+			emit(DriftMountRemoved, SeverityInfo, c, "Mount removed: "+m, m, "")
+		}
+
+		added, removed = diffSets(old.PublishedPorts, c.PublishedPorts)
+		for _, port := range added {
+			emit(DriftPortPublished, SeverityLow, c, "Port published: "+port, "", port)
+		}
+		for _, port := range removed {
+			emit(DriftPortUnpublished, SeverityInfo, c, "Port no longer published: "+port, port, "")
+		}
+	}
+
+	for _, c := range previous.Containers {
+		if !seen[c.ContainerName] {
+			emit(DriftContainerRemoved, SeverityInfo, c, "Container disappeared", c.PrivilegedContainerImage, "")
+		}
+	}
+	return events
+}
+
+// diffSets returns the elements only in b and the elements only in a.
+func diffSets(a, b []string) (added, removed []string) {
+	added, removed = difference(b, a), difference(a, b)
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// runtimeSockets are the API sockets that give control over the host's
+// container engine, and with it the host.
+var runtimeSockets = []string{"docker.sock", "containerd.sock", "podman.sock", "crio.sock"}
+
+// sensitiveHostPaths are host directories that expose the host's
+// configuration, kernel interfaces or other containers when mounted.
+var sensitiveHostPaths = map[string]bool{
+	"/":               true,
+	"/etc":            true,
+	"/proc":           true,
+	"/sys":            true,
+	"/boot":           true,
+	"/dev":            true,
+	"/root":           true,
+	"/run":            true,
+	"/var/run":        true,
+	"/var/lib/docker": true,
+	"/lib/modules":    true,
+}
+
+// mountDriftSeverity rates a new mount, described as "type source:target:mode".
+func mountDriftSeverity(m string) Severity {
+	kind, spec, _ := strings.Cut(m, " ")
+	if kind != "bind" {
+		return SeverityLow
+	}
+	source := strings.Split(spec, ":")[0]
+	for _, socket := range runtimeSockets {
+		if path.Base(source) == socket {
+			return SeverityCritical
+		}
+	}
+	if sensitiveHostPaths[path.Clean(source)] {
+		return SeverityHigh
+	}
+	return SeverityMedium
+}
+
+// PrintDriftEvents prints drift events, one per line.
+func PrintDriftEvents(events []DriftEvent) {
+	if len(events) == 0 {
+		fmt.Println("No configuration changes recorded.")
+		return
+	}
+	for _, e := range events {
+		fmt.Printf("%s  scan #%d  %s  [%s] %s: %s\n", e.DetectedAt.Format(time.RFC3339), e.ToScan, e.Container, e.Severity, e.Kind, e.Detail)
+	}
+}
@@ -0,0 +1,286 @@
+package checks
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/docker/docker/client"
+)
+
+// maxArchiveMetadataSize bounds the size of JSON entries kept in memory while
+// reading an image archive.
+const maxArchiveMetadataSize = 8 << 20
+
+// maxLayerFileSize bounds the size of a layer file read into memory for a visitor.
+const maxLayerFileSize = 256 << 20
+
+// ArchivedImage is one image found in a docker save tarball.
+type ArchivedImage struct {
+	ID       string          `json:"id"`
+	RepoTags []string        `json:"repoTags"`
+	Layers   []ArchivedLayer `json:"layers"`
+}
+
+// ArchivedLayer is a filesystem layer of an image, in build order.
+type ArchivedLayer struct {
+	Index       int    `json:"index"`
+	Digest      string `json:"digest"`
+	Instruction string `json:"instruction"`
+	path        string
+	whiteouts   []string
+}
+
+// layerVisitor receives the regular files of every layer in an archive that
+// it asks for. The layer is identified by its entry path inside the archive.
+type layerVisitor interface {
+	wantsFile(hdr *tar.Header) bool
+	visitFile(layer string, hdr *tar.Header, content []byte) error
+}
+
+// archiveManifest is an entry of the manifest.json written by docker save.
+type archiveManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// archiveConfig is the part of the image config used to label layers.
+type archiveConfig struct {
+	History []struct {
+		CreatedBy  string `json:"created_by"`
+		EmptyLayer bool   `json:"empty_layer"`
+	} `json:"history"`
+	RootFS struct {
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+// SaveImage streams an image from the daemon in docker save format.
+func SaveImage(cli *client.Client, imageID string) (io.ReadCloser, error) {
+	archive, err := cli.ImageSave(context.Background(), []string{imageID})
+	if err != nil {
+		return nil, fmt.Errorf("error saving image %s: %v", imageID, err)
+	}
+	return archive, nil
+}
+
+// readImageArchive walks a docker save tarball in a single pass, handing every
+// layer file to the visitors, and returns the images it describes with their
+// layers labelled by digest and the history instruction that created them.
+func readImageArchive(r io.Reader, visitors ...layerVisitor) ([]ArchivedImage, error) {
+	metadata := make(map[string][]byte)
+	whiteouts := make(map[string][]string)
+
+	outer := tar.NewReader(r)
+	for {
+		hdr, err := outer.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading image archive: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(hdr.Name)
+		entry := bufio.NewReaderSize(outer, 64<<10)
+		layer, isLayer, err := openLayer(entry)
+		if err != nil {
+			return nil, fmt.Errorf("error opening archive entry %s: %v", name, err)
+		}
+
+		if isLayer {
+			deleted, err := walkLayer(name, layer, visitors)
+			if err != nil {
+				return nil, err
+			}
+			whiteouts[name] = deleted
+			continue
+		}
+
+		if hdr.Size <= maxArchiveMetadataSize {
+			data, err := io.ReadAll(entry)
+			if err != nil {
+				return nil, fmt.Errorf("error reading archive entry %s: %v", name, err)
+			}
+			metadata[name] = data
+		}
+	}
+
+	return resolveArchivedImages(metadata, whiteouts)
+}
+
+// openLayer detects whether an archive entry is a (possibly gzip-compressed)
+// layer tarball and returns a reader over the uncompressed tar stream.
+func openLayer(entry *bufio.Reader) (*tar.Reader, bool, error) {
+	magic, _ := entry.Peek(2)
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(entry)
+		if err != nil {
+			return nil, false, err
+		}
+		return tar.NewReader(gz), true, nil
+	}
+
+	header, _ := entry.Peek(512)
+	if len(header) >= 262 && string(header[257:262]) == "ustar" {
+		return tar.NewReader(entry), true, nil
+	}
+	return nil, false, nil
+}
+
+// walkLayer visits the regular files of one layer and returns the paths its
+// whiteout files delete from lower layers. Opaque directories are returned
+// with a trailing slash.
+func walkLayer(layer string, tr *tar.Reader, visitors []layerVisitor) ([]string, error) {
+	var deleted []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return deleted, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading layer %s: %v", layer, err)
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		dir, base := path.Split(name)
+		if base == ".wh..wh..opq" {
+			deleted = append(deleted, dir)
+			continue
+		}
+		if strings.HasPrefix(base, ".wh.") {
+			deleted = append(deleted, dir+strings.TrimPrefix(base, ".wh."))
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		hdr.Name = name
+		var interested []layerVisitor
+		for _, v := range visitors {
+			if v.wantsFile(hdr) {
+				interested = append(interested, v)
+			}
+		}
+		if len(interested) == 0 || hdr.Size > maxLayerFileSize {
+			continue
+		}
+
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s in layer %s: %v", name, layer, err)
+		}
+		for _, v := range interested {
+			if err := v.visitFile(layer, hdr, content); err != nil {
+				return nil, fmt.Errorf("error scanning %s in layer %s: %v", name, layer, err)
+			}
+		}
+	}
+}
+
+// resolveArchivedImages reads manifest.json and the image configs to order
+// each image's layers and attach their digests and instructions.
+func resolveArchivedImages(metadata map[string][]byte, whiteouts map[string][]string) ([]ArchivedImage, error) {
+	raw, ok := metadata["manifest.json"]
+	if !ok {
+		return nil, fmt.Errorf("image archive has no manifest.json")
+	}
+
+	var manifests []archiveManifest
+	if err := json.Unmarshal(raw, &manifests); err != nil {
+		return nil, fmt.Errorf("error parsing manifest.json: %v", err)
+	}
+
+	var images []ArchivedImage
+	for _, m := range manifests {
+		var config archiveConfig
+		if data, ok := metadata[path.Clean(m.Config)]; ok {
+			if err := json.Unmarshal(data, &config); err != nil {
+				return nil, fmt.Errorf("error parsing image config %s: %v", m.Config, err)
+			}
+		}
+
+		var instructions []string
+		for _, h := range config.History {
+			if !h.EmptyLayer {
+				instructions = append(instructions, cleanHistoryInstruction(h.CreatedBy))
+			}
+		}
+
+		image := ArchivedImage{
+			ID:       "sha256:" + strings.TrimSuffix(path.Base(m.Config), ".json"),
+			RepoTags: m.RepoTags,
+		}
+		for i, layerPath := range m.Layers {
+			layerPath = path.Clean(layerPath)
+			layer := ArchivedLayer{
+				Index:     i,
+				Digest:    "sha256:" + path.Base(path.Dir(layerPath)),
+				path:      layerPath,
+				whiteouts: whiteouts[layerPath],
+			}
+			if strings.HasPrefix(layerPath, "blobs/") {
+				layer.Digest = "sha256:" + path.Base(layerPath)
+			}
+			if i < len(config.RootFS.DiffIDs) {
+				layer.Digest = config.RootFS.DiffIDs[i]
+			}
+			if i < len(instructions) {
+				layer.Instruction = instructions[i]
+			}
+			image.Layers = append(image.Layers, layer)
+		}
+		images = append(images, image)
+	}
+
+	return images, nil
+}
+
+// removedBy returns the first layer after index that deletes filePath, if any.
+func (img ArchivedImage) removedBy(index int, filePath string) (ArchivedLayer, bool) {
+	for _, layer := range img.Layers[index+1:] {
+		if layer.deletes(filePath) {
+			return layer, true
+		}
+	}
+	return ArchivedLayer{}, false
+}
+
+// deletes reports whether the layer's whiteouts remove filePath from the layers below.
+func (l ArchivedLayer) deletes(filePath string) bool {
+	for _, deleted := range l.whiteouts {
+		if filePath == deleted || strings.HasPrefix(filePath, deleted+"/") ||
+			(strings.HasSuffix(deleted, "/") && strings.HasPrefix(filePath, deleted)) {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanHistoryInstruction turns a history created_by entry into the Dockerfile
+// instruction that produced it.
+func cleanHistoryInstruction(createdBy string) string {
+	instruction := strings.TrimSpace(strings.TrimSuffix(createdBy, "# buildkit"))
+	if rest, ok := strings.CutPrefix(instruction, "/bin/sh -c #(nop) "); ok {
+		return strings.TrimSpace(rest)
+	}
+	if rest, ok := strings.CutPrefix(instruction, "/bin/sh -c "); ok {
+		return "RUN " + strings.TrimSpace(rest)
+	}
+	if rest, ok := strings.CutPrefix(instruction, "RUN /bin/sh -c "); ok {
+		return "RUN " + strings.TrimSpace(rest)
+	}
+	return instruction
+}
@@ -0,0 +1,232 @@
+package checks
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// maxSecretScanSize bounds the size of a file whose content is scanned for credentials.
+const maxSecretScanSize = 1 << 20
+
+// LayerFinding is a secret or sensitive file found in an image layer.
+type LayerFinding struct {
+	Path           string `json:"path"`
+	Kind           string `json:"kind"`
+	Detail         string `json:"detail"`
+	LayerIndex     int    `json:"layerIndex"`
+	LayerDigest    string `json:"layerDigest"`
+	Instruction    string `json:"instruction"`
+	RemovedInLayer string `json:"removedInLayer,omitempty"`
+}
+
+// sensitiveFileNames maps file names that should never ship in an image to a description.
+var sensitiveFileNames = map[string]string{
+	".env":             "dotenv file",
+	"id_rsa":           "SSH private key",
+	"id_dsa":           "SSH private key",
+	"id_ecdsa":         "SSH private key",
+	"id_ed25519":       "SSH private key",
+	".npmrc":           "npm credentials file",
+	".pypirc":          "PyPI credentials file",
+	".netrc":           "netrc credentials file",
+	".git-credentials": "git credentials file",
+	".pgpass":          "PostgreSQL password file",
+	".htpasswd":        "htpasswd file",
+}
+
+// sensitiveFilePaths maps path suffixes of credential files to a description.
+var sensitiveFilePaths = map[string]string{
+	".aws/credentials":    "AWS credentials file",
+	".docker/config.json": "Docker registry credentials",
+	".kube/config":        "Kubernetes kubeconfig",
+}
+
+// sensitiveExtensions maps key store extensions to a description.
+var sensitiveExtensions = map[string]string{
+	".p12": "PKCS#12 key store",
+	".pfx": "PKCS#12 key store",
+	".jks": "Java key store",
+}
+
+// secretScanExtensions lists text formats whose content is scanned for credentials.
+var secretScanExtensions = map[string]bool{
+	".env": true, ".ini": true, ".cfg": true, ".conf": true, ".properties": true,
+	".yaml": true, ".yml": true, ".json": true, ".toml": true, ".xml": true,
+	".sh": true, ".pem": true, ".key": true,
+}
+
+// secretScanSkipPrefixes lists system locations whose generic config files are
+// not content-scanned, since they belong to packages rather than the application.
+var secretScanSkipPrefixes = []string{"usr/share/", "usr/lib/", "usr/local/lib/", "etc/ssl/", "usr/include/"}
+
+// layerSecretScanner collects secrets and sensitive files per layer.
+type layerSecretScanner struct {
+	findings map[string][]LayerFinding
+}
+
+func newLayerSecretScanner() *layerSecretScanner {
+	return &layerSecretScanner{findings: make(map[string][]LayerFinding)}
+}
+
+func (s *layerSecretScanner) wantsFile(hdr *tar.Header) bool {
+	_, sensitive := sensitiveFileKind(hdr.Name)
+	return sensitive || shouldScanContent(hdr)
+}
+
+func (s *layerSecretScanner) visitFile(layer string, hdr *tar.Header, content []byte) error {
+	if kind, ok := sensitiveFileKind(hdr.Name); ok {
+		s.findings[layer] = append(s.findings[layer], LayerFinding{
+			Path:   hdr.Name,
+			Kind:   kind,
+			Detail: fmt.Sprintf("sensitive file (%d bytes)", hdr.Size),
+		})
+	}
+
+	if !shouldScanContent(hdr) {
+		return nil
+	}
+	for _, match := range scanFileContent(content) {
+		s.findings[layer] = append(s.findings[layer], LayerFinding{
+			Path:   hdr.Name,
+			Kind:   match.Kind,
+			Detail: fmt.Sprintf("%s %s", match.Name, match.Preview),
+		})
+	}
+	return nil
+}
+
+// resolve labels the image's findings with the layer that added each file and
+// the layer that later deleted it, if any.
+func (s *layerSecretScanner) resolve(img ArchivedImage) []LayerFinding {
+	var findings []LayerFinding
+	for _, layer := range img.Layers {
+		for _, finding := range s.findings[layer.path] {
+			finding.LayerIndex = layer.Index
+			finding.LayerDigest = layer.Digest
+			finding.Instruction = layer.Instruction
+			if removing, ok := img.removedBy(layer.Index, finding.Path); ok {
+				finding.RemovedInLayer = removing.Digest
+			}
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
+
+// sensitiveFileKind reports whether a path is a credential file or part of a git repository.
+func sensitiveFileKind(filePath string) (string, bool) {
+	base := path.Base(filePath)
+	if kind, ok := sensitiveFileNames[base]; ok {
+		return kind, true
+	}
+	if strings.HasPrefix(base, ".env.") {
+		return "dotenv file", true
+	}
+	for suffix, kind := range sensitiveFilePaths {
+		if filePath == suffix || strings.HasSuffix(filePath, "/"+suffix) {
+			return kind, true
+		}
+	}
+	if kind, ok := sensitiveExtensions[path.Ext(base)]; ok {
+		return kind, true
+	}
+	// Report a git repository once, through its HEAD file.
+	if base == "HEAD" && path.Base(path.Dir(filePath)) == ".git" {
+		return "git repository", true
+	}
+	return "", false
+}
+
+// shouldScanContent reports whether a file's content is scanned for credentials.
+func shouldScanContent(hdr *tar.Header) bool {
+	if hdr.Size == 0 || hdr.Size > maxSecretScanSize {
+		return false
+	}
+	base := path.Base(hdr.Name)
+	if _, ok := sensitiveFileNames[base]; ok {
+		return true
+	}
+	if strings.HasPrefix(base, ".env.") {
+		return true
+	}
+	if !secretScanExtensions[path.Ext(base)] {
+		return false
+	}
+	for _, prefix := range secretScanSkipPrefixes {
+		if strings.HasPrefix(hdr.Name, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// scanFileContent looks for credentials line by line, treating KEY=value and
+// key: value lines like environment variables.
+func scanFileContent(content []byte) []SecretMatch {
+	var matches []SecretMatch
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64<<10), maxSecretScanSize)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			name, value, ok = strings.Cut(line, ":")
+		}
+		position := fmt.Sprintf("line %d", lineNumber)
+		if ok {
+			name = strings.Trim(strings.TrimSpace(name), `"'`)
+			value = strings.Trim(strings.TrimSpace(value), `"',`)
+			position = fmt.Sprintf("line %d %s", lineNumber, name)
+		} else {
+			name, value = "", line
+		}
+
+		found := scanNamedValue("file", name, value)
+		if len(found) == 0 {
+			if kind, text := matchSecretValue(line); text != "" {
+				found = []SecretMatch{{Source: "file", Kind: kind, Preview: RedactSecret(text)}}
+			}
+		}
+		for _, match := range found {
+			match.Name = position
+			matches = append(matches, match)
+		}
+	}
+	return matches
+}
+
+// layerSecretFinding summarizes the secrets and sensitive files in an image's
+// layers as a finding. Files a later layer deleted are still reported, since
+// they can be recovered from the layer that added them.
+func layerSecretFinding(secrets []LayerFinding) (Finding, bool) {
+	if len(secrets) == 0 {
+		return Finding{}, false
+	}
+
+	finding := Finding{
+		RuleID:      "image-layer-secrets",
+		Family:      FamilySecurity,
+		Severity:    SeverityHigh,
+		Title:       fmt.Sprintf("Image layers contain %d secrets or sensitive files", len(secrets)),
+		Remediation: "Remove the files from the build context or use build secrets, rebuild the image and rotate the exposed credentials. Deleting a file in a later layer does not remove it from the image.",
+	}
+	for _, f := range secrets {
+		evidence := fmt.Sprintf("/%s: %s, %s (layer %d %s, added by: %s)", f.Path, f.Kind, f.Detail, f.LayerIndex, f.LayerDigest, f.Instruction)
+		if f.RemovedInLayer != "" {
+			evidence += fmt.Sprintf("; deleted in layer %s but still recoverable", f.RemovedInLayer)
+		}
+		finding.Evidence = append(finding.Evidence, evidence)
+	}
+	return finding, true
+}
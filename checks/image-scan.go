@@ -0,0 +1,189 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/docker/docker/client"
+)
+
+// ImageContentReport holds what was found by reading an image's layers.
+type ImageContentReport struct {
+	ImageID         string          `json:"imageId"`
+	RepoTags        []string        `json:"repoTags"`
+	Layers          []ArchivedLayer `json:"layers"`
+	OS              OSRelease       `json:"os"`
+	Packages        []Package       `json:"packages"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+	Secrets         []LayerFinding  `json:"secrets"`
+	SBOM            *SBOMReference  `json:"sbom,omitempty"`
+}
+
+// ScanImageArchive reads a docker save tarball and reports, for each image,
+// its OS release, installed packages and language dependencies, and the
+// secrets and sensitive files in its layers, including files that a later
+// layer deleted but that remain recoverable from the layer that added them.
+func ScanImageArchive(r io.Reader) ([]ImageContentReport, error) {
+	secrets := newLayerSecretScanner()
+	packages := newPackageCollector()
+	dependencies := newDependencyCataloger()
+
+	images, err := readImageArchive(r, secrets, packages, dependencies)
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []ImageContentReport
+	for _, img := range images {
+		report := ImageContentReport{
+			ImageID:  img.ID,
+			RepoTags: img.RepoTags,
+			Layers:   img.Layers,
+			Secrets:  secrets.resolve(img),
+		}
+		report.Packages, report.OS = packages.resolve(img)
+		report.Packages = append(report.Packages, dependencies.resolve(img)...)
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+// ScanImageContents saves an image from the daemon and scans its layers.
+func ScanImageContents(cli *client.Client, imageID string) (ImageContentReport, error) {
+	archive, err := SaveImage(cli, imageID)
+	if err != nil {
+		return ImageContentReport{}, err
+	}
+	defer archive.Close()
+
+	reports, err := ScanImageArchive(archive)
+	if err != nil {
+		return ImageContentReport{}, err
+	}
+	if len(reports) == 0 {
+		return ImageContentReport{}, fmt.Errorf("image archive for %s contains no images", imageID)
+	}
+	return reports[0], nil
+}
+
+// ImageScanner scans image contents and matches their packages against an
+// offline vulnerability feed. Images are content-addressed, so results are
+// cached by image ID until the image is no longer used. Failed scans are not
+// cached and are retried on the next scan.
+type ImageScanner struct {
+	cli     *client.Client
+	vulnDB  *VulnerabilityDB
+	sbomDir string
+
+	mu      sync.Mutex
+	results map[string]*ImageContentReport
+}
+
+// NewImageScanner creates an image scanner. vulnDB may be nil, in which case
+// packages are inventoried but not matched.
+func NewImageScanner(cli *client.Client, vulnDB *VulnerabilityDB) *ImageScanner {
+	return &ImageScanner{
+		cli:     cli,
+		vulnDB:  vulnDB,
+		results: make(map[string]*ImageContentReport),
+	}
+}
+
+// EnableSBOMs makes the scanner write CycloneDX and SPDX documents for every
+// scanned image into dir.
+func (s *ImageScanner) EnableSBOMs(dir string) {
+	s.sbomDir = dir
+}
+
+// Scan returns the content report for an image, scanning it on first use.
+func (s *ImageScanner) Scan(imageID string) (*ImageContentReport, error) {
+	s.mu.Lock()
+	if report, ok := s.results[imageID]; ok {
+		s.mu.Unlock()
+		return report, nil
+	}
+	s.mu.Unlock()
+
+	report, err := ScanImageContents(s.cli, imageID)
+	if err != nil {
+		return nil, err
+	}
+	report.Vulnerabilities = s.vulnDB.Match(report.Packages)
+	if s.sbomDir != "" {
+		report.SBOM = s.writeSBOMs(imageID, &report)
+	}
+
+	s.mu.Lock()
+	s.results[imageID] = &report
+	s.mu.Unlock()
+	return &report, nil
+}
+
+// writeSBOMs writes the SBOM documents for a scanned image. Failures are
+// logged so that the rest of the scan is still reported.
+func (s *ImageScanner) writeSBOMs(imageID string, report *ImageContentReport) *SBOMReference {
+	imageInspect, _, err := s.cli.ImageInspectWithRaw(context.Background(), imageID)
+	if err != nil {
+		log.Printf("Error inspecting image %s for SBOM: %v", imageID, err)
+		return nil
+	}
+	ref, err := WriteSBOMs(s.sbomDir, imageInspect, report)
+	if err != nil {
+		log.Printf("Error writing SBOM for image %s: %v", imageID, err)
+		return nil
+	}
+	return ref
+}
+
+// Forget drops the cached result for an image, e.g. after it was removed.
+func (s *ImageScanner) Forget(imageID string) {
+	s.mu.Lock()
+	delete(s.results, imageID)
+	s.mu.Unlock()
+}
+
+// Retain drops the cached results of every image not in imageIDs, so that
+// images removed from the host do not stay in memory.
+func (s *ImageScanner) Retain(imageIDs map[string]bool) {
+	s.mu.Lock()
+	for imageID := range s.results {
+		if !imageIDs[imageID] {
+			delete(s.results, imageID)
+		}
+	}
+	s.mu.Unlock()
+}
+
+// vulnerabilityFinding summarizes the vulnerabilities of a container's image
+// as a finding. Only critical and high vulnerabilities are listed as evidence.
+func vulnerabilityFinding(vulnerabilities []Vulnerability) (Finding, bool) {
+	if len(vulnerabilities) == 0 {
+		return Finding{}, false
+	}
+
+	finding := Finding{
+		RuleID:      "image-vulnerabilities",
+		Family:      FamilySecurity,
+		Severity:    clampToFamilyBand(FamilySecurity, vulnerabilities[0].Severity),
+		Title:       fmt.Sprintf("Image has %d known vulnerabilities", len(vulnerabilities)),
+		Remediation: "Rebuild the image on an updated base image or upgrade the affected packages.",
+	}
+	for _, v := range vulnerabilities {
+		if v.Severity < SeverityHigh {
+			break
+		}
+		evidence := fmt.Sprintf("%s [%s] %s %s", v.ID, v.Severity, v.Package, v.InstalledVersion)
+		if v.FixedVersion != "" {
+			evidence += ", fixed in " + v.FixedVersion
+		}
+		finding.Evidence = append(finding.Evidence, evidence)
+	}
+	if len(finding.Evidence) == 0 {
+		finding.Evidence = []string{fmt.Sprintf("Most severe vulnerability: %s [%s] in %s", vulnerabilities[0].ID, vulnerabilities[0].Severity, vulnerabilities[0].Package)}
+	}
+	return finding, true
+}
@@ -2,61 +2,346 @@ package checks
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/docker/docker/api/types"
 )
 
-// SecurityChecker defines the interface for checking security risks
-type SecurityChecker interface {
-	CheckForSecurityRisks(imageInspect types.ImageInspect)
+// ImageRule is a single check run against an image configuration. Check
+// returns the evidence for a finding, or nothing when the image passes.
+type ImageRule struct {
+	ID          string
+	Family      string
+	Severity    Severity
+	Title       string
+	Remediation string
+	Check       func(imageInspect *types.ImageInspect) []string
 }
 
-// CheckForSecurityRisks analyzes the image configuration for potential security issues
-func CheckForSecurityRisks(imageInspect types.ImageInspect) {
-	// Check if the image is running as root
-	if imageInspect.Config.User == "" || imageInspect.Config.User == "root" {
-		fmt.Println("Warning: Image is running as root. This can be a security risk.")
+// imageRules is the registry of rules evaluated for every image.
+var imageRules []ImageRule
+
+// registerImageRules adds rules to the registry.
+func registerImageRules(rules ...ImageRule) {
+	imageRules = append(imageRules, rules...)
+}
+
+// ImageRules returns the registered image rules.
+func ImageRules() []ImageRule {
+	return imageRules
+}
+
+// largeImageSize is the size above which an image is reported as large.
+const largeImageSize = 500 * 1024 * 1024
+
+// EvaluateImage runs every registered image rule and returns the findings,
+// most severe first.
+func EvaluateImage(imageInspect types.ImageInspect) []Finding {
+	if imageInspect.Config == nil {
+		return nil
 	}
 
-	// Check the base image's Python version for known vulnerabilities
-	for _, envVar := range imageInspect.Config.Env {
-		if envVarContains(envVar, "PYTHON_VERSION") {
-			fmt.Printf("Python Version: %s\n", envVar)
-			checkPythonVersionSecurity(envVar)
+	var findings []Finding
+	for _, rule := range imageRules {
+		evidence := rule.Check(&imageInspect)
+		if len(evidence) == 0 {
+			continue
 		}
+		findings = append(findings, Finding{
+			RuleID:      rule.ID,
+			Family:      rule.Family,
+			Severity:    clampToFamilyBand(rule.Family, rule.Severity),
+			Title:       rule.Title,
+			Evidence:    evidence,
+			Remediation: rule.Remediation,
+		})
 	}
 
-	// List all environment variables
-	fmt.Println("Environment Variables:")
-	for _, envVar := range imageInspect.Config.Env {
-		fmt.Printf("- %s\n", envVar)
+	sortFindings(findings)
+	return findings
+}
+
+// containerOverriddenImageRules lists the image rules for settings a
+// container inherits and can override. The container rules report the
+// effective setting, so these are left out when checking a container.
+var containerOverriddenImageRules = map[string]bool{
+	"image-root-user":           true,
+	"image-healthcheck-missing": true,
+	"image-secrets-in-config":   true,
+}
+
+// EvaluateContainerImage runs the image rules that apply to a running
+// container's image.
+func EvaluateContainerImage(imageInspect types.ImageInspect) []Finding {
+	var findings []Finding
+	for _, f := range EvaluateImage(imageInspect) {
+		if !containerOverriddenImageRules[f.RuleID] {
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// PrintImageFindings prints the findings for an image.
+func PrintImageFindings(imageInspect types.ImageInspect, findings []Finding) {
+	if len(findings) == 0 {
+		fmt.Printf("No configuration issues found for image %s.\n", imageInspect.ID)
+		return
+	}
+
+	fmt.Printf("Configuration issues for image %s %v:\n", imageInspect.ID, imageInspect.RepoTags)
+	for _, f := range findings {
+		fmt.Printf("- [%s] %s (%s)\n", f.Severity, f.Title, f.RuleID)
+		for _, e := range f.Evidence {
+			fmt.Printf("    %s\n", e)
+		}
+		fmt.Printf("  Recommendation: %s\n", f.Remediation)
 	}
+}
+
+// runtimeVersionPolicy is the oldest supported release line of a language
+// runtime, identified by the version variable official images set.
+type runtimeVersionPolicy struct {
+	EnvVar   string
+	Language string
+	Minimum  []int
+}
+
+// runtimeVersionPolicies lists the oldest release lines still receiving
+// security fixes. Update it as upstream support windows move.
+var runtimeVersionPolicies = []runtimeVersionPolicy{
+	{"PYTHON_VERSION", "Python", []int{3, 10}},
+	{"NODE_VERSION", "Node.js", []int{22}},
+	{"GOLANG_VERSION", "Go", []int{1, 26}},
+	{"JAVA_VERSION", "Java", []int{11}},
+	{"RUBY_VERSION", "Ruby", []int{3, 3}},
+}
 
-	// Check for exposed ports
-	if len(imageInspect.Config.ExposedPorts) > 0 {
-		fmt.Println("Warning: Exposed ports detected. Ensure they are necessary and secure.")
+func init() {
+	registerImageRules(
+		ImageRule{
+			ID:          "image-root-user",
+			Family:      FamilySecurity,
+			Severity:    SeverityHigh,
+			Title:       "Image runs as root by default",
+			Remediation: "Add a USER instruction with an unprivileged user to the Dockerfile.",
+			Check: func(img *types.ImageInspect) []string {
+				if isRootUser(img.Config.User) {
+					return []string{fmt.Sprintf("Config.User is %q", img.Config.User)}
+				}
+				return nil
+			},
+		},
+		ImageRule{
+			ID:          "image-exposed-ports",
+			Family:      FamilySecurity,
+			Severity:    SeverityLow,
+			Title:       "Image exposes ports",
+			Remediation: "Expose only the ports the service needs and make sure each one is secured.",
+			Check: func(img *types.ImageInspect) []string {
+				var ports []string
+				for port := range img.Config.ExposedPorts {
+					ports = append(ports, string(port))
+				}
+				if len(ports) == 0 {
+					return nil
+				}
+				sort.Strings(ports)
+				return []string{"Config.ExposedPorts: " + strings.Join(ports, ", ")}
+			},
+		},
+		ImageRule{
+			ID:          "image-size",
+			Family:      FamilySecurity,
+			Severity:    SeverityLow,
+			Title:       "Image is large",
+			Remediation: "Use a smaller base image or a multi-stage build to reduce the attack surface.",
+			Check: func(img *types.ImageInspect) []string {
+				if img.Size > largeImageSize {
+					return []string{fmt.Sprintf("Image size is %d MB", img.Size/(1024*1024))}
+				}
+				return nil
+			},
+		},
+		ImageRule{
+			ID:          "image-onbuild",
+			Family:      FamilySecurity,
+			Severity:    SeverityMedium,
+			Title:       "Image has ONBUILD triggers",
+			Remediation: "Remove ONBUILD instructions so images built FROM this one only run instructions their own Dockerfile declares.",
+			Check: func(img *types.ImageInspect) []string {
+				var evidence []string
+				for _, trigger := range img.Config.OnBuild {
+					evidence = append(evidence, "ONBUILD "+trigger)
+				}
+				return evidence
+			},
+		},
+		ImageRule{
+			ID:          "image-volumes",
+			Family:      FamilySecurity,
+			Severity:    SeverityLow,
+			Title:       "Image declares writable volumes",
+			Remediation: "Remove VOLUME instructions and mount volumes explicitly at run time; declared volumes stay writable even with --read-only.",
+			Check: func(img *types.ImageInspect) []string {
+				var volumes []string
+				for volume := range img.Config.Volumes {
+					volumes = append(volumes, volume)
+				}
+				if len(volumes) == 0 {
+					return nil
+				}
+				sort.Strings(volumes)
+				return []string{"Config.Volumes: " + strings.Join(volumes, ", ")}
+			},
+		},
+		ImageRule{
+			ID:          "image-secrets-in-config",
+			Family:      FamilySecurity,
+			Severity:    SeverityHigh,
+			Title:       "Credentials exposed in image configuration",
+			Remediation: "Remove credentials from ENV, LABEL and command instructions; pass them at run time as secrets.",
+			Check: func(img *types.ImageInspect) []string {
+				var evidence []string
+				for _, match := range ScanImageSecrets(*img) {
+					evidence = append(evidence, match.String())
+				}
+				return evidence
+			},
+		},
+		ImageRule{
+			ID:          "image-runtime-version",
+			Family:      FamilySecurity,
+			Severity:    SeverityMedium,
+			Title:       "Image ships an unsupported language runtime",
+			Remediation: "Rebuild on a base image with a supported runtime release.",
+			Check: func(img *types.ImageInspect) []string {
+				var evidence []string
+				for _, envVar := range img.Config.Env {
+					name, value, _ := strings.Cut(envVar, "=")
+					for _, policy := range runtimeVersionPolicies {
+						if name != policy.EnvVar {
+							continue
+						}
+						version := parseRuntimeVersion(policy.EnvVar, value)
+						if version != nil && compareVersions(version, policy.Minimum) < 0 {
+							evidence = append(evidence, fmt.Sprintf("%s %s is older than the oldest supported release %s", policy.Language, value, formatVersion(policy.Minimum)))
+						}
+					}
+				}
+				return evidence
+			},
+		},
+		ImageRule{
+			ID:          "image-healthcheck-missing",
+			Family:      FamilyOperational,
+			Severity:    SeverityLow,
+			Title:       "Image has no HEALTHCHECK",
+			Remediation: "Add a HEALTHCHECK instruction to the Dockerfile.",
+			Check: func(img *types.ImageInspect) []string {
+				hc := img.Config.Healthcheck
+				if hc == nil || len(hc.Test) == 0 || hc.Test[0] == "NONE" {
+					return []string{"Config.Healthcheck is not set"}
+				}
+				return nil
+			},
+		},
+		ImageRule{
+			ID:          "image-shell-entrypoint",
+			Family:      FamilyOperational,
+			Severity:    SeverityLow,
+			Title:       "Image uses a shell-form entrypoint",
+			Remediation: "Use the exec form (ENTRYPOINT [\"binary\", \"arg\"]) so the process runs as PID 1 and receives signals.",
+			Check: func(img *types.ImageInspect) []string {
+				command := img.Config.Entrypoint
+				field := "Entrypoint"
+				if len(command) == 0 {
+					command, field = img.Config.Cmd, "Cmd"
+				}
+				if isShellForm(command) {
+					return []string{fmt.Sprintf("Config.%s is %q", field, strings.Join(command, " "))}
+				}
+				return nil
+			},
+		},
+	)
+}
+
+// isShellForm reports whether a command was written in shell form, which
+// Docker stores wrapped in "/bin/sh -c".
+func isShellForm(command []string) bool {
+	if len(command) < 2 {
+		return false
 	}
+	switch command[0] {
+	case "/bin/sh", "sh", "/bin/bash", "bash", "/bin/ash":
+		return command[1] == "-c"
+	case "cmd", "cmd.exe":
+		return strings.EqualFold(command[1], "/S") || strings.EqualFold(command[1], "/C")
+	}
+	return false
+}
 
-	// Suggest running the container as a non-root user if not already
-	if imageInspect.Config.User == "" || imageInspect.Config.User == "root" {
-		fmt.Println("Recommendation: Consider configuring the container to run as a non-root user.")
+// parseRuntimeVersion extracts the numeric release from a runtime version
+// variable, e.g. "3.10.4" or "jdk-17.0.8+7". Legacy Java versions such as
+// "1.8.0_292" and "8u312" are normalized to their major release.
+func parseRuntimeVersion(envVar, value string) []int {
+	value = strings.TrimLeft(strings.ToLower(value), "abcdefghijklmnopqrstuvwxyz-")
+	version := parseVersion(value)
+	if envVar == "JAVA_VERSION" && len(version) >= 2 && version[0] == 1 {
+		return version[1:2]
 	}
+	return version
+}
 
-	// Suggest using a minimal base image if the size is large
-	if imageInspect.Size > 500*1024*1024 { // 500MB threshold for example
-		fmt.Println("Recommendation: Consider using a smaller base image to reduce the attack surface.")
+// parseVersion reads the leading dot-separated numeric components of a version string.
+func parseVersion(value string) []int {
+	var version []int
+	for _, part := range strings.Split(value, ".") {
+		digits := part
+		if end := strings.IndexFunc(part, func(r rune) bool { return r < '0' || r > '9' }); end >= 0 {
+			digits = part[:end]
+		}
+		n, err := strconv.Atoi(digits)
+		if err != nil {
+			break
+		}
+		version = append(version, n)
+		if len(digits) != len(part) {
+			break
+		}
 	}
+	return version
 }
 
-// envVarContains checks if an environment variable contains a specific key
-func envVarContains(envVar, key string) bool {
-	return len(envVar) > len(key) && envVar[:len(key)] == key
+// compareVersions compares numeric versions component by component, treating
+// missing components as zero.
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
 }
 
-// checkPythonVersionSecurity checks for security issues in the Python version
-func checkPythonVersionSecurity(pythonVersion string) {
-	version := pythonVersion[len("PYTHON_VERSION="):]
-	if version < "3.8" { // Arbitrary version check, update based on actual vulnerabilities
-		fmt.Printf("Warning: Python version %s may have known vulnerabilities. Consider updating.\n", version)
+// formatVersion joins numeric version components with dots.
+func formatVersion(version []int) string {
+	parts := make([]string, len(version))
+	for i, n := range version {
+		parts[i] = strconv.Itoa(n)
 	}
+	return strings.Join(parts, ".")
 }
@@ -0,0 +1,601 @@
+package checks
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-connections/nat"
+	"github.com/docker/go-units"
+	"gopkg.in/yaml.v3"
+)
+
+// kubernetesWorkloadKinds are the kinds whose pods are analyzed.
+var kubernetesWorkloadKinds = map[string]bool{
+	"Pod":         true,
+	"Deployment":  true,
+	"StatefulSet": true,
+	"DaemonSet":   true,
+	"ReplicaSet":  true,
+	"Job":         true,
+	"CronJob":     true,
+}
+
+// kubernetesIgnoredRules are container rules whose settings have no
+// equivalent in a pod spec: the process limit is a kubelet setting and
+// Kubernetes has no --init.
+var kubernetesIgnoredRules = map[string]bool{
+	"pids-limit":   true,
+	"init-process": true,
+}
+
+// kubernetesNonRootUser is recorded as Config.User for containers that set
+// runAsNonRoot without a runAsUser. The kubelet refuses to start them as UID 0.
+const kubernetesNonRootUser = "nonroot"
+
+// KubernetesWorkload is a workload from a manifest with its containers
+// mapped onto the container model the container rules evaluate.
+type KubernetesWorkload struct {
+	File        string
+	Kind        string
+	Name        string
+	Namespace   string
+	Line        int
+	Containers  []KubernetesContainer
+	PodSecurity PodSecurityResult
+}
+
+// KubernetesContainer is one container of a pod, including init containers.
+type KubernetesContainer struct {
+	Name      string
+	Init      bool
+	Line      int
+	Runtime   string
+	Container types.ContainerJSON
+}
+
+// KubernetesFinding is a finding for a container of a workload.
+type KubernetesFinding struct {
+	Finding
+	Container string `json:"container"`
+	Line      int    `json:"line"`
+}
+
+// KubernetesReport is the result of evaluating one workload.
+type KubernetesReport struct {
+	File        string              `json:"file"`
+	Kind        string              `json:"kind"`
+	Namespace   string              `json:"namespace"`
+	Name        string              `json:"name"`
+	Line        int                 `json:"line"`
+	PodSecurity PodSecurityResult   `json:"podSecurity"`
+	Findings    []KubernetesFinding `json:"findings"`
+}
+
+type k8sMetadata struct {
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+type k8sPodTemplate struct {
+	Metadata k8sMetadata `yaml:"metadata"`
+	Spec     k8sPodSpec  `yaml:"spec"`
+}
+
+// k8sObject holds the pod spec of any supported kind: a Pod's spec is the
+// pod spec itself, controllers embed a template, and a CronJob embeds a job.
+type k8sObject struct {
+	Kind     string      `yaml:"kind"`
+	Metadata k8sMetadata `yaml:"metadata"`
+	Items    []yaml.Node `yaml:"items"`
+	Spec     struct {
+		k8sPodSpec  `yaml:",inline"`
+		Template    *k8sPodTemplate `yaml:"template"`
+		JobTemplate *struct {
+			Spec struct {
+				Template k8sPodTemplate `yaml:"template"`
+			} `yaml:"spec"`
+		} `yaml:"jobTemplate"`
+	} `yaml:"spec"`
+}
+
+type k8sPodSpec struct {
+	HostNetwork         bool                   `yaml:"hostNetwork"`
+	HostPID             bool                   `yaml:"hostPID"`
+	HostIPC             bool                   `yaml:"hostIPC"`
+	RuntimeClassName    string                 `yaml:"runtimeClassName"`
+	SecurityContext     *k8sPodSecurityContext `yaml:"securityContext"`
+	Containers          []k8sContainer         `yaml:"containers"`
+	InitContainers      []k8sContainer         `yaml:"initContainers"`
+	EphemeralContainers []k8sContainer         `yaml:"ephemeralContainers"`
+	Volumes             []k8sVolume            `yaml:"volumes"`
+}
+
+type k8sPodSecurityContext struct {
+	RunAsUser       *int64             `yaml:"runAsUser"`
+	RunAsGroup      *int64             `yaml:"runAsGroup"`
+	RunAsNonRoot    *bool              `yaml:"runAsNonRoot"`
+	SeccompProfile  *k8sProfile        `yaml:"seccompProfile"`
+	AppArmorProfile *k8sProfile        `yaml:"appArmorProfile"`
+	SELinuxOptions  *k8sSELinuxOptions `yaml:"seLinuxOptions"`
+	WindowsOptions  *k8sWindowsOptions `yaml:"windowsOptions"`
+	Sysctls         []struct {
+		Name string `yaml:"name"`
+	} `yaml:"sysctls"`
+}
+
+type k8sSecurityContext struct {
+	Privileged               *bool              `yaml:"privileged"`
+	RunAsUser                *int64             `yaml:"runAsUser"`
+	RunAsGroup               *int64             `yaml:"runAsGroup"`
+	RunAsNonRoot             *bool              `yaml:"runAsNonRoot"`
+	AllowPrivilegeEscalation *bool              `yaml:"allowPrivilegeEscalation"`
+	ReadOnlyRootFilesystem   *bool              `yaml:"readOnlyRootFilesystem"`
+	ProcMount                string             `yaml:"procMount"`
+	SeccompProfile           *k8sProfile        `yaml:"seccompProfile"`
+	AppArmorProfile          *k8sProfile        `yaml:"appArmorProfile"`
+	SELinuxOptions           *k8sSELinuxOptions `yaml:"seLinuxOptions"`
+	WindowsOptions           *k8sWindowsOptions `yaml:"windowsOptions"`
+	Capabilities             *struct {
+		Add  []string `yaml:"add"`
+		Drop []string `yaml:"drop"`
+	} `yaml:"capabilities"`
+}
+
+// k8sProfile is a seccomp or AppArmor profile.
+type k8sProfile struct {
+	Type             string `yaml:"type"`
+	LocalhostProfile string `yaml:"localhostProfile"`
+}
+
+type k8sSELinuxOptions struct {
+	User  string `yaml:"user"`
+	Role  string `yaml:"role"`
+	Type  string `yaml:"type"`
+	Level string `yaml:"level"`
+}
+
+type k8sWindowsOptions struct {
+	HostProcess *bool `yaml:"hostProcess"`
+}
+
+type k8sContainer struct {
+	Name    string   `yaml:"name"`
+	Image   string   `yaml:"image"`
+	Command []string `yaml:"command"`
+	Args    []string `yaml:"args"`
+	Env     []struct {
+		Name      string     `yaml:"name"`
+		Value     string     `yaml:"value"`
+		ValueFrom *yaml.Node `yaml:"valueFrom"`
+	} `yaml:"env"`
+	Ports []struct {
+		ContainerPort int    `yaml:"containerPort"`
+		HostPort      int    `yaml:"hostPort"`
+		HostIP        string `yaml:"hostIP"`
+		Protocol      string `yaml:"protocol"`
+	} `yaml:"ports"`
+	VolumeMounts []struct {
+		Name      string `yaml:"name"`
+		MountPath string `yaml:"mountPath"`
+		ReadOnly  bool   `yaml:"readOnly"`
+	} `yaml:"volumeMounts"`
+	Resources struct {
+		Limits struct {
+			Memory k8sQuantity `yaml:"memory"`
+		} `yaml:"limits"`
+	} `yaml:"resources"`
+	LivenessProbe   *k8sProbe           `yaml:"livenessProbe"`
+	SecurityContext *k8sSecurityContext `yaml:"securityContext"`
+	Line            int                 `yaml:"-"`
+}
+
+// UnmarshalYAML records the line the container starts on.
+func (c *k8sContainer) UnmarshalYAML(node *yaml.Node) error {
+	type plain k8sContainer
+	if err := node.Decode((*plain)(c)); err != nil {
+		return err
+	}
+	c.Line = node.Line
+	return nil
+}
+
+type k8sProbe struct {
+	Exec *struct {
+		Command []string `yaml:"command"`
+	} `yaml:"exec"`
+	HTTPGet *struct {
+		Path string        `yaml:"path"`
+		Port composeScalar `yaml:"port"`
+	} `yaml:"httpGet"`
+	TCPSocket *struct {
+		Port composeScalar `yaml:"port"`
+	} `yaml:"tcpSocket"`
+	GRPC *struct {
+		Port int `yaml:"port"`
+	} `yaml:"grpc"`
+	PeriodSeconds    int `yaml:"periodSeconds"`
+	TimeoutSeconds   int `yaml:"timeoutSeconds"`
+	FailureThreshold int `yaml:"failureThreshold"`
+}
+
+// k8sVolume is a pod volume. Types lists the volume source keys set on it.
+type k8sVolume struct {
+	Name     string
+	Types    []string
+	HostPath string
+	Medium   string
+}
+
+func (v *k8sVolume) UnmarshalYAML(node *yaml.Node) error {
+	var fields struct {
+		Name     string `yaml:"name"`
+		HostPath *struct {
+			Path string `yaml:"path"`
+		} `yaml:"hostPath"`
+		EmptyDir *struct {
+			Medium string `yaml:"medium"`
+		} `yaml:"emptyDir"`
+	}
+	if err := node.Decode(&fields); err != nil {
+		return err
+	}
+	v.Name = fields.Name
+	if fields.HostPath != nil {
+		v.HostPath = fields.HostPath.Path
+	}
+	if fields.EmptyDir != nil {
+		v.Medium = fields.EmptyDir.Medium
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if key := node.Content[i].Value; key != "name" {
+			v.Types = append(v.Types, key)
+		}
+	}
+	return nil
+}
+
+// k8sQuantity is a resource quantity such as "512Mi" or "1G", in bytes.
+type k8sQuantity int64
+
+func (q *k8sQuantity) UnmarshalYAML(node *yaml.Node) error {
+	var n int64
+	var err error
+	if strings.HasSuffix(node.Value, "i") {
+		n, err = units.RAMInBytes(node.Value + "B") // "Mi" is spelled "MiB" here
+	} else {
+		n, err = units.FromHumanSize(node.Value)
+	}
+	if err != nil {
+		return fmt.Errorf("line %d: invalid quantity %q", node.Line, node.Value)
+	}
+	*q = k8sQuantity(n)
+	return nil
+}
+
+// KubernetesOptions describes the cluster the manifests are deployed to.
+type KubernetesOptions struct {
+	// SeccompDefault is set when the kubelet runs with seccompDefault, so
+	// containers without a seccompProfile get RuntimeDefault. Otherwise,
+	// as on a default kubelet, they run Unconfined.
+	SeccompDefault bool
+}
+
+// LoadKubernetesFile reads the workloads from a manifest file, which may hold
+// several YAML documents and List objects. Other kinds are skipped.
+func LoadKubernetesFile(path string, opts KubernetesOptions) ([]KubernetesWorkload, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var workloads []KubernetesWorkload
+	decoder := yaml.NewDecoder(f)
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing manifest %s: %v", path, err)
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		found, err := kubernetesWorkloads(path, doc.Content[0], opts)
+		if err != nil {
+			return nil, fmt.Errorf("error in manifest %s: %v", path, err)
+		}
+		workloads = append(workloads, found...)
+	}
+	return workloads, nil
+}
+
+// kubernetesWorkloads decodes one object, descending into List items.
+func kubernetesWorkloads(path string, node *yaml.Node, opts KubernetesOptions) ([]KubernetesWorkload, error) {
+	var object k8sObject
+	if err := node.Decode(&object); err != nil {
+		return nil, err
+	}
+
+	if strings.HasSuffix(object.Kind, "List") {
+		var workloads []KubernetesWorkload
+		for i := range object.Items {
+			found, err := kubernetesWorkloads(path, &object.Items[i], opts)
+			if err != nil {
+				return nil, err
+			}
+			workloads = append(workloads, found...)
+		}
+		return workloads, nil
+	}
+	if !kubernetesWorkloadKinds[object.Kind] {
+		return nil, nil
+	}
+
+	podMetadata, podSpec := object.Metadata, object.Spec.k8sPodSpec
+	switch {
+	case object.Kind == "CronJob" && object.Spec.JobTemplate != nil:
+		template := object.Spec.JobTemplate.Spec.Template
+		podMetadata, podSpec = template.Metadata, template.Spec
+	case object.Kind != "Pod" && object.Spec.Template != nil:
+		podMetadata, podSpec = object.Spec.Template.Metadata, object.Spec.Template.Spec
+	}
+
+	workload := KubernetesWorkload{
+		File:        path,
+		Kind:        object.Kind,
+		Name:        object.Metadata.Name,
+		Namespace:   object.Metadata.Namespace,
+		Line:        node.Line,
+		PodSecurity: evaluatePodSecurity(podMetadata, podSpec),
+	}
+	if workload.Namespace == "" {
+		workload.Namespace = "default"
+	}
+
+	for i, list := range [][]k8sContainer{podSpec.InitContainers, podSpec.Containers} {
+		for _, c := range list {
+			kc, err := podSpec.toContainer(podMetadata, c, i == 0, opts)
+			if err != nil {
+				return nil, fmt.Errorf("container %s of %s %s: %v", c.Name, object.Kind, object.Metadata.Name, err)
+			}
+			workload.Containers = append(workload.Containers, kc)
+		}
+	}
+	return []KubernetesWorkload{workload}, nil
+}
+
+// toContainer builds the HostConfig and Config of a container the way the
+// kubelet would configure it. Container security context fields override
+// the pod's.
+func (spec k8sPodSpec) toContainer(metadata k8sMetadata, c k8sContainer, init bool, opts KubernetesOptions) (KubernetesContainer, error) {
+	podSC := spec.SecurityContext
+	if podSC == nil {
+		podSC = &k8sPodSecurityContext{}
+	}
+	sc := c.SecurityContext
+	if sc == nil {
+		sc = &k8sSecurityContext{}
+	}
+
+	hostConfig := &container.HostConfig{
+		Runtime: spec.RuntimeClassName,
+	}
+	if spec.HostNetwork {
+		hostConfig.NetworkMode = "host"
+	}
+	if spec.HostPID {
+		hostConfig.PidMode = "host"
+	}
+	if spec.HostIPC {
+		hostConfig.IpcMode = "host"
+	}
+	hostConfig.Privileged = sc.Privileged != nil && *sc.Privileged
+	hostConfig.ReadonlyRootfs = sc.ReadOnlyRootFilesystem != nil && *sc.ReadOnlyRootFilesystem
+	if sc.Capabilities != nil {
+		hostConfig.CapAdd = sc.Capabilities.Add
+		hostConfig.CapDrop = sc.Capabilities.Drop
+	}
+	// allowPrivilegeEscalation defaults to true unless the container is
+	// privileged or lacks CAP_SYS_ADMIN, which cannot be known here.
+	if sc.AllowPrivilegeEscalation != nil && !*sc.AllowPrivilegeEscalation {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "no-new-privileges:true")
+	}
+	seccomp := sc.SeccompProfile
+	if seccomp == nil {
+		seccomp = podSC.SeccompProfile
+	}
+	if seccomp == nil && !opts.SeccompDefault {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "seccomp=unconfined")
+	}
+	if seccomp != nil {
+		switch seccomp.Type {
+		case "Unconfined":
+			hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "seccomp=unconfined")
+		case "Localhost":
+			hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "seccomp="+seccomp.LocalhostProfile)
+		}
+	}
+	if appArmorType(metadata, podSC, sc, c.Name) == "Unconfined" {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "apparmor=unconfined")
+	}
+	hostConfig.Memory = int64(c.Resources.Limits.Memory)
+
+	volumes := make(map[string]k8sVolume)
+	for _, v := range spec.Volumes {
+		volumes[v.Name] = v
+	}
+	for _, vm := range c.VolumeMounts {
+		m := mount.Mount{Type: mount.TypeVolume, Source: vm.Name, Target: vm.MountPath, ReadOnly: vm.ReadOnly}
+		if v, ok := volumes[vm.Name]; ok {
+			switch {
+			case v.HostPath != "":
+				m.Type, m.Source = mount.TypeBind, v.HostPath
+			case v.Medium == "Memory":
+				m.Type, m.Source = mount.TypeTmpfs, ""
+			}
+		}
+		hostConfig.Mounts = append(hostConfig.Mounts, m)
+	}
+
+	var portSpecs []string
+	for _, p := range c.Ports {
+		portSpec := strconv.Itoa(p.ContainerPort)
+		if p.HostPort != 0 {
+			portSpec = strconv.Itoa(p.HostPort) + ":" + portSpec
+			if p.HostIP != "" {
+				portSpec = p.HostIP + ":" + portSpec
+			}
+		}
+		if p.Protocol != "" {
+			portSpec += "/" + strings.ToLower(p.Protocol)
+		}
+		portSpecs = append(portSpecs, portSpec)
+	}
+	exposedPorts, portBindings, err := nat.ParsePortSpecs(portSpecs)
+	if err != nil {
+		return KubernetesContainer{}, fmt.Errorf("invalid ports: %v", err)
+	}
+	hostConfig.PortBindings = portBindings
+
+	config := &container.Config{
+		Image:        c.Image,
+		User:         kubernetesUser(podSC, sc),
+		Entrypoint:   c.Command,
+		Cmd:          c.Args,
+		ExposedPorts: exposedPorts,
+	}
+	for _, e := range c.Env {
+		// Values from secrets and config maps are not part of the manifest.
+		if e.ValueFrom != nil {
+			config.Env = append(config.Env, e.Name)
+		} else {
+			config.Env = append(config.Env, e.Name+"="+e.Value)
+		}
+	}
+	if probe := c.LivenessProbe; probe != nil {
+		config.Healthcheck = &container.HealthConfig{
+			Test:     probe.test(),
+			Interval: time.Duration(probe.PeriodSeconds) * time.Second,
+			Timeout:  time.Duration(probe.TimeoutSeconds) * time.Second,
+			Retries:  probe.FailureThreshold,
+		}
+	}
+
+	return KubernetesContainer{
+		Name:    c.Name,
+		Init:    init,
+		Line:    c.Line,
+		Runtime: spec.RuntimeClassName,
+		Container: types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				Name:       "/" + c.Name,
+				HostConfig: hostConfig,
+			},
+			Config: config,
+		},
+	}, nil
+}
+
+// kubernetesUser returns the Config.User equivalent of the security contexts.
+// An empty user means the image's user, which may be root.
+func kubernetesUser(podSC *k8sPodSecurityContext, sc *k8sSecurityContext) string {
+	uid, gid, nonRoot := podSC.RunAsUser, podSC.RunAsGroup, podSC.RunAsNonRoot
+	if sc.RunAsUser != nil {
+		uid = sc.RunAsUser
+	}
+	if sc.RunAsGroup != nil {
+		gid = sc.RunAsGroup
+	}
+	if sc.RunAsNonRoot != nil {
+		nonRoot = sc.RunAsNonRoot
+	}
+
+	switch {
+	case uid != nil && gid != nil:
+		return fmt.Sprintf("%d:%d", *uid, *gid)
+	case uid != nil:
+		return strconv.FormatInt(*uid, 10)
+	case nonRoot != nil && *nonRoot:
+		return kubernetesNonRootUser
+	}
+	return ""
+}
+
+// test describes the probe as a healthcheck test. Probes other than exec
+// are run by the kubelet, so they are recorded as a description.
+func (p *k8sProbe) test() []string {
+	switch {
+	case p.Exec != nil:
+		return append([]string{"CMD"}, p.Exec.Command...)
+	case p.HTTPGet != nil:
+		return []string{"CMD-SHELL", fmt.Sprintf("httpGet :%s%s", p.HTTPGet.Port, p.HTTPGet.Path)}
+	case p.TCPSocket != nil:
+		return []string{"CMD-SHELL", fmt.Sprintf("tcpSocket :%s", p.TCPSocket.Port)}
+	case p.GRPC != nil:
+		return []string{"CMD-SHELL", fmt.Sprintf("grpc :%d", p.GRPC.Port)}
+	}
+	return nil
+}
+
+// EvaluateKubernetesWorkload runs the container rules against every
+// container of a workload. Runtimes are classified by RuntimeClass name.
+func EvaluateKubernetesWorkload(workload KubernetesWorkload) KubernetesReport {
+	report := KubernetesReport{
+		File:        workload.File,
+		Kind:        workload.Kind,
+		Namespace:   workload.Namespace,
+		Name:        workload.Name,
+		Line:        workload.Line,
+		PodSecurity: workload.PodSecurity,
+		Findings:    []KubernetesFinding{},
+	}
+	for _, c := range workload.Containers {
+		rc := &RuleContext{
+			Container: c.Container,
+			Runtime:   DaemonRuntimes{}.Resolve(c.Runtime),
+		}
+		for _, f := range EvaluateContainer(rc) {
+			if kubernetesIgnoredRules[f.RuleID] {
+				continue
+			}
+			report.Findings = append(report.Findings, KubernetesFinding{
+				Finding:   f,
+				Container: c.Name,
+				Line:      c.Line,
+			})
+		}
+	}
+	return report
+}
+
+// PrintKubernetesReport prints the Pod Security Standards level and the
+// findings of a workload.
+func PrintKubernetesReport(report KubernetesReport) {
+	fmt.Printf("%s:%d: %s %s/%s: Pod Security Standards level %s\n", report.File, report.Line, report.Kind, report.Namespace, report.Name, report.PodSecurity.Level)
+	for _, v := range report.PodSecurity.BaselineViolations {
+		fmt.Printf("    baseline: %s\n", v)
+	}
+	for _, v := range report.PodSecurity.RestrictedViolations {
+		fmt.Printf("    restricted: %s\n", v)
+	}
+
+	for _, f := range report.Findings {
+		fmt.Printf("%s:%d: container %s: [%s] %s (%s)\n", report.File, f.Line, f.Container, f.Severity, f.Title, f.RuleID)
+		for _, e := range f.Evidence {
+			fmt.Printf("    %s\n", e)
+		}
+		fmt.Printf("  Recommendation: %s\n", f.Remediation)
+	}
+}
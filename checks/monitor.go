@@ -0,0 +1,273 @@
+package checks
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+const (
+	// monitorDebounce groups the burst of events a single docker command
+	// emits, such as create, connect and start, into one re-check.
+	monitorDebounce = 250 * time.Millisecond
+	// eventRetryDelay is how long the monitor waits before subscribing again
+	// after the event stream fails, for example while the daemon restarts.
+	eventRetryDelay = 5 * time.Second
+)
+
+// Monitor keeps the checks of every container up to date. A full scan runs
+// at start and at every reconciliation; in between, Docker events re-check
+// only the containers they concern.
+type Monitor struct {
+	cli               *client.Client
+	imageScanner      *ImageScanner
+	signatureVerifier *SignatureVerifier
+
+	daemon     DaemonInfo
+	runtimes   DaemonRuntimes
+	containers []ContainerInfo
+	requests   chan chan error
+}
+
+// NewMonitor returns a monitor for the containers of a Docker daemon.
+func NewMonitor(cli *client.Client, imageScanner *ImageScanner, signatureVerifier *SignatureVerifier) *Monitor {
+	return &Monitor{cli: cli, imageScanner: imageScanner, signatureVerifier: signatureVerifier, requests: make(chan chan error)}
+}
+
+// Rescan asks the running monitor for a full scan and waits until it has
+// been published, or until ctx is done.
+func (m *Monitor) Rescan(ctx context.Context) error {
+	reply := make(chan error, 1)
+	select {
+	case m.requests <- reply:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run publishes a scan at start, after every full reconciliation and after
+// each burst of events that changed a container; the latter are marked
+// partial. It returns when ctx is done.
+func (m *Monitor) Run(ctx context.Context, reconcileInterval time.Duration, publish func(*Scan)) {
+	messages, errs := m.subscribe(ctx)
+	m.reconcile(publish)
+
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
+
+	pending := make(map[string]bool)
+	var debounce, retry <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			m.reconcile(publish)
+			pending = make(map[string]bool)
+
+		case reply := <-m.requests:
+			reply <- m.reconcile(publish)
+			pending = make(map[string]bool)
+
+		case msg := <-messages:
+			m.forgetImage(msg)
+			for _, id := range m.affectedContainers(msg) {
+				pending[id] = true
+			}
+			if len(pending) > 0 && debounce == nil {
+				debounce = time.After(monitorDebounce)
+			}
+
+		case <-debounce:
+			debounce = nil
+			if len(pending) > 0 {
+				m.refresh(pending, publish)
+				pending = make(map[string]bool)
+			}
+
+		case err := <-errs:
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Error reading Docker events, retrying in %s: %v", eventRetryDelay, err)
+			messages, errs = nil, nil
+			retry = time.After(eventRetryDelay)
+
+		case <-retry:
+			// Events missed while disconnected are caught up by a full scan.
+			retry = nil
+			messages, errs = m.subscribe(ctx)
+			m.reconcile(publish)
+		}
+	}
+}
+
+// subscribe streams the events that can change the checks of a container.
+func (m *Monitor) subscribe(ctx context.Context) (<-chan events.Message, <-chan error) {
+	args := filters.NewArgs(
+		filters.Arg("type", string(events.ContainerEventType)),
+		filters.Arg("type", string(events.NetworkEventType)),
+		filters.Arg("type", string(events.ImageEventType)),
+	)
+	for _, action := range []events.Action{
+		events.ActionCreate, events.ActionStart, events.ActionUpdate, events.ActionRename, events.ActionDie, events.ActionDestroy,
+		events.ActionConnect, events.ActionDisconnect,
+		events.ActionPull, events.ActionTag, events.ActionUnTag, events.ActionDelete,
+	} {
+		args.Add("event", string(action))
+	}
+	return m.cli.Events(ctx, events.ListOptions{Filters: args})
+}
+
+// forgetImage drops the cached content report of an image that was removed
+// or untagged, since its repo tags changed or it no longer exists.
+func (m *Monitor) forgetImage(msg events.Message) {
+	if m.imageScanner == nil || msg.Type != events.ImageEventType {
+		return
+	}
+	if msg.Action == events.ActionDelete || msg.Action == events.ActionUnTag {
+		m.imageScanner.Forget(msg.Actor.ID)
+	}
+}
+
+// affectedContainers returns the short IDs of the containers an event concerns.
+func (m *Monitor) affectedContainers(msg events.Message) []string {
+	switch msg.Type {
+	case events.ContainerEventType:
+		return []string{shortContainerID(msg.Actor.ID)}
+	case events.NetworkEventType:
+		if id := msg.Actor.Attributes["container"]; id != "" {
+			return []string{shortContainerID(id)}
+		}
+	case events.ImageEventType:
+		// A pull or tag can move the reference a container was started from,
+		// which the image staleness check compares against.
+		var ids []string
+		for _, c := range m.containers {
+			if c.ImageID == msg.Actor.ID || sameImageReference(c.PrivilegedContainerImage, msg.Actor.ID) ||
+				sameImageReference(c.PrivilegedContainerImage, msg.Actor.Attributes["name"]) {
+				ids = append(ids, c.ID)
+			}
+		}
+		return ids
+	}
+	return nil
+}
+
+// reconcile replaces the monitored state with a full scan.
+func (m *Monitor) reconcile(publish func(*Scan)) error {
+	scan, err := RunScan(m.cli, m.imageScanner, m.signatureVerifier)
+	if err != nil {
+		log.Printf("Error checking containers: %v", err)
+		return err
+	}
+	if runtimes, err := GetDaemonRuntimes(m.cli); err != nil {
+		log.Printf("Error reading daemon runtimes: %v", err)
+	} else {
+		m.runtimes = runtimes
+	}
+	m.daemon = scan.Daemon
+	m.containers = scan.Containers
+	publish(m.snapshot(scan.StartedAt))
+	return nil
+}
+
+// refresh re-checks the given containers, dropping those that no longer exist.
+func (m *Monitor) refresh(ids map[string]bool, publish func(*Scan)) {
+	startedAt := time.Now()
+	for id := range ids {
+		listed, err := m.cli.ContainerList(context.Background(), container.ListOptions{
+			All:     true,
+			Filters: filters.NewArgs(filters.Arg("id", id)),
+		})
+		if err != nil {
+			log.Printf("Error listing container %s: %v", id, err)
+			continue
+		}
+		if len(listed) == 0 {
+			m.remove(id)
+			continue
+		}
+		info, err := CheckContainer(m.cli, listed[0], m.runtimes, m.imageScanner, m.signatureVerifier)
+		if err != nil {
+			if client.IsErrNotFound(err) {
+				m.remove(id)
+			} else {
+				log.Printf("Error checking container %s: %v", id, err)
+			}
+			continue
+		}
+		m.update(info)
+	}
+	scan := m.snapshot(startedAt)
+	scan.Partial = true
+	publish(scan)
+}
+
+// update replaces the state of a container, or adds it first, as the
+// daemon lists the newest containers first.
+func (m *Monitor) update(info ContainerInfo) {
+	for i, c := range m.containers {
+		if c.ID == info.ID {
+			m.containers[i] = info
+			return
+		}
+	}
+	m.containers = append([]ContainerInfo{info}, m.containers...)
+}
+
+func (m *Monitor) remove(id string) {
+	for i, c := range m.containers {
+		if c.ID == id {
+			m.containers = append(m.containers[:i:i], m.containers[i+1:]...)
+			return
+		}
+	}
+}
+
+// snapshot returns the monitored state as a scan that started at startedAt.
+func (m *Monitor) snapshot(startedAt time.Time) *Scan {
+	return &Scan{
+		StartedAt:  startedAt,
+		Duration:   time.Since(startedAt),
+		Daemon:     m.daemon,
+		Containers: append([]ContainerInfo(nil), m.containers...),
+	}
+}
+
+func shortContainerID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// sameImageReference reports whether two image references name the same
+// tag, treating a reference without a tag or digest as ":latest".
+func sameImageReference(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	return withDefaultTag(a) == withDefaultTag(b)
+}
+
+func withDefaultTag(reference string) string {
+	name := reference[strings.LastIndex(reference, "/")+1:]
+	if strings.ContainsAny(name, ":@") {
+		return reference
+	}
+	return reference + ":latest"
+}
@@ -0,0 +1,84 @@
+package checks
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Operational hygiene rules. They do not make a container exploitable on
+// their own, so they report in the operational band below security findings.
+func init() {
+	registerContainerRules(
+		ContainerRule{
+			ID:          "healthcheck-missing",
+			Family:      FamilyOperational,
+			Severity:    SeverityLow,
+			Title:       "No healthcheck configured",
+			Remediation: "Add a HEALTHCHECK to the image or start the container with --health-cmd.",
+			Check: func(rc *RuleContext) []string {
+				hc := rc.Container.Config.Healthcheck
+				if hc == nil || len(hc.Test) == 0 {
+					return []string{"Config.Healthcheck is not set"}
+				}
+				if hc.Test[0] == "NONE" {
+					return []string{"Config.Healthcheck is disabled with NONE"}
+				}
+				return nil
+			},
+		},
+		ContainerRule{
+			ID:          "logging-disabled",
+			Family:      FamilyOperational,
+			Severity:    SeverityMedium,
+			Title:       "Container logging is disabled",
+			Remediation: "Use a logging driver other than none so container output can be audited.",
+			Check: func(rc *RuleContext) []string {
+				if rc.Container.HostConfig.LogConfig.Type == "none" {
+					return []string{"HostConfig.LogConfig.Type is none"}
+				}
+				return nil
+			},
+		},
+		ContainerRule{
+			ID:          "log-rotation",
+			Family:      FamilyOperational,
+			Severity:    SeverityLow,
+			Title:       "Container logs are not rotated",
+			Remediation: "Set --log-opt max-size and --log-opt max-file, or use the local logging driver.",
+			Check: func(rc *RuleContext) []string {
+				logConfig := rc.Container.HostConfig.LogConfig
+				if logConfig.Type != "json-file" {
+					return nil
+				}
+
+				var missing []string
+				for _, opt := range []string{"max-size", "max-file"} {
+					if logConfig.Config[opt] == "" {
+						missing = append(missing, opt)
+					}
+				}
+				if len(missing) > 0 {
+					return []string{fmt.Sprintf("json-file logging without %s", strings.Join(missing, ", "))}
+				}
+				return nil
+			},
+		},
+		ContainerRule{
+			ID:          "init-process",
+			Family:      FamilyOperational,
+			Severity:    SeverityLow,
+			Title:       "No init process to reap zombies",
+			Remediation: "Start the container with --init so PID 1 forwards signals and reaps zombie processes.",
+			Check: func(rc *RuleContext) []string {
+				useInit := rc.Container.HostConfig.Init
+				if useInit == nil {
+					return []string{"HostConfig.Init is not set; the daemon default applies"}
+				}
+				if !*useInit {
+					return []string{"HostConfig.Init is false"}
+				}
+				return nil
+			},
+		},
+	)
+}
@@ -0,0 +1,298 @@
+package checks
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// Package types for the OS package databases read from image layers.
+const (
+	PackageTypeAPK = "apk"
+	PackageTypeDeb = "deb"
+	PackageTypeRPM = "rpm"
+)
+
+// Package is an installed package or language dependency found in an image.
+type Package struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Source    string `json:"source,omitempty"`
+	Arch      string `json:"arch,omitempty"`
+	Type      string `json:"type"`
+	Ecosystem string `json:"ecosystem"`
+	Location  string `json:"location,omitempty"`
+}
+
+// OSRelease is the distribution information from an image's os-release file.
+type OSRelease struct {
+	ID              string `json:"id"`
+	IDLike          string `json:"idLike,omitempty"`
+	VersionID       string `json:"versionId"`
+	VersionCodename string `json:"versionCodename,omitempty"`
+	PrettyName      string `json:"prettyName"`
+}
+
+// Paths of the package databases and release files, relative to the image root.
+const (
+	apkDatabasePath  = "lib/apk/db/installed"
+	dpkgStatusPath   = "var/lib/dpkg/status"
+	dpkgStatusDir    = "var/lib/dpkg/status.d/"
+	rpmDatabasePath  = "var/lib/rpm/rpmdb.sqlite"
+	osReleasePath    = "etc/os-release"
+	usrOSReleasePath = "usr/lib/os-release"
+)
+
+// packageCollector records the package databases and os-release files per layer.
+type packageCollector struct {
+	packages  map[string]map[string][]Package // layer -> database path -> packages
+	osRelease map[string]map[string]OSRelease // layer -> release file path -> release
+}
+
+func newPackageCollector() *packageCollector {
+	return &packageCollector{
+		packages:  make(map[string]map[string][]Package),
+		osRelease: make(map[string]map[string]OSRelease),
+	}
+}
+
+func (c *packageCollector) wantsFile(hdr *tar.Header) bool {
+	switch hdr.Name {
+	case apkDatabasePath, dpkgStatusPath, rpmDatabasePath, osReleasePath, usrOSReleasePath:
+		return true
+	}
+	return strings.HasPrefix(hdr.Name, dpkgStatusDir)
+}
+
+func (c *packageCollector) visitFile(layer string, hdr *tar.Header, content []byte) error {
+	if hdr.Name == osReleasePath || hdr.Name == usrOSReleasePath {
+		if c.osRelease[layer] == nil {
+			c.osRelease[layer] = make(map[string]OSRelease)
+		}
+		c.osRelease[layer][hdr.Name] = parseOSRelease(content)
+		return nil
+	}
+
+	var packages []Package
+	switch {
+	case hdr.Name == apkDatabasePath:
+		packages = parseAPKDatabase(content)
+	case hdr.Name == dpkgStatusPath || strings.HasPrefix(hdr.Name, dpkgStatusDir):
+		packages = parseDpkgStatus(content)
+	case hdr.Name == rpmDatabasePath:
+		parsed, err := parseRPMDatabase(content)
+		if err != nil {
+			// A database we cannot read leaves the inventory incomplete but
+			// should not abort the rest of the image scan.
+			return nil
+		}
+		packages = parsed
+	}
+
+	if c.packages[layer] == nil {
+		c.packages[layer] = make(map[string][]Package)
+	}
+	c.packages[layer][hdr.Name] = packages
+	return nil
+}
+
+// resolve returns the packages and release visible in the image's final
+// filesystem: for each database path, the copy in the topmost layer that was
+// not deleted by a later layer.
+func (c *packageCollector) resolve(img ArchivedImage) ([]Package, OSRelease) {
+	databases := make(map[string][]Package)
+	releases := make(map[string]OSRelease)
+
+	for _, layer := range img.Layers {
+		// A whiteout in this layer hides files from the layers below it.
+		for dbPath := range databases {
+			if layer.deletes(dbPath) {
+				delete(databases, dbPath)
+			}
+		}
+		for dbPath, packages := range c.packages[layer.path] {
+			databases[dbPath] = packages
+		}
+		for releasePath, release := range c.osRelease[layer.path] {
+			releases[releasePath] = release
+		}
+	}
+
+	release, ok := releases[osReleasePath]
+	if !ok {
+		release = releases[usrOSReleasePath]
+	}
+
+	var packages []Package
+	for _, dbPackages := range databases {
+		for _, pkg := range dbPackages {
+			pkg.Ecosystem = packageEcosystem(pkg.Type, release)
+			packages = append(packages, pkg)
+		}
+	}
+	sort.Slice(packages, func(i, j int) bool {
+		if packages[i].Name != packages[j].Name {
+			return packages[i].Name < packages[j].Name
+		}
+		return packages[i].Version < packages[j].Version
+	})
+	return packages, release
+}
+
+// rpmEcosystems maps os-release IDs of RPM-based distributions to OSV ecosystems.
+var rpmEcosystems = map[string]string{
+	"rhel":      "Red Hat",
+	"rocky":     "Rocky Linux",
+	"almalinux": "AlmaLinux",
+	"opensuse":  "openSUSE",
+	"sles":      "SUSE",
+	"mageia":    "Mageia",
+	"photon":    "Photon OS",
+	"fedora":    "Fedora",
+	"centos":    "CentOS",
+	"ol":        "Oracle Linux",
+	"amzn":      "Amazon Linux",
+}
+
+// packageEcosystem returns the OSV ecosystem of an OS package, including the
+// distribution release when it is known, e.g. "Alpine:v3.18" or "Debian:12".
+func packageEcosystem(packageType string, release OSRelease) string {
+	var base string
+	switch packageType {
+	case PackageTypeAPK:
+		base = "Alpine"
+		if release.ID == "wolfi" {
+			return "Wolfi"
+		}
+		if parts := strings.SplitN(release.VersionID, ".", 3); len(parts) >= 2 {
+			return base + ":v" + parts[0] + "." + parts[1]
+		}
+		return base
+	case PackageTypeDeb:
+		base = "Debian"
+		if release.ID == "ubuntu" {
+			base = "Ubuntu"
+		}
+	case PackageTypeRPM:
+		base = rpmEcosystems[release.ID]
+		if base == "" {
+			base = "Red Hat"
+		}
+	default:
+		return ""
+	}
+
+	if release.VersionID != "" {
+		return base + ":" + release.VersionID
+	}
+	return base
+}
+
+// parseOSRelease reads the KEY=value pairs of an os-release file.
+func parseOSRelease(content []byte) OSRelease {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		values[key] = strings.Trim(value, `"'`)
+	}
+	return OSRelease{
+		ID:              values["ID"],
+		IDLike:          values["ID_LIKE"],
+		VersionID:       values["VERSION_ID"],
+		VersionCodename: values["VERSION_CODENAME"],
+		PrettyName:      values["PRETTY_NAME"],
+	}
+}
+
+// parseAPKDatabase reads the installed database of apk-tools.
+func parseAPKDatabase(content []byte) []Package {
+	var packages []Package
+	var current Package
+	flush := func() {
+		if current.Name != "" && current.Version != "" {
+			current.Type = PackageTypeAPK
+			packages = append(packages, current)
+		}
+		current = Package{}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		if len(line) < 2 || line[1] != ':' {
+			continue
+		}
+		value := line[2:]
+		switch line[0] {
+		case 'P':
+			current.Name = value
+		case 'V':
+			current.Version = value
+		case 'A':
+			current.Arch = value
+		case 'o':
+			current.Source = value
+		}
+	}
+	flush()
+	return packages
+}
+
+// parseDpkgStatus reads a dpkg status file, keeping installed packages only.
+func parseDpkgStatus(content []byte) []Package {
+	var packages []Package
+	var current Package
+	installed := true
+	flush := func() {
+		if current.Name != "" && current.Version != "" && installed {
+			current.Type = PackageTypeDeb
+			packages = append(packages, current)
+		}
+		current = Package{}
+		installed = true
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Package":
+			current.Name = value
+		case "Version":
+			current.Version = value
+		case "Architecture":
+			current.Arch = value
+		case "Source":
+			// "Source: name (version)" when the source version differs
+			current.Source = strings.TrimSpace(strings.SplitN(value, " ", 2)[0])
+		case "Status":
+			installed = strings.HasSuffix(value, " installed")
+		}
+	}
+	flush()
+	return packages
+}
@@ -0,0 +1,285 @@
+package checks
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PodSecurityLevel is a Kubernetes Pod Security Standards profile.
+type PodSecurityLevel string
+
+const (
+	PodSecurityPrivileged PodSecurityLevel = "privileged"
+	PodSecurityBaseline   PodSecurityLevel = "baseline"
+	PodSecurityRestricted PodSecurityLevel = "restricted"
+)
+
+// podSecurityLevels orders the levels from least to most restrictive.
+var podSecurityLevels = []PodSecurityLevel{PodSecurityPrivileged, PodSecurityBaseline, PodSecurityRestricted}
+
+// ParsePodSecurityLevel converts a level name into a PodSecurityLevel.
+func ParsePodSecurityLevel(name string) (PodSecurityLevel, error) {
+	for _, level := range podSecurityLevels {
+		if strings.EqualFold(string(level), strings.TrimSpace(name)) {
+			return level, nil
+		}
+	}
+	return "", fmt.Errorf("unknown Pod Security Standards level %q", name)
+}
+
+// AtLeast reports whether the level is as restrictive as other.
+func (l PodSecurityLevel) AtLeast(other PodSecurityLevel) bool {
+	return l.rank() >= other.rank()
+}
+
+func (l PodSecurityLevel) rank() int {
+	for i, level := range podSecurityLevels {
+		if level == l {
+			return i
+		}
+	}
+	return -1
+}
+
+// PodSecurityResult is the most restrictive Pod Security Standards level a
+// pod satisfies, with the controls that keep it from the stricter levels.
+type PodSecurityResult struct {
+	Level                PodSecurityLevel `json:"level"`
+	BaselineViolations   []string         `json:"baselineViolations,omitempty"`
+	RestrictedViolations []string         `json:"restrictedViolations,omitempty"`
+}
+
+// baselineCapabilities are the capabilities the baseline level allows adding.
+var baselineCapabilities = map[string]bool{
+	"AUDIT_WRITE":      true,
+	"CHOWN":            true,
+	"DAC_OVERRIDE":     true,
+	"FOWNER":           true,
+	"FSETID":           true,
+	"KILL":             true,
+	"MKNOD":            true,
+	"NET_BIND_SERVICE": true,
+	"SETFCAP":          true,
+	"SETGID":           true,
+	"SETPCAP":          true,
+	"SETUID":           true,
+	"SYS_CHROOT":       true,
+}
+
+// safeSysctls are the namespaced sysctls the baseline level allows.
+var safeSysctls = map[string]bool{
+	"kernel.shm_rmid_forced":              true,
+	"net.ipv4.ip_local_port_range":        true,
+	"net.ipv4.ip_unprivileged_port_start": true,
+	"net.ipv4.tcp_syncookies":             true,
+	"net.ipv4.ping_group_range":           true,
+	"net.ipv4.ip_local_reserved_ports":    true,
+	"net.ipv4.tcp_keepalive_time":         true,
+	"net.ipv4.tcp_fin_timeout":            true,
+	"net.ipv4.tcp_keepalive_intvl":        true,
+	"net.ipv4.tcp_keepalive_probes":       true,
+}
+
+// baselineSELinuxTypes are the SELinux types the baseline level allows.
+var baselineSELinuxTypes = map[string]bool{
+	"":                   true,
+	"container_t":        true,
+	"container_init_t":   true,
+	"container_kvm_t":    true,
+	"container_engine_t": true,
+}
+
+// restrictedVolumeTypes are the volume sources the restricted level allows.
+var restrictedVolumeTypes = map[string]bool{
+	"configMap":             true,
+	"csi":                   true,
+	"downwardAPI":           true,
+	"emptyDir":              true,
+	"ephemeral":             true,
+	"persistentVolumeClaim": true,
+	"projected":             true,
+	"secret":                true,
+}
+
+// appArmorAnnotationPrefix is the legacy per-container AppArmor annotation.
+const appArmorAnnotationPrefix = "container.apparmor.security.beta.kubernetes.io/"
+
+// appArmorType returns the AppArmor profile type of a container from its
+// security context, the pod's, or the legacy annotation.
+func appArmorType(metadata k8sMetadata, podSC *k8sPodSecurityContext, sc *k8sSecurityContext, name string) string {
+	if sc.AppArmorProfile != nil {
+		return sc.AppArmorProfile.Type
+	}
+	if podSC.AppArmorProfile != nil {
+		return podSC.AppArmorProfile.Type
+	}
+	switch value := metadata.Annotations[appArmorAnnotationPrefix+name]; {
+	case value == "unconfined":
+		return "Unconfined"
+	case value == "runtime/default":
+		return "RuntimeDefault"
+	case strings.HasPrefix(value, "localhost/"):
+		return "Localhost"
+	}
+	return ""
+}
+
+// evaluatePodSecurity checks a pod spec against the baseline and restricted
+// Pod Security Standards, including init and ephemeral containers.
+func evaluatePodSecurity(metadata k8sMetadata, spec k8sPodSpec) PodSecurityResult {
+	var result PodSecurityResult
+	baseline := func(format string, args ...interface{}) {
+		result.BaselineViolations = append(result.BaselineViolations, fmt.Sprintf(format, args...))
+	}
+	restricted := func(format string, args ...interface{}) {
+		result.RestrictedViolations = append(result.RestrictedViolations, fmt.Sprintf(format, args...))
+	}
+
+	podSC := spec.SecurityContext
+	if podSC == nil {
+		podSC = &k8sPodSecurityContext{}
+	}
+
+	if spec.HostNetwork {
+		baseline("hostNetwork is true")
+	}
+	if spec.HostPID {
+		baseline("hostPID is true")
+	}
+	if spec.HostIPC {
+		baseline("hostIPC is true")
+	}
+	if podSC.WindowsOptions != nil && podSC.WindowsOptions.HostProcess != nil && *podSC.WindowsOptions.HostProcess {
+		baseline("securityContext.windowsOptions.hostProcess is true")
+	}
+	if podSC.SeccompProfile != nil && podSC.SeccompProfile.Type == "Unconfined" {
+		baseline("securityContext.seccompProfile.type is Unconfined")
+	}
+	if podSC.AppArmorProfile != nil && podSC.AppArmorProfile.Type == "Unconfined" {
+		baseline("securityContext.appArmorProfile.type is Unconfined")
+	}
+	if problem := seLinuxProblem(podSC.SELinuxOptions); problem != "" {
+		baseline("securityContext.seLinuxOptions %s", problem)
+	}
+	for _, sysctl := range podSC.Sysctls {
+		if !safeSysctls[sysctl.Name] {
+			baseline("sysctl %s is not in the safe set", sysctl.Name)
+		}
+	}
+	if podSC.RunAsUser != nil && *podSC.RunAsUser == 0 {
+		restricted("securityContext.runAsUser is 0")
+	}
+
+	for _, v := range spec.Volumes {
+		if v.HostPath != "" {
+			baseline("volume %s is a hostPath volume (%s)", v.Name, v.HostPath)
+		}
+		for _, volumeType := range v.Types {
+			if !restrictedVolumeTypes[volumeType] && volumeType != "hostPath" {
+				restricted("volume %s uses the %s volume type", v.Name, volumeType)
+			}
+		}
+	}
+
+	var containers []k8sContainer
+	containers = append(containers, spec.InitContainers...)
+	containers = append(containers, spec.Containers...)
+	containers = append(containers, spec.EphemeralContainers...)
+	for _, c := range containers {
+		sc := c.SecurityContext
+		if sc == nil {
+			sc = &k8sSecurityContext{}
+		}
+		prefix := "container " + c.Name + ": "
+
+		if sc.Privileged != nil && *sc.Privileged {
+			baseline(prefix + "securityContext.privileged is true")
+		}
+		if sc.WindowsOptions != nil && sc.WindowsOptions.HostProcess != nil && *sc.WindowsOptions.HostProcess {
+			baseline(prefix + "securityContext.windowsOptions.hostProcess is true")
+		}
+		if sc.ProcMount != "" && sc.ProcMount != "Default" {
+			baseline(prefix+"securityContext.procMount is %s", sc.ProcMount)
+		}
+		if problem := seLinuxProblem(sc.SELinuxOptions); problem != "" {
+			baseline(prefix+"securityContext.seLinuxOptions %s", problem)
+		}
+		if appArmorType(metadata, podSC, sc, c.Name) == "Unconfined" {
+			baseline(prefix + "AppArmor profile is unconfined")
+		}
+		for _, p := range c.Ports {
+			if p.HostPort != 0 {
+				baseline(prefix+"hostPort %d is used", p.HostPort)
+			}
+		}
+
+		var added, dropped []string
+		if sc.Capabilities != nil {
+			added, dropped = sc.Capabilities.Add, sc.Capabilities.Drop
+		}
+		for _, capability := range added {
+			normalized := normalizeCapability(capability)
+			if !baselineCapabilities[normalized] {
+				baseline(prefix+"capability %s is added", normalized)
+			} else if normalized != "NET_BIND_SERVICE" {
+				restricted(prefix+"capability %s is added", normalized)
+			}
+		}
+		dropsAll := false
+		for _, capability := range dropped {
+			dropsAll = dropsAll || normalizeCapability(capability) == "ALL"
+		}
+		if !dropsAll {
+			restricted(prefix + "capabilities.drop does not include ALL")
+		}
+
+		seccomp := sc.SeccompProfile
+		if seccomp != nil && seccomp.Type == "Unconfined" {
+			baseline(prefix + "securityContext.seccompProfile.type is Unconfined")
+		}
+		if seccomp == nil {
+			seccomp = podSC.SeccompProfile
+		}
+		if seccomp == nil || (seccomp.Type != "RuntimeDefault" && seccomp.Type != "Localhost") {
+			restricted(prefix + "seccompProfile.type is not RuntimeDefault or Localhost")
+		}
+
+		if sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation {
+			restricted(prefix + "securityContext.allowPrivilegeEscalation is not false")
+		}
+		nonRoot := podSC.RunAsNonRoot
+		if sc.RunAsNonRoot != nil {
+			nonRoot = sc.RunAsNonRoot
+		}
+		if nonRoot == nil || !*nonRoot {
+			restricted(prefix + "runAsNonRoot is not true")
+		}
+		if sc.RunAsUser != nil && *sc.RunAsUser == 0 {
+			restricted(prefix + "securityContext.runAsUser is 0")
+		}
+	}
+
+	switch {
+	case len(result.BaselineViolations) > 0:
+		result.Level = PodSecurityPrivileged
+	case len(result.RestrictedViolations) > 0:
+		result.Level = PodSecurityBaseline
+	default:
+		result.Level = PodSecurityRestricted
+	}
+	return result
+}
+
+// seLinuxProblem describes SELinux options the baseline level forbids.
+func seLinuxProblem(options *k8sSELinuxOptions) string {
+	if options == nil {
+		return ""
+	}
+	if !baselineSELinuxTypes[options.Type] {
+		return fmt.Sprintf("sets type %s", options.Type)
+	}
+	if options.User != "" || options.Role != "" {
+		return "sets a user or role"
+	}
+	return ""
+}
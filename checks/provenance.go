@@ -0,0 +1,114 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/client"
+)
+
+// isDigestReference reports whether an image reference pins a content digest,
+// e.g. "nginx@sha256:..." or "nginx:1.25@sha256:...".
+func isDigestReference(reference string) bool {
+	return strings.Contains(reference, "@sha256:")
+}
+
+// referenceRepository strips the tag and digest from an image reference.
+func referenceRepository(reference string) string {
+	repository, _, _ := strings.Cut(reference, "@")
+	slash := strings.LastIndex(repository, "/")
+	if colon := strings.LastIndex(repository, ":"); colon > slash {
+		repository = repository[:colon]
+	}
+	return repository
+}
+
+// pinnedReference returns the digest reference a container could be run from
+// instead of its tag, preferring the repository the tag belongs to.
+func pinnedReference(reference string, repoDigests []string) string {
+	repository := referenceRepository(reference)
+	for _, digest := range repoDigests {
+		if referenceRepository(digest) == repository {
+			return digest
+		}
+	}
+	if len(repoDigests) > 0 {
+		return repoDigests[0]
+	}
+	return ""
+}
+
+// ResolveImageReference returns the ID of the image a tag currently points to,
+// or "" when the reference is pinned, an image ID, or no longer exists locally.
+func ResolveImageReference(cli *client.Client, reference string) string {
+	if reference == "" || isDigestReference(reference) || isImageID(reference) {
+		return ""
+	}
+	imageInspect, _, err := cli.ImageInspectWithRaw(context.Background(), reference)
+	if err != nil {
+		return ""
+	}
+	return imageInspect.ID
+}
+
+func init() {
+	registerContainerRules(
+		ContainerRule{
+			ID:          "image-not-pinned",
+			Family:      FamilySecurity,
+			Severity:    SeverityLow,
+			Title:       "Container image is not pinned by digest",
+			Remediation: "Reference the image by digest (image@sha256:...) so the container always runs the content that was reviewed.",
+			Check: func(rc *RuleContext) []string {
+				reference := rc.Container.Config.Image
+				if isDigestReference(reference) || isImageID(reference) {
+					return nil
+				}
+				evidence := []string{fmt.Sprintf("Config.Image is the mutable tag %q", reference)}
+				if rc.Image != nil {
+					if pinned := pinnedReference(reference, rc.Image.RepoDigests); pinned != "" {
+						evidence = append(evidence, "Running image is available as "+pinned)
+					}
+				}
+				return evidence
+			},
+		},
+		ContainerRule{
+			ID:          "image-stale",
+			Family:      FamilySecurity,
+			Severity:    SeverityMedium,
+			Title:       "Container runs an outdated image for its tag",
+			Remediation: "Recreate the container so it runs the image its tag currently points to, after reviewing what changed.",
+			Check: func(rc *RuleContext) []string {
+				if rc.ReferenceImageID == "" || rc.ReferenceImageID == rc.Container.Image {
+					return nil
+				}
+				return []string{fmt.Sprintf("%s now points to %s but the container runs %s",
+					rc.Container.Config.Image, shortImageID(rc.ReferenceImageID), shortImageID(rc.Container.Image))}
+			},
+		},
+		ContainerRule{
+			ID:          "image-no-repo-digests",
+			Family:      FamilySecurity,
+			Severity:    SeverityLow,
+			Title:       "Image was not pulled from a registry",
+			Remediation: "Push the image to a registry and pull it from there so its provenance can be traced to a digest.",
+			Check: func(rc *RuleContext) []string {
+				if rc.Image == nil || len(rc.Image.RepoDigests) > 0 {
+					return nil
+				}
+				return []string{fmt.Sprintf("Image %s has no RepoDigests; it was built locally or loaded from an archive", shortImageID(rc.Image.ID))}
+			},
+		},
+	)
+}
+
+// shortImageID returns the first 12 hex characters of an image ID.
+func shortImageID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,250 @@
+package checks
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPerPage = 50
+	maxPerPage     = 500
+)
+
+// Sort keys of a container query.
+const (
+	SortRisk    = "risk"
+	SortName    = "name"
+	SortCreated = "created"
+)
+
+// severityWeights turn findings into a risk score, so that one critical
+// finding outweighs several lower ones.
+var severityWeights = map[Severity]int{
+	SeverityInfo:     0,
+	SeverityLow:      1,
+	SeverityMedium:   5,
+	SeverityHigh:     20,
+	SeverityCritical: 100,
+}
+
+// RiskScore sums the weights of the container's findings.
+func RiskScore(c ContainerInfo) int {
+	score := 0
+	for _, f := range c.Findings {
+		score += severityWeights[f.Severity]
+	}
+	return score
+}
+
+// ContainerQuery filters, sorts and pages containers. The zero value
+// matches every container, sorted newest first.
+type ContainerQuery struct {
+	Name     string   // substring of the container name
+	Image    string   // substring of the image reference
+	Label    string   // label name, or name=value
+	Project  string   // compose project
+	Status   string   // container state: created, running, paused, restarting, exited or dead
+	Severity Severity // containers with a finding at least this severe
+	Rule     string   // containers with a finding of this rule
+	Sort     string   // risk, name or created
+	Order    string   // asc or desc; defaults to the natural order of the sort key
+	Page     int
+	PerPage  int
+}
+
+// Pagination describes one page of a list.
+type Pagination struct {
+	Total   int `json:"total"`
+	Page    int `json:"page"`
+	PerPage int `json:"perPage"`
+	Pages   int `json:"pages"`
+}
+
+// ContainerPage is one page of the containers a query matched.
+type ContainerPage struct {
+	Pagination
+	Containers []ContainerInfo `json:"containers"`
+}
+
+// Paginate clamps page and perPage to the bounds of a list of total items
+// and returns the range of items on the page.
+func Paginate(total, page, perPage int) (p Pagination, start, end int) {
+	if perPage <= 0 {
+		perPage = defaultPerPage
+	}
+	if perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+	p = Pagination{Total: total, Page: page, PerPage: perPage, Pages: (total + perPage - 1) / perPage}
+	if p.Pages == 0 {
+		p.Pages = 1
+	}
+	if p.Page < 1 {
+		p.Page = 1
+	}
+	if p.Page > p.Pages {
+		p.Page = p.Pages
+	}
+	start = (p.Page - 1) * perPage
+	end = start + perPage
+	if end > total {
+		end = total
+	}
+	return p, start, end
+}
+
+// ParseContainerQuery reads a query from URL parameters.
+func ParseContainerQuery(values url.Values) (ContainerQuery, error) {
+	q := ContainerQuery{
+		Name:    strings.TrimSpace(values.Get("name")),
+		Image:   strings.TrimSpace(values.Get("image")),
+		Label:   strings.TrimSpace(values.Get("label")),
+		Project: strings.TrimSpace(values.Get("project")),
+		Status:  strings.ToLower(strings.TrimSpace(values.Get("status"))),
+		Rule:    strings.TrimSpace(values.Get("rule")),
+		Sort:    strings.ToLower(values.Get("sort")),
+		Order:   strings.ToLower(values.Get("order")),
+	}
+	if value := values.Get("severity"); value != "" {
+		severity, err := ParseSeverity(value)
+		if err != nil {
+			return q, err
+		}
+		q.Severity = severity
+	}
+	switch q.Sort {
+	case "", SortRisk, SortName, SortCreated:
+	default:
+		return q, fmt.Errorf("unknown sort key %q", q.Sort)
+	}
+	switch q.Order {
+	case "", "asc", "desc":
+	default:
+		return q, fmt.Errorf("unknown sort order %q", q.Order)
+	}
+	for _, p := range []struct {
+		name string
+		dest *int
+	}{{"page", &q.Page}, {"per_page", &q.PerPage}} {
+		if value := values.Get(p.name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return q, fmt.Errorf("invalid %s %q", p.name, value)
+			}
+			*p.dest = n
+		}
+	}
+	return q, nil
+}
+
+// Values encodes the query as URL parameters, leaving out defaults, so that
+// a filtered view can be linked to.
+func (q ContainerQuery) Values() url.Values {
+	values := url.Values{}
+	set := func(name, value string) {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	set("name", q.Name)
+	set("image", q.Image)
+	set("label", q.Label)
+	set("project", q.Project)
+	set("status", q.Status)
+	if q.Severity > SeverityInfo {
+		set("severity", q.Severity.String())
+	}
+	set("rule", q.Rule)
+	set("sort", q.Sort)
+	set("order", q.Order)
+	if q.Page > 1 {
+		set("page", strconv.Itoa(q.Page))
+	}
+	if q.PerPage > 0 && q.PerPage != defaultPerPage {
+		set("per_page", strconv.Itoa(q.PerPage))
+	}
+	return values
+}
+
+// Filtered reports whether the query leaves any container out.
+func (q ContainerQuery) Filtered() bool {
+	return q.Name != "" || q.Image != "" || q.Label != "" || q.Project != "" || q.Status != "" || q.Severity > SeverityInfo || q.Rule != ""
+}
+
+// Matches reports whether a container passes the query's filters.
+func (q ContainerQuery) Matches(c ContainerInfo) bool {
+	if q.Name != "" && !containsFold(strings.TrimPrefix(c.ContainerName, "/"), q.Name) {
+		return false
+	}
+	if q.Image != "" && !containsFold(c.PrivilegedContainerImage, q.Image) {
+		return false
+	}
+	if q.Label != "" {
+		name, value, hasValue := strings.Cut(q.Label, "=")
+		actual, ok := c.Labels[name]
+		if !ok || (hasValue && actual != value) {
+			return false
+		}
+	}
+	if q.Project != "" && c.Labels[composeProjectLabel] != q.Project {
+		return false
+	}
+	if q.Status != "" && c.State != q.Status {
+		return false
+	}
+	if q.Severity > SeverityInfo && HighestSeverity(c.Findings) < q.Severity {
+		return false
+	}
+	if q.Rule != "" {
+		found := false
+		for _, f := range c.Findings {
+			if f.RuleID == q.Rule {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply filters and sorts the containers and returns the requested page.
+func (q ContainerQuery) Apply(containers []ContainerInfo) ContainerPage {
+	matched := []ContainerInfo{}
+	for _, c := range containers {
+		if q.Matches(c) {
+			matched = append(matched, c)
+		}
+	}
+
+	// Each key has a natural direction: riskiest, A to Z, newest first.
+	orders := map[string]func(a, b ContainerInfo) bool{
+		SortRisk:    func(a, b ContainerInfo) bool { return RiskScore(a) > RiskScore(b) },
+		SortName:    func(a, b ContainerInfo) bool { return a.ContainerName < b.ContainerName },
+		SortCreated: func(a, b ContainerInfo) bool { return a.Created.After(b.Created) },
+	}
+	sortKey := q.Sort
+	if orders[sortKey] == nil {
+		sortKey = SortCreated
+	}
+	less := orders[sortKey]
+	reverse := (q.Order == "asc" && sortKey != SortName) || (q.Order == "desc" && sortKey == SortName)
+	sort.SliceStable(matched, func(i, j int) bool {
+		if reverse {
+			return less(matched[j], matched[i])
+		}
+		return less(matched[i], matched[j])
+	})
+
+	pagination, start, end := Paginate(len(matched), q.Page, q.PerPage)
+	return ContainerPage{Pagination: pagination, Containers: matched[start:end]}
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
@@ -0,0 +1,412 @@
+package checks
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// The rpm package database in recent RPM-based images is an SQLite file
+// (var/lib/rpm/rpmdb.sqlite) with one table, Packages(hnum, blob), where each
+// blob is an rpm header. Only the parts of the SQLite format needed to read
+// that table are implemented here.
+
+const sqliteMagic = "SQLite format 3\x00"
+
+// sqliteFile is a read-only view of an SQLite database held in memory.
+type sqliteFile struct {
+	data       []byte
+	pageSize   int
+	usableSize int
+}
+
+func openSQLite(data []byte) (*sqliteFile, error) {
+	if len(data) < 100 || string(data[:16]) != sqliteMagic {
+		return nil, fmt.Errorf("not an SQLite database")
+	}
+	pageSize := int(binary.BigEndian.Uint16(data[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("invalid SQLite page size %d", pageSize)
+	}
+	usableSize := pageSize - int(data[20])
+	if usableSize < 480 {
+		return nil, fmt.Errorf("invalid SQLite usable page size %d", usableSize)
+	}
+	return &sqliteFile{
+		data:       data,
+		pageSize:   pageSize,
+		usableSize: usableSize,
+	}, nil
+}
+
+// page returns the bytes of a 1-based page number.
+func (db *sqliteFile) page(number uint32) ([]byte, error) {
+	if number == 0 || int(number) > len(db.data)/db.pageSize {
+		return nil, fmt.Errorf("SQLite page %d out of range", number)
+	}
+	start := int(number-1) * db.pageSize
+	return db.data[start : start+db.pageSize], nil
+}
+
+// tableRootPage finds the root page of a table in sqlite_master.
+func (db *sqliteFile) tableRootPage(table string) (uint32, error) {
+	var root uint32
+	err := db.walkTable(1, func(record []interface{}) error {
+		if len(record) >= 4 && record[0] == "table" && record[1] == table {
+			if n, ok := record[3].(int64); ok {
+				root = uint32(n)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if root == 0 {
+		return 0, fmt.Errorf("table %s not found", table)
+	}
+	return root, nil
+}
+
+// walkTable visits every record of the table b-tree rooted at a page.
+func (db *sqliteFile) walkTable(root uint32, visit func(record []interface{}) error) error {
+	return db.walkPage(root, visit, 0, make(map[uint32]bool))
+}
+
+// walkPage visits the records under a b-tree page. The database comes from
+// an untrusted image, so every offset is checked and a page that is reached
+// twice is reported as corrupt rather than walked again.
+func (db *sqliteFile) walkPage(number uint32, visit func(record []interface{}) error, depth int, visited map[uint32]bool) error {
+	if depth > 64 {
+		return fmt.Errorf("SQLite b-tree too deep")
+	}
+	if visited[number] {
+		return fmt.Errorf("SQLite page %d referenced twice", number)
+	}
+	visited[number] = true
+	pageData, err := db.page(number)
+	if err != nil {
+		return err
+	}
+	headerOffset := 0
+	if number == 1 {
+		headerOffset = 100
+	}
+	header := pageData[headerOffset:]
+	cellCount := int(binary.BigEndian.Uint16(header[3:5]))
+
+	// cellOffset reads the i-th cell pointer, which must leave room for a
+	// cell of at least minSize bytes.
+	cellOffset := func(pointers []byte, i, minSize int) (int, error) {
+		if 2*i+2 > len(pointers) {
+			return 0, fmt.Errorf("SQLite page %d has too many cells", number)
+		}
+		cell := int(binary.BigEndian.Uint16(pointers[2*i:]))
+		if cell < headerOffset || cell+minSize > db.usableSize {
+			return 0, fmt.Errorf("SQLite page %d has a cell out of range", number)
+		}
+		return cell, nil
+	}
+
+	switch header[0] {
+	case 0x05: // interior table page
+		pointers := header[12:]
+		for i := 0; i < cellCount; i++ {
+			cell, err := cellOffset(pointers, i, 4)
+			if err != nil {
+				return err
+			}
+			child := binary.BigEndian.Uint32(pageData[cell:])
+			if err := db.walkPage(child, visit, depth+1, visited); err != nil {
+				return err
+			}
+		}
+		return db.walkPage(binary.BigEndian.Uint32(header[8:12]), visit, depth+1, visited)
+
+	case 0x0d: // leaf table page
+		pointers := header[8:]
+		for i := 0; i < cellCount; i++ {
+			cell, err := cellOffset(pointers, i, 2)
+			if err != nil {
+				return err
+			}
+			payload, err := db.cellPayload(pageData, cell)
+			if err != nil {
+				return err
+			}
+			record, err := parseSQLiteRecord(payload)
+			if err != nil {
+				return err
+			}
+			if err := visit(record); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unexpected SQLite page type 0x%02x", header[0])
+	}
+}
+
+// cellPayload reads the payload of a table leaf cell, following overflow pages.
+func (db *sqliteFile) cellPayload(pageData []byte, offset int) ([]byte, error) {
+	cellData := pageData[:db.usableSize]
+	payloadSize, n := readVarint(cellData[offset:])
+	offset += n
+	_, n = readVarint(cellData[offset:]) // rowid
+	offset += n
+
+	// A payload cannot be larger than the database holding it.
+	if payloadSize > uint64(len(db.data)) {
+		return nil, fmt.Errorf("corrupt SQLite cell: payload of %d bytes", payloadSize)
+	}
+	size := int(payloadSize)
+	maxLocal := db.usableSize - 35
+	if size <= maxLocal {
+		if offset+size > len(cellData) {
+			return nil, fmt.Errorf("corrupt SQLite cell: payload past the end of the page")
+		}
+		return cellData[offset : offset+size], nil
+	}
+
+	minLocal := (db.usableSize-12)*32/255 - 23
+	local := minLocal + (size-minLocal)%(db.usableSize-4)
+	if local > maxLocal {
+		local = minLocal
+	}
+
+	if offset+local+4 > len(cellData) {
+		return nil, fmt.Errorf("corrupt SQLite cell: payload past the end of the page")
+	}
+	payload := make([]byte, 0, size)
+	payload = append(payload, cellData[offset:offset+local]...)
+	next := binary.BigEndian.Uint32(cellData[offset+local:])
+	for next != 0 && len(payload) < size {
+		overflow, err := db.page(next)
+		if err != nil {
+			return nil, err
+		}
+		chunk := overflow[4:db.usableSize]
+		if remaining := size - len(payload); len(chunk) > remaining {
+			chunk = chunk[:remaining]
+		}
+		payload = append(payload, chunk...)
+		next = binary.BigEndian.Uint32(overflow[:4])
+	}
+	if len(payload) < size {
+		return nil, fmt.Errorf("corrupt SQLite cell: overflow chain ends early")
+	}
+	return payload, nil
+}
+
+// parseSQLiteRecord decodes a record into int64, float64 (as raw bits), string, []byte or nil values.
+func parseSQLiteRecord(payload []byte) ([]interface{}, error) {
+	headerSize, n := readVarint(payload)
+	if headerSize > uint64(len(payload)) {
+		return nil, fmt.Errorf("corrupt SQLite record")
+	}
+
+	var types []uint64
+	for pos := n; pos < int(headerSize); {
+		t, n := readVarint(payload[pos:])
+		types = append(types, t)
+		pos += n
+	}
+
+	var values []interface{}
+	body := payload[headerSize:]
+	for _, t := range types {
+		var size uint64
+		switch {
+		case t == 0 || t == 8 || t == 9:
+			size = 0
+		case t >= 1 && t <= 4:
+			size = t
+		case t == 5:
+			size = 6
+		case t == 6 || t == 7:
+			size = 8
+		case t >= 12:
+			size = (t - 12) / 2
+		default:
+			return nil, fmt.Errorf("unsupported SQLite serial type %d", t)
+		}
+		if size > uint64(len(body)) {
+			return nil, fmt.Errorf("corrupt SQLite record")
+		}
+		field := body[:size]
+		body = body[size:]
+
+		switch {
+		case t == 0:
+			values = append(values, nil)
+		case t == 8:
+			values = append(values, int64(0))
+		case t == 9:
+			values = append(values, int64(1))
+		case t <= 6:
+			var v int64
+			for _, b := range field {
+				v = v<<8 | int64(b)
+			}
+			// Sign-extend
+			shift := 64 - 8*size
+			values = append(values, v<<shift>>shift)
+		case t == 7:
+			values = append(values, binary.BigEndian.Uint64(field))
+		case t%2 == 0:
+			values = append(values, field)
+		default:
+			values = append(values, string(field))
+		}
+	}
+	return values, nil
+}
+
+// readVarint decodes an SQLite big-endian varint and returns its length.
+func readVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 9 && i < len(b); i++ {
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return v, len(b)
+}
+
+// rpm header tags and types used to describe a package.
+const (
+	rpmTagName      = 1000
+	rpmTagVersion   = 1001
+	rpmTagRelease   = 1002
+	rpmTagEpoch     = 1003
+	rpmTagArch      = 1022
+	rpmTagSourceRPM = 1044
+
+	rpmTypeInt32  = 4
+	rpmTypeString = 6
+)
+
+// parseRPMHeader reads the package fields from an rpm header blob.
+func parseRPMHeader(blob []byte) (Package, error) {
+	if len(blob) < 8 {
+		return Package{}, fmt.Errorf("rpm header too short")
+	}
+	indexCount := int(binary.BigEndian.Uint32(blob[0:4]))
+	dataLength := int(binary.BigEndian.Uint32(blob[4:8]))
+	dataStart := 8 + indexCount*16
+	if indexCount <= 0 || dataStart+dataLength > len(blob) {
+		return Package{}, fmt.Errorf("corrupt rpm header")
+	}
+	data := blob[dataStart : dataStart+dataLength]
+
+	var pkg Package
+	var epoch, release, arch string
+	for i := 0; i < indexCount; i++ {
+		entry := blob[8+i*16:]
+		tag := binary.BigEndian.Uint32(entry[0:4])
+		kind := binary.BigEndian.Uint32(entry[4:8])
+		offset := int(binary.BigEndian.Uint32(entry[8:12]))
+		if offset < 0 || offset >= len(data) {
+			continue
+		}
+
+		var value string
+		switch kind {
+		case rpmTypeString:
+			end := bytes.IndexByte(data[offset:], 0)
+			if end < 0 {
+				continue
+			}
+			value = string(data[offset : offset+end])
+		case rpmTypeInt32:
+			if offset+4 > len(data) {
+				continue
+			}
+			value = fmt.Sprint(binary.BigEndian.Uint32(data[offset:]))
+		default:
+			continue
+		}
+
+		switch tag {
+		case rpmTagName:
+			pkg.Name = value
+		case rpmTagVersion:
+			pkg.Version = value
+		case rpmTagRelease:
+			release = value
+		case rpmTagEpoch:
+			epoch = value
+		case rpmTagArch:
+			arch = value
+		case rpmTagSourceRPM:
+			pkg.Source = sourceRPMName(value)
+		}
+	}
+
+	if pkg.Name == "" || pkg.Version == "" {
+		return Package{}, fmt.Errorf("rpm header without name or version")
+	}
+	if release != "" {
+		pkg.Version += "-" + release
+	}
+	if epoch != "" && epoch != "0" {
+		pkg.Version = epoch + ":" + pkg.Version
+	}
+	pkg.Arch = arch
+	return pkg, nil
+}
+
+// sourceRPMName extracts the package name from a source rpm file name such as
+// "openssl-1.1.1k-12.el8.src.rpm".
+func sourceRPMName(sourceRPM string) string {
+	name := strings.TrimSuffix(sourceRPM, ".rpm")
+	name = strings.TrimSuffix(name, ".src")
+	name = strings.TrimSuffix(name, ".nosrc")
+	for i := 0; i < 2; i++ {
+		if j := strings.LastIndex(name, "-"); j > 0 {
+			name = name[:j]
+		}
+	}
+	return name
+}
+
+// parseRPMDatabase lists the packages in an rpmdb.sqlite file.
+func parseRPMDatabase(data []byte) ([]Package, error) {
+	db, err := openSQLite(data)
+	if err != nil {
+		return nil, err
+	}
+	root, err := db.tableRootPage("Packages")
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []Package
+	err = db.walkTable(root, func(record []interface{}) error {
+		if len(record) < 2 {
+			return nil
+		}
+		blob, ok := record[1].([]byte)
+		if !ok {
+			return nil
+		}
+		pkg, err := parseRPMHeader(blob)
+		if err != nil {
+			return nil
+		}
+		pkg.Type = PackageTypeRPM
+		packages = append(packages, pkg)
+		return nil
+	})
+	return packages, err
+}
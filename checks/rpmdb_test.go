@@ -0,0 +1,290 @@
+package checks
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+const testPageSize = 512
+
+// putVarint encodes an SQLite varint of up to 56 bits.
+func putVarint(v uint64) []byte {
+	if v < 0x80 {
+		return []byte{byte(v)}
+	}
+	var groups []byte
+	for v > 0 {
+		groups = append([]byte{byte(v & 0x7f)}, groups...)
+		v >>= 7
+	}
+	for i := range groups[:len(groups)-1] {
+		groups[i] |= 0x80
+	}
+	return groups
+}
+
+// sqliteRecord encodes int64, string and []byte values as a record.
+func sqliteRecord(values ...interface{}) []byte {
+	var types, body []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case int64:
+			types = append(types, putVarint(6)...)
+			body = binary.BigEndian.AppendUint64(body, uint64(v))
+		case string:
+			types = append(types, putVarint(uint64(13+2*len(v)))...)
+			body = append(body, v...)
+		case []byte:
+			types = append(types, putVarint(uint64(12+2*len(v)))...)
+			body = append(body, v...)
+		}
+	}
+	header := append(putVarint(uint64(len(types)+1)), types...)
+	return append(header, body...)
+}
+
+// testDatabase lays out an SQLite file page by page.
+type testDatabase struct {
+	pages [][]byte
+}
+
+func newTestDatabase() *testDatabase {
+	db := &testDatabase{}
+	db.addPage()
+	copy(db.pages[0], sqliteMagic)
+	binary.BigEndian.PutUint16(db.pages[0][16:], testPageSize)
+	return db
+}
+
+// addPage appends an empty page and returns its 1-based number.
+func (db *testDatabase) addPage() uint32 {
+	db.pages = append(db.pages, make([]byte, testPageSize))
+	return uint32(len(db.pages))
+}
+
+// leaf writes a table leaf page holding one cell per payload, spilling large
+// payloads onto overflow pages.
+func (db *testDatabase) leaf(number uint32, payloads ...[]byte) {
+	page := db.pages[number-1]
+	headerOffset := 0
+	if number == 1 {
+		headerOffset = 100
+	}
+	page[headerOffset] = 0x0d
+	binary.BigEndian.PutUint16(page[headerOffset+3:], uint16(len(payloads)))
+
+	end := testPageSize
+	for i, payload := range payloads {
+		cell := append(putVarint(uint64(len(payload))), putVarint(uint64(i+1))...)
+		maxLocal := testPageSize - 35
+		if len(payload) <= maxLocal {
+			cell = append(cell, payload...)
+		} else {
+			minLocal := (testPageSize-12)*32/255 - 23
+			local := minLocal + (len(payload)-minLocal)%(testPageSize-4)
+			if local > maxLocal {
+				local = minLocal
+			}
+			cell = append(cell, payload[:local]...)
+			cell = binary.BigEndian.AppendUint32(cell, db.overflow(payload[local:]))
+			page = db.pages[number-1]
+		}
+		end -= len(cell)
+		copy(page[end:], cell)
+		binary.BigEndian.PutUint16(page[headerOffset+8+2*i:], uint16(end))
+	}
+}
+
+// overflow stores data in a chain of overflow pages and returns the first.
+func (db *testDatabase) overflow(data []byte) uint32 {
+	first := db.addPage()
+	number := first
+	for {
+		page := db.pages[number-1]
+		n := copy(page[4:], data)
+		data = data[n:]
+		if len(data) == 0 {
+			return first
+		}
+		next := db.addPage()
+		binary.BigEndian.PutUint32(db.pages[number-1], next)
+		number = next
+	}
+}
+
+func (db *testDatabase) bytes() []byte {
+	var data []byte
+	for _, page := range db.pages {
+		data = append(data, page...)
+	}
+	return data
+}
+
+// rpmHeader encodes string tags as an rpm header blob.
+func rpmHeader(tags map[uint32]string) []byte {
+	var index, data []byte
+	for _, tag := range []uint32{rpmTagName, rpmTagVersion, rpmTagRelease, rpmTagArch, rpmTagSourceRPM} {
+		value, ok := tags[tag]
+		if !ok {
+			continue
+		}
+		index = binary.BigEndian.AppendUint32(index, tag)
+		index = binary.BigEndian.AppendUint32(index, rpmTypeString)
+		index = binary.BigEndian.AppendUint32(index, uint32(len(data)))
+		index = binary.BigEndian.AppendUint32(index, 1)
+		data = append(data, value...)
+		data = append(data, 0)
+	}
+	blob := binary.BigEndian.AppendUint32(nil, uint32(len(index)/16))
+	blob = binary.BigEndian.AppendUint32(blob, uint32(len(data)))
+	return append(append(blob, index...), data...)
+}
+
+// rpmDatabase builds an rpmdb.sqlite file with one package per header.
+func rpmDatabase(headers ...[]byte) *testDatabase {
+	db := newTestDatabase()
+	packages := db.addPage()
+	db.leaf(1, sqliteRecord("table", "Packages", "Packages", int64(packages), "CREATE TABLE Packages (hnum INTEGER PRIMARY KEY, blob BLOB NOT NULL)"))
+	var records [][]byte
+	for i, header := range headers {
+		records = append(records, sqliteRecord(int64(i+1), header))
+	}
+	db.leaf(packages, records...)
+	return db
+}
+
+func TestParseRPMDatabase(t *testing.T) {
+	bash := rpmHeader(map[uint32]string{
+		rpmTagName:      "bash",
+		rpmTagVersion:   "5.1.8",
+		rpmTagRelease:   "6.el9",
+		rpmTagArch:      "x86_64",
+		rpmTagSourceRPM: "bash-5.1.8-6.el9.src.rpm",
+	})
+	// A long source rpm name pushes the header onto overflow pages.
+	openssl := rpmHeader(map[uint32]string{
+		rpmTagName:      "openssl-libs",
+		rpmTagVersion:   "3.0.7",
+		rpmTagRelease:   "27.el9",
+		rpmTagSourceRPM: "openssl-3.0.7-27.el9.src.rpm" + strings.Repeat("\x00", 1200),
+	})
+
+	packages, err := parseRPMDatabase(rpmDatabase(bash, openssl).bytes())
+	if err != nil {
+		t.Fatalf("parseRPMDatabase: %v", err)
+	}
+	want := []Package{
+		{Name: "bash", Version: "5.1.8-6.el9", Arch: "x86_64", Source: "bash", Type: PackageTypeRPM},
+		{Name: "openssl-libs", Version: "3.0.7-27.el9", Source: "openssl", Type: PackageTypeRPM},
+	}
+	if len(packages) != len(want) {
+		t.Fatalf("got %d packages, want %d: %+v", len(packages), len(want), packages)
+	}
+	for i := range want {
+		if packages[i] != want[i] {
+			t.Errorf("package %d = %+v, want %+v", i, packages[i], want[i])
+		}
+	}
+}
+
+func TestParseRPMDatabaseMalformed(t *testing.T) {
+	header := rpmHeader(map[uint32]string{rpmTagName: "bash", rpmTagVersion: "5.1.8"})
+	packagesPage := func(data []byte) []byte {
+		return data[testPageSize : 2*testPageSize]
+	}
+
+	tests := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+	}{
+		{"truncated header", func(data []byte) []byte {
+			return data[:64]
+		}},
+		{"invalid page size", func(data []byte) []byte {
+			binary.BigEndian.PutUint16(data[16:], 768)
+			return data
+		}},
+		{"reserved space too large", func(data []byte) []byte {
+			data[20] = 255
+			return data
+		}},
+		{"truncated page", func(data []byte) []byte {
+			return data[:testPageSize+100]
+		}},
+		{"cell pointer past the page", func(data []byte) []byte {
+			binary.BigEndian.PutUint16(packagesPage(data)[8:], 0xfff0)
+			return data
+		}},
+		{"too many cells", func(data []byte) []byte {
+			binary.BigEndian.PutUint16(packagesPage(data)[3:], 0xffff)
+			return data
+		}},
+		{"unknown page type", func(data []byte) []byte {
+			packagesPage(data)[0] = 0x0a
+			return data
+		}},
+		{"interior page pointing to itself", func(data []byte) []byte {
+			page := packagesPage(data)
+			page[0] = 0x05
+			binary.BigEndian.PutUint32(page[8:], 2)
+			return data
+		}},
+		{"child page out of range", func(data []byte) []byte {
+			page := packagesPage(data)
+			page[0] = 0x05
+			binary.BigEndian.PutUint32(page[8:], 0xffffffff)
+			return data
+		}},
+		{"payload larger than the database", func(data []byte) []byte {
+			page := packagesPage(data)
+			cell := binary.BigEndian.Uint16(page[8:])
+			copy(page[cell:], []byte{0xff, 0xff, 0xff, 0xff, 0x7f})
+			return data
+		}},
+		{"payload past the end of the page", func(data []byte) []byte {
+			page := packagesPage(data)
+			binary.BigEndian.PutUint16(page[8:], testPageSize-2)
+			copy(page[testPageSize-2:], []byte{0x7f, 0x01})
+			return data
+		}},
+		{"overflow page out of range", func(data []byte) []byte {
+			page := packagesPage(data)
+			binary.BigEndian.PutUint16(page[8:], 100)
+			// 39 bytes of a 1000-byte payload stay on a 512-byte page.
+			cell := append(putVarint(1000), 1)
+			cell = append(cell, make([]byte, 39)...)
+			cell = binary.BigEndian.AppendUint32(cell, 0xffff)
+			copy(page[100:], cell)
+			return data
+		}},
+		{"overflow chain ends early", func(data []byte) []byte {
+			page := packagesPage(data)
+			binary.BigEndian.PutUint16(page[8:], 100)
+			cell := append(putVarint(1000), 1)
+			cell = append(cell, make([]byte, 43)...)
+			copy(page[100:], cell)
+			return data
+		}},
+		{"record header larger than the payload", func(data []byte) []byte {
+			page := packagesPage(data)
+			cell := binary.BigEndian.Uint16(page[8:])
+			copy(page[cell:], []byte{0x02, 0x01, 0xff, 0x7f})
+			return data
+		}},
+		{"field larger than the record", func(data []byte) []byte {
+			page := packagesPage(data)
+			cell := binary.BigEndian.Uint16(page[8:])
+			copy(page[cell:], []byte{0x05, 0x01, 0x04, 0x02, 0xff, 0x7f})
+			return data
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.corrupt(rpmDatabase(header).bytes())
+			if _, err := parseRPMDatabase(data); err == nil {
+				t.Errorf("parseRPMDatabase succeeded on a corrupt database")
+			}
+		})
+	}
+}
@@ -0,0 +1,365 @@
+// container-checker/checks/rules.go
+package checks
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// Severity ranks how serious a finding is.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+var severityNames = []string{"info", "low", "medium", "high", "critical"}
+
+// String returns the lower-case name of the severity.
+func (s Severity) String() string {
+	if s < SeverityInfo || int(s) >= len(severityNames) {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// ParseSeverity converts a severity name into a Severity.
+func ParseSeverity(name string) (Severity, error) {
+	for i, n := range severityNames {
+		if strings.EqualFold(n, strings.TrimSpace(name)) {
+			return Severity(i), nil
+		}
+	}
+	return SeverityInfo, fmt.Errorf("unknown severity %q", name)
+}
+
+// MarshalJSON encodes the severity by name.
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON decodes a severity name.
+func (s *Severity) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	parsed, err := ParseSeverity(name)
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
+}
+
+// Rule families group related rules in the report.
+const (
+	FamilySecurity    = "security"
+	FamilyOperational = "operational"
+)
+
+// familySeverityBands bounds the severity a rule family can report, so that
+// hygiene findings never outrank security-critical ones.
+var familySeverityBands = map[string][2]Severity{
+	FamilySecurity:    {SeverityLow, SeverityCritical},
+	FamilyOperational: {SeverityInfo, SeverityMedium},
+}
+
+// clampToFamilyBand keeps a severity inside its family's band.
+func clampToFamilyBand(family string, severity Severity) Severity {
+	band, ok := familySeverityBands[family]
+	if !ok {
+		return severity
+	}
+	if severity < band[0] {
+		return band[0]
+	}
+	if severity > band[1] {
+		return band[1]
+	}
+	return severity
+}
+
+// Finding is the result of a rule that matched a container.
+type Finding struct {
+	RuleID      string   `json:"ruleId"`
+	Family      string   `json:"family"`
+	Severity    Severity `json:"severity"`
+	Title       string   `json:"title"`
+	Evidence    []string `json:"evidence"`
+	Remediation string   `json:"remediation"`
+}
+
+// RuleContext carries everything a container rule needs to evaluate one container.
+// Image and BaseImage are nil when the container's image could not be inspected.
+// ReferenceImageID is the image the container's tag points to now, if any.
+// Signature is nil when signature verification is not configured.
+type RuleContext struct {
+	Container        types.ContainerJSON
+	Runtime          RuntimeInfo
+	Image            *types.ImageInspect
+	BaseImage        *BaseImage
+	ReferenceImageID string
+	Signature        *SignatureResult
+}
+
+// ContainerRule is a single check run against a container. Check returns the
+// evidence for a finding, or nothing when the container passes.
+type ContainerRule struct {
+	ID          string
+	Family      string
+	Severity    Severity
+	Title       string
+	Remediation string
+	Check       func(rc *RuleContext) []string
+}
+
+// containerRules is the registry of rules evaluated for every container.
+var containerRules []ContainerRule
+
+// registerContainerRules adds rules to the registry.
+func registerContainerRules(rules ...ContainerRule) {
+	containerRules = append(containerRules, rules...)
+}
+
+// ContainerRules returns the registered container rules.
+func ContainerRules() []ContainerRule {
+	return containerRules
+}
+
+// EvaluateContainer runs every registered rule against the container and
+// returns the findings sorted by severity.
+func EvaluateContainer(rc *RuleContext) []Finding {
+	if rc.Container.ContainerJSONBase == nil || rc.Container.HostConfig == nil || rc.Container.Config == nil {
+		return nil
+	}
+
+	var findings []Finding
+	for _, rule := range containerRules {
+		evidence := rule.Check(rc)
+		if len(evidence) == 0 {
+			continue
+		}
+
+		finding := Finding{
+			RuleID:      rule.ID,
+			Family:      rule.Family,
+			Severity:    clampToFamilyBand(rule.Family, rule.Severity),
+			Title:       rule.Title,
+			Evidence:    evidence,
+			Remediation: rule.Remediation,
+		}
+		adjustSeverityForRuntime(&finding, rc.Runtime)
+		findings = append(findings, finding)
+	}
+
+	sortFindings(findings)
+	return findings
+}
+
+// sortFindings orders findings by severity, most severe first, with security
+// findings ahead of operational ones at the same severity.
+func sortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Severity != findings[j].Severity {
+			return findings[i].Severity > findings[j].Severity
+		}
+		return findings[i].Family == FamilySecurity && findings[j].Family != FamilySecurity
+	})
+}
+
+// FilterFamily returns the findings that belong to a rule family.
+func FilterFamily(findings []Finding, family string) []Finding {
+	var filtered []Finding
+	for _, f := range findings {
+		if f.Family == family {
+			filtered = append(filtered, f)
+		}
+	}
+	return filtered
+}
+
+// HighestSeverity returns the most severe level among the findings.
+func HighestSeverity(findings []Finding) Severity {
+	highest := SeverityInfo
+	for _, f := range findings {
+		if f.Severity > highest {
+			highest = f.Severity
+		}
+	}
+	return highest
+}
+
+func init() {
+	registerContainerRules(
+		ContainerRule{
+			ID:          "privileged",
+			Family:      FamilySecurity,
+			Severity:    SeverityCritical,
+			Title:       "Container runs in privileged mode",
+			Remediation: "Remove --privileged and grant only the capabilities and devices the workload needs.",
+			Check: func(rc *RuleContext) []string {
+				if rc.Container.HostConfig.Privileged {
+					return []string{"HostConfig.Privileged is true"}
+				}
+				return nil
+			},
+		},
+		ContainerRule{
+			ID:          "root-user",
+			Family:      FamilySecurity,
+			Severity:    SeverityHigh,
+			Title:       "Container runs as root",
+			Remediation: "Run the container with --user set to an unprivileged UID or use rootless mode.",
+			Check: func(rc *RuleContext) []string {
+				if isRootUser(rc.Container.Config.User) {
+					return []string{fmt.Sprintf("Config.User is %q", rc.Container.Config.User)}
+				}
+				return nil
+			},
+		},
+		ContainerRule{
+			ID:          "no-new-privileges",
+			Family:      FamilySecurity,
+			Severity:    SeverityMedium,
+			Title:       "Privilege escalation is not blocked",
+			Remediation: "Start the container with --security-opt no-new-privileges.",
+			Check: func(rc *RuleContext) []string {
+				if !hasNoNewPrivileges(rc.Container.HostConfig.SecurityOpt) {
+					return []string{fmt.Sprintf("HostConfig.SecurityOpt is %v", rc.Container.HostConfig.SecurityOpt)}
+				}
+				return nil
+			},
+		},
+		ContainerRule{
+			ID:          "unconfined-profile",
+			Family:      FamilySecurity,
+			Severity:    SeverityHigh,
+			Title:       "Seccomp or AppArmor confinement is disabled",
+			Remediation: "Remove seccomp=unconfined and apparmor=unconfined so the runtime's default profiles apply, or use a custom profile.",
+			Check: func(rc *RuleContext) []string {
+				var evidence []string
+				for _, opt := range rc.Container.HostConfig.SecurityOpt {
+					if isUnconfinedProfile(opt) {
+						evidence = append(evidence, fmt.Sprintf("HostConfig.SecurityOpt contains %s", opt))
+					}
+				}
+				return evidence
+			},
+		},
+		ContainerRule{
+			ID:          "pids-limit",
+			Family:      FamilySecurity,
+			Severity:    SeverityMedium,
+			Title:       "No process limit configured",
+			Remediation: "Set --pids-limit to bound the number of processes and prevent fork bombs.",
+			Check: func(rc *RuleContext) []string {
+				limit := rc.Container.HostConfig.PidsLimit
+				if limit == nil || *limit <= 0 {
+					return []string{"HostConfig.PidsLimit is not set"}
+				}
+				return nil
+			},
+		},
+		ContainerRule{
+			ID:          "writable-rootfs",
+			Family:      FamilySecurity,
+			Severity:    SeverityLow,
+			Title:       "Root filesystem is writable",
+			Remediation: "Start the container with --read-only and mount tmpfs for paths that need writes.",
+			Check: func(rc *RuleContext) []string {
+				if !rc.Container.HostConfig.ReadonlyRootfs {
+					return []string{"HostConfig.ReadonlyRootfs is false"}
+				}
+				return nil
+			},
+		},
+	)
+
+	capabilities := make([]string, 0, len(capabilityRiskScores))
+	for capability := range capabilityRiskScores {
+		capabilities = append(capabilities, capability)
+	}
+	sort.Strings(capabilities)
+	for _, capability := range capabilities {
+		registerContainerRules(capabilityRule(capability, capabilityRiskScores[capability]))
+	}
+}
+
+// capabilityRule builds the rule flagging one risky capability in CapAdd.
+func capabilityRule(capability string, riskScore int) ContainerRule {
+	return ContainerRule{
+		ID:          CapabilityRuleID(capability),
+		Family:      FamilySecurity,
+		Severity:    capabilitySeverity(riskScore),
+		Title:       fmt.Sprintf("Container has the %s capability", capability),
+		Remediation: capabilityRecommendations[capability],
+		Check: func(rc *RuleContext) []string {
+			for _, added := range rc.Container.HostConfig.CapAdd {
+				normalized := normalizeCapability(added)
+				if normalized == capability || normalized == "ALL" {
+					return []string{fmt.Sprintf("HostConfig.CapAdd contains %s", added)}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// CapabilityRuleID returns the rule ID used for a capability, e.g. "cap-sys-admin".
+func CapabilityRuleID(capability string) string {
+	return "cap-" + strings.ReplaceAll(strings.ToLower(normalizeCapability(capability)), "_", "-")
+}
+
+// capabilitySeverity maps the capability risk scores onto severities.
+func capabilitySeverity(riskScore int) Severity {
+	switch {
+	case riskScore >= 5:
+		return SeverityCritical
+	case riskScore == 4:
+		return SeverityHigh
+	case riskScore == 3:
+		return SeverityMedium
+	default:
+		return SeverityLow
+	}
+}
+
+// normalizeCapability strips the CAP_ prefix and upper-cases a capability name.
+func normalizeCapability(capability string) string {
+	return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(capability)), "CAP_")
+}
+
+// isRootUser reports whether a Config.User value resolves to root.
+func isRootUser(user string) bool {
+	name := strings.SplitN(user, ":", 2)[0]
+	return name == "" || name == "root" || name == "0"
+}
+
+// hasNoNewPrivileges checks if the security options block privilege escalation.
+func hasNoNewPrivileges(securityOpts []string) bool {
+	for _, opt := range securityOpts {
+		switch opt {
+		case "no-new-privileges", "no-new-privileges:true", "no-new-privileges=true":
+			return true
+		}
+	}
+	return false
+}
+
+// isUnconfinedProfile reports whether a security option disables seccomp or AppArmor.
+func isUnconfinedProfile(opt string) bool {
+	name, value, found := strings.Cut(opt, "=")
+	if !found {
+		name, value, _ = strings.Cut(opt, ":")
+	}
+	return (name == "seccomp" || name == "apparmor") && value == "unconfined"
+}
@@ -0,0 +1,134 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/docker/client"
+)
+
+// RuntimeKind classifies an OCI runtime by the isolation it provides.
+type RuntimeKind string
+
+const (
+	RuntimeNative  RuntimeKind = "native"  // runc, crun, youki: shares the host kernel
+	RuntimeGVisor  RuntimeKind = "gvisor"  // runsc: user-space kernel
+	RuntimeKata    RuntimeKind = "kata"    // kata-runtime: lightweight VM
+	RuntimeUnknown RuntimeKind = "unknown" // not registered with the daemon or not recognized
+)
+
+// RuntimeInfo describes the OCI runtime a container runs under.
+type RuntimeInfo struct {
+	Name string      `json:"name"`
+	Path string      `json:"path,omitempty"`
+	Type string      `json:"type,omitempty"`
+	Kind RuntimeKind `json:"kind"`
+}
+
+// Sandboxed reports whether the runtime isolates the container from the host kernel.
+func (r RuntimeInfo) Sandboxed() bool {
+	return r.Kind == RuntimeGVisor || r.Kind == RuntimeKata
+}
+
+// String returns the runtime name with its kind, e.g. "runsc (gvisor)".
+func (r RuntimeInfo) String() string {
+	if r.Name == "" {
+		return string(r.Kind)
+	}
+	return fmt.Sprintf("%s (%s)", r.Name, r.Kind)
+}
+
+// DaemonRuntimes holds the runtimes registered with the Docker daemon.
+type DaemonRuntimes struct {
+	Default  string
+	Runtimes map[string]system.RuntimeWithStatus
+}
+
+// GetDaemonRuntimes reads the registered and default runtimes from the daemon.
+func GetDaemonRuntimes(cli *client.Client) (DaemonRuntimes, error) {
+	info, err := cli.Info(context.Background())
+	if err != nil {
+		return DaemonRuntimes{}, fmt.Errorf("error reading daemon info: %v", err)
+	}
+
+	return DaemonRuntimes{
+		Default:  info.DefaultRuntime,
+		Runtimes: info.Runtimes,
+	}, nil
+}
+
+// Resolve returns the runtime used by a container given its HostConfig.Runtime.
+// An empty name means the daemon default runtime.
+func (d DaemonRuntimes) Resolve(name string) RuntimeInfo {
+	if name == "" {
+		name = d.Default
+	}
+	if name == "" {
+		name = "runc"
+	}
+
+	info := RuntimeInfo{Name: name}
+	if registered, ok := d.Runtimes[name]; ok {
+		info.Path = registered.Path
+		info.Type = registered.Type
+	}
+	info.Kind = classifyRuntime(info.Name, info.Path, info.Type)
+	return info
+}
+
+// classifyRuntime recognizes a runtime from its name, binary path or shim type.
+func classifyRuntime(identifiers ...string) RuntimeKind {
+	for _, id := range identifiers {
+		id = strings.ToLower(filepath.Base(id))
+		switch {
+		case strings.Contains(id, "runsc"), strings.Contains(id, "gvisor"):
+			return RuntimeGVisor
+		case strings.Contains(id, "kata"):
+			return RuntimeKata
+		case strings.Contains(id, "runc"), strings.Contains(id, "crun"), strings.Contains(id, "youki"):
+			return RuntimeNative
+		}
+	}
+	return RuntimeUnknown
+}
+
+// severityAdjustment lowers a rule's severity under a sandboxed runtime.
+type severityAdjustment struct {
+	Severity Severity
+	Reason   string
+}
+
+// runtimeSeverityAdjustments lists, per runtime kind, the rules whose risk is
+// reduced because the runtime does not expose the host kernel directly.
+var runtimeSeverityAdjustments = map[RuntimeKind]map[string]severityAdjustment{
+	RuntimeGVisor: {
+		"privileged":     {SeverityHigh, "gVisor does not pass host devices through and serves syscalls from its user-space kernel"},
+		"cap-sys-admin":  {SeverityMedium, "gVisor implements mount and namespace operations in its user-space kernel, not on the host"},
+		"cap-sys-ptrace": {SeverityLow, "gVisor implements ptrace inside the sandbox, so only sandboxed processes can be traced"},
+		"cap-sys-module": {SeverityLow, "gVisor cannot load kernel modules into the host kernel"},
+		"cap-sys-rawio":  {SeverityLow, "gVisor does not expose host I/O ports"},
+		"cap-net-admin":  {SeverityMedium, "gVisor uses its own network stack, so changes stay inside the sandbox"},
+	},
+	RuntimeKata: {
+		"privileged":     {SeverityHigh, "Kata confines privileged containers to the guest VM kernel"},
+		"cap-sys-admin":  {SeverityMedium, "Kata confines the capability to the guest VM kernel"},
+		"cap-sys-ptrace": {SeverityLow, "Kata runs containers in a VM, so only processes in the guest can be traced"},
+		"cap-sys-module": {SeverityMedium, "Kata loads modules into the guest VM kernel, not the host kernel"},
+		"cap-sys-rawio":  {SeverityMedium, "Kata only exposes the guest VM's I/O ports"},
+	},
+}
+
+// adjustSeverityForRuntime applies the runtime severity table to a finding and
+// records the adjustment in its evidence.
+func adjustSeverityForRuntime(finding *Finding, runtime RuntimeInfo) {
+	adjustment, ok := runtimeSeverityAdjustments[runtime.Kind][finding.RuleID]
+	if !ok || adjustment.Severity >= finding.Severity {
+		return
+	}
+
+	finding.Evidence = append(finding.Evidence, fmt.Sprintf("Severity lowered from %s to %s: container runs under %s; %s.", finding.Severity, adjustment.Severity, runtime, adjustment.Reason))
+	finding.Severity = adjustment.Severity
+}
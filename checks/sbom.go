@@ -0,0 +1,427 @@
+package checks
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// sbomToolName identifies this tool as the SBOM author.
+const sbomToolName = "container-checker"
+
+// SBOMReference points to the SBOM documents written for an image.
+type SBOMReference struct {
+	ImageID   string `json:"imageId"`
+	CycloneDX string `json:"cyclonedx"`
+	SPDX      string `json:"spdx"`
+}
+
+// cycloneDXDocument is a CycloneDX 1.5 JSON BOM.
+type cycloneDXDocument struct {
+	BOMFormat    string                `json:"bomFormat"`
+	SpecVersion  string                `json:"specVersion"`
+	SerialNumber string                `json:"serialNumber"`
+	Version      int                   `json:"version"`
+	Metadata     cycloneDXMetadata     `json:"metadata"`
+	Components   []cycloneDXComponent  `json:"components"`
+	Dependencies []cycloneDXDependency `json:"dependencies"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string `json:"timestamp"`
+	Tools     struct {
+		Components []cycloneDXComponent `json:"components"`
+	} `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXComponent struct {
+	Type       string              `json:"type"`
+	BOMRef     string              `json:"bom-ref,omitempty"`
+	Name       string              `json:"name"`
+	Version    string              `json:"version,omitempty"`
+	PURL       string              `json:"purl,omitempty"`
+	Properties []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cycloneDXDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// spdxDocument is an SPDX 2.3 JSON document.
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name                  string            `json:"name"`
+	SPDXID                string            `json:"SPDXID"`
+	VersionInfo           string            `json:"versionInfo,omitempty"`
+	DownloadLocation      string            `json:"downloadLocation"`
+	FilesAnalyzed         bool              `json:"filesAnalyzed"`
+	LicenseConcluded      string            `json:"licenseConcluded"`
+	LicenseDeclared       string            `json:"licenseDeclared"`
+	CopyrightText         string            `json:"copyrightText"`
+	PrimaryPackagePurpose string            `json:"primaryPackagePurpose,omitempty"`
+	ExternalRefs          []spdxExternalRef `json:"externalRefs,omitempty"`
+	Comment               string            `json:"comment,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// BuildCycloneDX creates a CycloneDX 1.5 BOM for an image from its inspect
+// metadata and the packages found in its layers.
+func BuildCycloneDX(imageInspect types.ImageInspect, report *ImageContentReport) ([]byte, error) {
+	serial, err := randomUUID()
+	if err != nil {
+		return nil, err
+	}
+	imageRef := imageInspect.ID
+	doc := cycloneDXDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + serial,
+		Version:      1,
+	}
+	doc.Metadata.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	doc.Metadata.Tools.Components = []cycloneDXComponent{{Type: "application", Name: sbomToolName}}
+	doc.Metadata.Component = cycloneDXComponent{
+		Type:       "container",
+		BOMRef:     imageRef,
+		Name:       imageDisplayName(imageInspect),
+		Version:    imageInspect.ID,
+		PURL:       imagePURL(imageInspect),
+		Properties: imageProperties(imageInspect),
+	}
+
+	dependency := cycloneDXDependency{Ref: imageRef, DependsOn: []string{}}
+	if report.OS.ID != "" {
+		osRef := "os:" + report.OS.ID + "@" + report.OS.VersionID
+		doc.Components = append(doc.Components, cycloneDXComponent{
+			Type:    "operating-system",
+			BOMRef:  osRef,
+			Name:    report.OS.ID,
+			Version: report.OS.VersionID,
+		})
+		dependency.DependsOn = append(dependency.DependsOn, osRef)
+	}
+
+	seen := make(map[string]bool)
+	for _, pkg := range report.Packages {
+		purl := PackageURL(pkg, report.OS)
+		ref := purl
+		if pkg.Location != "" {
+			ref += "#" + pkg.Location
+		}
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+
+		component := cycloneDXComponent{
+			Type:    "library",
+			BOMRef:  ref,
+			Name:    pkg.Name,
+			Version: pkg.Version,
+			PURL:    purl,
+			Properties: []cycloneDXProperty{
+				{Name: sbomToolName + ":package:type", Value: pkg.Type},
+			},
+		}
+		if pkg.Location != "" {
+			component.Properties = append(component.Properties, cycloneDXProperty{Name: sbomToolName + ":location", Value: pkg.Location})
+		}
+		doc.Components = append(doc.Components, component)
+		dependency.DependsOn = append(dependency.DependsOn, ref)
+	}
+	doc.Dependencies = []cycloneDXDependency{dependency}
+
+	return marshalSBOM(doc)
+}
+
+// BuildSPDX creates an SPDX 2.3 document for an image from its inspect
+// metadata and the packages found in its layers.
+func BuildSPDX(imageInspect types.ImageInspect, report *ImageContentReport) ([]byte, error) {
+	namespace, err := randomUUID()
+	if err != nil {
+		return nil, err
+	}
+	name := imageDisplayName(imageInspect)
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              name,
+		DocumentNamespace: fmt.Sprintf("https://%s/spdx/%s-%s", sbomToolName, url.PathEscape(name), namespace),
+		CreationInfo: spdxCreationInfo{
+			Created:  time.Now().UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: " + sbomToolName},
+		},
+	}
+
+	imagePackage := spdxPackage{
+		Name:                  name,
+		SPDXID:                "SPDXRef-Image",
+		VersionInfo:           imageInspect.ID,
+		DownloadLocation:      "NOASSERTION",
+		LicenseConcluded:      "NOASSERTION",
+		LicenseDeclared:       "NOASSERTION",
+		CopyrightText:         "NOASSERTION",
+		PrimaryPackagePurpose: "CONTAINER",
+		Comment:               fmt.Sprintf("os=%s architecture=%s created=%s", imageInspect.Os, imageInspect.Architecture, imageInspect.Created),
+	}
+	if purl := imagePURL(imageInspect); purl != "" {
+		imagePackage.ExternalRefs = []spdxExternalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: purl}}
+	}
+	doc.Packages = append(doc.Packages, imagePackage)
+	doc.Relationships = append(doc.Relationships, spdxRelationship{
+		SPDXElementID:      "SPDXRef-DOCUMENT",
+		RelationshipType:   "DESCRIBES",
+		RelatedSPDXElement: "SPDXRef-Image",
+	})
+
+	seen := make(map[string]bool)
+	for _, pkg := range report.Packages {
+		purl := PackageURL(pkg, report.OS)
+		key := pkg.Type + "-" + pkg.Name + "-" + pkg.Version + "-" + pkg.Location
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		id := spdxPackageID(key)
+
+		spdxPkg := spdxPackage{
+			Name:             pkg.Name,
+			SPDXID:           id,
+			VersionInfo:      pkg.Version,
+			DownloadLocation: "NOASSERTION",
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  "NOASSERTION",
+			CopyrightText:    "NOASSERTION",
+			ExternalRefs:     []spdxExternalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: purl}},
+		}
+		if pkg.Location != "" {
+			spdxPkg.Comment = "Found at " + pkg.Location
+		}
+		doc.Packages = append(doc.Packages, spdxPkg)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      "SPDXRef-Image",
+			RelationshipType:   "CONTAINS",
+			RelatedSPDXElement: id,
+		})
+	}
+
+	return marshalSBOM(doc)
+}
+
+// WriteSBOMs writes the CycloneDX and SPDX documents for an image into dir
+// and returns their file names.
+func WriteSBOMs(dir string, imageInspect types.ImageInspect, report *ImageContentReport) (*SBOMReference, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating SBOM directory %s: %v", dir, err)
+	}
+
+	base := strings.TrimPrefix(imageInspect.ID, "sha256:")
+	ref := &SBOMReference{
+		ImageID:   imageInspect.ID,
+		CycloneDX: base + ".cdx.json",
+		SPDX:      base + ".spdx.json",
+	}
+
+	cyclonedx, err := BuildCycloneDX(imageInspect, report)
+	if err != nil {
+		return nil, fmt.Errorf("error building CycloneDX SBOM: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ref.CycloneDX), cyclonedx, 0o644); err != nil {
+		return nil, fmt.Errorf("error writing CycloneDX SBOM: %v", err)
+	}
+
+	spdx, err := BuildSPDX(imageInspect, report)
+	if err != nil {
+		return nil, fmt.Errorf("error building SPDX SBOM: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ref.SPDX), spdx, 0o644); err != nil {
+		return nil, fmt.Errorf("error writing SPDX SBOM: %v", err)
+	}
+
+	return ref, nil
+}
+
+// marshalSBOM encodes an SBOM document without escaping the & in package URL
+// qualifiers.
+func marshalSBOM(doc interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// PackageURL returns the package URL (purl) identifying a package.
+func PackageURL(pkg Package, release OSRelease) string {
+	version := url.PathEscape(pkg.Version)
+	switch pkg.Type {
+	case PackageTypeAPK, PackageTypeDeb, PackageTypeRPM:
+		distro := release.ID
+		if distro == "" {
+			distro = map[string]string{PackageTypeAPK: "alpine", PackageTypeDeb: "debian", PackageTypeRPM: "redhat"}[pkg.Type]
+		}
+		qualifiers := url.Values{}
+		if pkg.Arch != "" {
+			qualifiers.Set("arch", pkg.Arch)
+		}
+		if release.VersionID != "" {
+			qualifiers.Set("distro", release.ID+"-"+release.VersionID)
+		}
+		if pkg.Type == PackageTypeRPM {
+			if epoch, rest, ok := strings.Cut(pkg.Version, ":"); ok {
+				qualifiers.Set("epoch", epoch)
+				version = url.PathEscape(rest)
+			}
+		}
+		purl := fmt.Sprintf("pkg:%s/%s/%s@%s", pkg.Type, url.PathEscape(distro), url.PathEscape(pkg.Name), version)
+		if len(qualifiers) > 0 {
+			purl += "?" + qualifiers.Encode()
+		}
+		return purl
+	case PackageTypeGo:
+		return fmt.Sprintf("pkg:golang/%s@%s", escapePURLPath(pkg.Name), version)
+	case PackageTypePython:
+		return fmt.Sprintf("pkg:pypi/%s@%s", url.PathEscape(normalizePackageName("PyPI", pkg.Name)), version)
+	case PackageTypeNPM:
+		if scope, name, ok := strings.Cut(pkg.Name, "/"); ok && strings.HasPrefix(scope, "@") {
+			return fmt.Sprintf("pkg:npm/%%40%s/%s@%s", url.PathEscape(scope[1:]), url.PathEscape(name), version)
+		}
+		return fmt.Sprintf("pkg:npm/%s@%s", url.PathEscape(pkg.Name), version)
+	case PackageTypeJava:
+		if group, artifact, ok := strings.Cut(pkg.Name, ":"); ok {
+			return fmt.Sprintf("pkg:maven/%s/%s@%s", url.PathEscape(group), url.PathEscape(artifact), version)
+		}
+		return fmt.Sprintf("pkg:maven/%s@%s", url.PathEscape(pkg.Name), version)
+	}
+	return fmt.Sprintf("pkg:generic/%s@%s", url.PathEscape(pkg.Name), version)
+}
+
+// escapePURLPath escapes each segment of a slash-separated purl name.
+func escapePURLPath(name string) string {
+	segments := strings.Split(name, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// imagePURL returns an OCI package URL for an image pulled from a registry.
+func imagePURL(imageInspect types.ImageInspect) string {
+	if len(imageInspect.RepoDigests) == 0 {
+		return ""
+	}
+	repository, digest, ok := strings.Cut(imageInspect.RepoDigests[0], "@")
+	if !ok {
+		return ""
+	}
+	name := repository[strings.LastIndex(repository, "/")+1:]
+	qualifiers := url.Values{}
+	qualifiers.Set("repository_url", repository)
+	if imageInspect.Architecture != "" {
+		qualifiers.Set("arch", imageInspect.Architecture)
+	}
+	return fmt.Sprintf("pkg:oci/%s@%s?%s", url.PathEscape(name), url.PathEscape(digest), qualifiers.Encode())
+}
+
+// imageDisplayName returns the first tag of an image, or its ID when untagged.
+func imageDisplayName(imageInspect types.ImageInspect) string {
+	if len(imageInspect.RepoTags) > 0 {
+		return imageInspect.RepoTags[0]
+	}
+	return imageInspect.ID
+}
+
+// imageProperties describes the image metadata as CycloneDX properties.
+func imageProperties(imageInspect types.ImageInspect) []cycloneDXProperty {
+	var properties []cycloneDXProperty
+	add := func(name, value string) {
+		if value != "" {
+			properties = append(properties, cycloneDXProperty{Name: sbomToolName + ":image:" + name, Value: value})
+		}
+	}
+	add("os", imageInspect.Os)
+	add("architecture", imageInspect.Architecture)
+	add("created", imageInspect.Created)
+	for _, tag := range imageInspect.RepoTags {
+		add("repoTag", tag)
+	}
+	for _, digest := range imageInspect.RepoDigests {
+		add("repoDigest", digest)
+	}
+	return properties
+}
+
+var spdxIDInvalid = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// spdxID turns an arbitrary string into a valid SPDX element identifier.
+func spdxID(id string) string {
+	return strings.Trim(spdxIDInvalid.ReplaceAllString(id, "-"), "-")
+}
+
+// spdxPackageID returns the SPDX identifier of a package. Sanitizing can map
+// different packages, such as foo_bar and foo-bar, onto the same string, so
+// a short hash of the original key keeps the identifiers unique.
+func spdxPackageID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return spdxID("SPDXRef-Package-"+key) + "-" + hex.EncodeToString(sum[:4])
+}
+
+// randomUUID returns a random RFC 4122 version 4 UUID. Both SBOM formats
+// require a new serial number or namespace for every generated document.
+func randomUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("error generating UUID: %v", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,224 @@
+package checks
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// SecretMatch is a credential found in a container or image configuration.
+// Only the location and a redacted preview are kept, never the value itself.
+type SecretMatch struct {
+	Source  string `json:"source"` // env, cmd, entrypoint or label
+	Name    string `json:"name"`   // variable or label name, or argument position
+	Kind    string `json:"kind"`
+	Preview string `json:"preview"`
+}
+
+// String formats the match for evidence and console output.
+func (m SecretMatch) String() string {
+	return fmt.Sprintf("%s %s: %s %s", m.Source, m.Name, m.Kind, m.Preview)
+}
+
+// secretPattern recognizes a credential by the shape of its value. Prefix
+// matches the fixed start of the credential, which tells its kind and is
+// kept when it is redacted.
+type secretPattern struct {
+	Kind   string
+	Regex  *regexp.Regexp
+	Prefix *regexp.Regexp
+}
+
+var secretValuePatterns = []secretPattern{
+	{"AWS access key ID", regexp.MustCompile(`\b(A3T[A-Z0-9]|AKIA|ASIA|AGPA|AIDA|AROA|AIPA|ANPA|ANVA)[A-Z2-7]{16}\b`), regexp.MustCompile(`^(A3T|AKIA|ASIA|AGPA|AIDA|AROA|AIPA|ANPA|ANVA)`)},
+	{"GitHub token", regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`), regexp.MustCompile(`^(gh[pousr]_|github_pat_)`)},
+	{"GitLab token", regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}\b`), regexp.MustCompile(`^glpat-`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`), regexp.MustCompile(`^xox[abposr]-`)},
+	{"private key", regexp.MustCompile(`-----BEGIN ([A-Z]+ )?PRIVATE KEY-----`), nil},
+	{"JDBC URL with password", regexp.MustCompile(`(?i)jdbc:[a-z0-9:]+//[^\s]*[?&;]password=[^&;\s]+`), nil},
+	{"URL with embedded credentials", regexp.MustCompile(`(?i)\b[a-z][a-z0-9+.-]*://[^/\s:@]+:[^/\s@]+@[^\s]+`), nil},
+}
+
+// secretNamePattern matches variable names that conventionally hold secrets.
+var secretNamePattern = regexp.MustCompile(`(?i)(^|_)(PASSWORD|PASSWD|PWD|SECRET|TOKEN|API_?KEY|ACCESS_?KEY|PRIVATE_?KEY|CREDENTIALS?)$`)
+
+// secretFlagPattern matches command-line flags that carry a secret value.
+var secretFlagPattern = regexp.MustCompile(`(?i)^--?[a-z0-9_-]*(password|passwd|token|secret|api[-_]?key)[a-z0-9_-]*$`)
+
+const (
+	minSecretLength  = 8
+	minSecretEntropy = 3.0
+)
+
+// ScanConfigSecrets looks for credentials in environment variables, command
+// arguments and labels.
+func ScanConfigSecrets(env, cmd, entrypoint []string, labels map[string]string) []SecretMatch {
+	var matches []SecretMatch
+
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		matches = append(matches, scanNamedValue("env", name, value)...)
+	}
+
+	matches = append(matches, scanArguments("entrypoint", entrypoint)...)
+	matches = append(matches, scanArguments("cmd", cmd)...)
+
+	labelNames := make([]string, 0, len(labels))
+	for name := range labels {
+		labelNames = append(labelNames, name)
+	}
+	sort.Strings(labelNames)
+	for _, name := range labelNames {
+		matches = append(matches, scanNamedValue("label", name, labels[name])...)
+	}
+
+	return matches
+}
+
+// ScanContainerSecrets scans a container's configuration for credentials.
+func ScanContainerSecrets(containerJSON types.ContainerJSON) []SecretMatch {
+	if containerJSON.Config == nil {
+		return nil
+	}
+	config := containerJSON.Config
+	return ScanConfigSecrets(config.Env, config.Cmd, config.Entrypoint, config.Labels)
+}
+
+// ScanImageSecrets scans an image's configuration for credentials.
+func ScanImageSecrets(imageInspect types.ImageInspect) []SecretMatch {
+	if imageInspect.Config == nil {
+		return nil
+	}
+	config := imageInspect.Config
+	return ScanConfigSecrets(config.Env, config.Cmd, config.Entrypoint, config.Labels)
+}
+
+// scanNamedValue checks a name=value pair against the value patterns and, for
+// secret-looking names, the entropy of the value.
+func scanNamedValue(source, name, value string) []SecretMatch {
+	if kind, found := matchSecretValue(value); found != "" {
+		return []SecretMatch{{Source: source, Name: name, Kind: kind, Preview: RedactSecret(found)}}
+	}
+
+	if isSecretName(name) && looksRandom(value) {
+		return []SecretMatch{{Source: source, Name: name, Kind: "high-entropy value", Preview: RedactSecret(value)}}
+	}
+	return nil
+}
+
+// isSecretName reports whether a variable or label name conventionally
+// holds a secret.
+func isSecretName(name string) bool {
+	key := strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(name))
+	return secretNamePattern.MatchString(key)
+}
+
+// isSecretValue reports whether a name=value pair must be masked wherever it
+// is shown. Unlike scanNamedValue, a secret-looking name is enough: a weak
+// password such as "example" is still a password, it is just not worth a
+// finding on its own.
+func isSecretValue(name, value string) bool {
+	if _, found := matchSecretValue(value); found != "" {
+		return true
+	}
+	return value != "" && isSecretName(name)
+}
+
+// scanArguments checks command arguments, including --password=value and
+// --password value forms.
+func scanArguments(source string, args []string) []SecretMatch {
+	var matches []SecretMatch
+	for i, arg := range args {
+		position := fmt.Sprintf("arg[%d]", i)
+
+		if kind, found := matchSecretValue(arg); found != "" {
+			matches = append(matches, SecretMatch{Source: source, Name: position, Kind: kind, Preview: RedactSecret(found)})
+			continue
+		}
+
+		flag, value, hasValue := strings.Cut(arg, "=")
+		if !secretFlagPattern.MatchString(flag) {
+			continue
+		}
+		if !hasValue && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			value, hasValue = args[i+1], true
+		}
+		if hasValue && value != "" {
+			matches = append(matches, SecretMatch{Source: source, Name: fmt.Sprintf("%s %s", position, flag), Kind: "secret passed as argument", Preview: RedactSecret(value)})
+		}
+	}
+	return matches
+}
+
+// matchSecretValue returns the kind and matched text of the first value pattern found.
+func matchSecretValue(value string) (string, string) {
+	for _, p := range secretValuePatterns {
+		if found := p.Regex.FindString(value); found != "" {
+			return p.Kind, found
+		}
+	}
+	return "", ""
+}
+
+// looksRandom reports whether a value is long and random enough to be a real
+// credential rather than a placeholder or a file reference.
+func looksRandom(value string) bool {
+	if len(value) < minSecretLength || strings.HasPrefix(value, "/") || strings.HasPrefix(value, "$") {
+		return false
+	}
+	return shannonEntropy(value) >= minSecretEntropy
+}
+
+// shannonEntropy returns the entropy of a string in bits per character.
+func shannonEntropy(value string) float64 {
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range value {
+		counts[r]++
+		total++
+	}
+
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// RedactSecret masks a secret, keeping only its length. A token whose kind
+// is told by a fixed prefix, such as AKIA or ghp_, keeps that prefix.
+func RedactSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	prefix := ""
+	for _, p := range secretValuePatterns {
+		if p.Prefix != nil && p.Regex.FindString(value) == value {
+			prefix = p.Prefix.FindString(value)
+			break
+		}
+	}
+	return fmt.Sprintf("%s******** (%d chars)", prefix, len([]rune(value)))
+}
+
+func init() {
+	registerContainerRules(ContainerRule{
+		ID:          "secrets-in-config",
+		Family:      FamilySecurity,
+		Severity:    SeverityHigh,
+		Title:       "Credentials exposed in container configuration",
+		Remediation: "Move credentials out of environment variables, arguments and labels into Docker secrets or a mounted secrets file.",
+		Check: func(rc *RuleContext) []string {
+			var evidence []string
+			for _, match := range ScanContainerSecrets(rc.Container) {
+				evidence = append(evidence, match.String())
+			}
+			return evidence
+		},
+	})
+}
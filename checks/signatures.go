@@ -0,0 +1,818 @@
+package checks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// SignatureStatus is the outcome of verifying an image's signatures.
+type SignatureStatus string
+
+const (
+	SignatureVerified     SignatureStatus = "signed and verified"
+	SignatureUnsigned     SignatureStatus = "unsigned"
+	SignatureInvalid      SignatureStatus = "signature invalid"
+	SignatureUnverifiable SignatureStatus = "signature unverifiable"
+)
+
+// SignatureResult is the signature status of an image digest.
+type SignatureResult struct {
+	Digest string          `json:"digest"`
+	Status SignatureStatus `json:"status"`
+	Format string          `json:"format,omitempty"` // cosign or notation
+	Signer string          `json:"signer,omitempty"`
+	Detail string          `json:"detail,omitempty"`
+}
+
+// Media and artifact types of the signature formats that can be verified.
+const (
+	cosignSimpleSigningType   = "application/vnd.dev.cosign.simplesigning.v1+json"
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+	cosignCertAnnotation      = "dev.sigstore.cosign/certificate"
+	cosignChainAnnotation     = "dev.sigstore.cosign/chain"
+	notationArtifactType      = "application/vnd.cncf.notary.signature"
+	notationJWSType           = "application/jose+json"
+	notationCOSEType          = "application/cose"
+	ociIndexType              = "application/vnd.oci.image.index.v1+json"
+	ociRefNameAnnotation      = "org.opencontainers.image.ref.name"
+)
+
+// Sigstore certificate extensions holding the OIDC issuer that authenticated
+// the signer: the original raw string and its DER-encoded replacement.
+var (
+	fulcioIssuerV1OID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	fulcioIssuerV2OID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// SignerPolicy restricts which certificate identities may sign images. A
+// certificate signs for an identity through its email or URI subject
+// alternative names, or its subject DN; keyless certificates also name the
+// OIDC issuer that authenticated the signer.
+type SignerPolicy struct {
+	Identities []string
+	Issuer     string
+}
+
+// allows reports whether a signing certificate matches the policy.
+func (p SignerPolicy) allows(cert *x509.Certificate) error {
+	identities := []string{cert.Subject.String()}
+	identities = append(identities, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	matched := false
+	for _, identity := range identities {
+		for _, allowed := range p.Identities {
+			if identity == allowed {
+				matched = true
+			}
+		}
+	}
+	if !matched {
+		return fmt.Errorf("signer %s is not a trusted identity", certificateSigner(cert))
+	}
+	if p.Issuer != "" {
+		if issuer := certificateIssuer(cert); issuer != p.Issuer {
+			return fmt.Errorf("signer %s was authenticated by issuer %q, not %q", certificateSigner(cert), issuer, p.Issuer)
+		}
+	}
+	return nil
+}
+
+// unverifiableError reports a signature that verifies with a trusted
+// identity, but whose certificate has expired since. Keyless certificates
+// live for minutes, so whether the signature was made while the certificate
+// was valid can only be proven by a transparency log, which is not consulted.
+type unverifiableError struct {
+	signer string
+	reason string
+}
+
+func (e *unverifiableError) Error() string {
+	return e.reason
+}
+
+// ociDescriptor references a blob in an OCI image layout.
+type ociDescriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// ociManifest holds the fields of an image manifest or index used to find
+// and read signatures.
+type ociManifest struct {
+	MediaType    string          `json:"mediaType"`
+	ArtifactType string          `json:"artifactType"`
+	Config       ociDescriptor   `json:"config"`
+	Layers       []ociDescriptor `json:"layers"`
+	Manifests    []ociDescriptor `json:"manifests"`
+	Subject      *ociDescriptor  `json:"subject"`
+}
+
+// SignatureVerifier checks image signatures stored in a local OCI image
+// layout directory, which stands in for the registry the images come from.
+// Cosign signatures are found by their sha256-<digest>.sig tag or as
+// referrers, Notary v2 signatures as OCI referrers of the image digest.
+//
+// Results are cached by digest until the layout's index.json changes, since
+// every signature added to the layout is listed there.
+type SignatureVerifier struct {
+	layoutDir string
+	keys      []crypto.PublicKey
+	roots     *x509.CertPool
+	hasRoots  bool
+	policy    SignerPolicy
+
+	mu           sync.Mutex
+	results      map[string]SignatureResult
+	indexModTime time.Time
+}
+
+// NewSignatureVerifier creates a verifier for the signatures in layoutDir,
+// trusting the public keys and certificates in the PEM files at trustPath,
+// which may be a file or a directory. Signatures made with a certificate
+// must also match the signer policy, which is required when certificates
+// are trusted: a root such as Fulcio's certifies anyone.
+func NewSignatureVerifier(layoutDir, trustPath string, policy SignerPolicy) (*SignatureVerifier, error) {
+	if _, err := os.Stat(filepath.Join(layoutDir, "index.json")); err != nil {
+		return nil, fmt.Errorf("error opening signature store %s: %v", layoutDir, err)
+	}
+
+	v := &SignatureVerifier{layoutDir: layoutDir, roots: x509.NewCertPool(), policy: policy, results: make(map[string]SignatureResult)}
+	files := []string{trustPath}
+	if info, err := os.Stat(trustPath); err != nil {
+		return nil, fmt.Errorf("error reading trust material %s: %v", trustPath, err)
+	} else if info.IsDir() {
+		entries, err := os.ReadDir(trustPath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading trust material %s: %v", trustPath, err)
+		}
+		files = files[:0]
+		for _, e := range entries {
+			if !e.IsDir() {
+				files = append(files, filepath.Join(trustPath, e.Name()))
+			}
+		}
+	}
+
+	for _, file := range files {
+		if err := v.addTrustFile(file); err != nil {
+			return nil, err
+		}
+	}
+	if len(v.keys) == 0 {
+		return nil, fmt.Errorf("no public keys or certificates found in %s", trustPath)
+	}
+	if v.hasRoots && len(policy.Identities) == 0 {
+		return nil, fmt.Errorf("trusted certificates in %s require a signer identity policy", trustPath)
+	}
+	return v, nil
+}
+
+// addTrustFile loads the PEM public keys and certificates of a file.
+func (v *SignatureVerifier) addTrustFile(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("error reading trust material %s: %v", file, err)
+	}
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil
+		}
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return fmt.Errorf("error parsing public key in %s: %v", file, err)
+			}
+			v.keys = append(v.keys, key)
+		case "RSA PUBLIC KEY":
+			key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+			if err != nil {
+				return fmt.Errorf("error parsing public key in %s: %v", file, err)
+			}
+			v.keys = append(v.keys, key)
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return fmt.Errorf("error parsing certificate in %s: %v", file, err)
+			}
+			v.roots.AddCert(cert)
+			v.hasRoots = true
+			v.keys = append(v.keys, cert.PublicKey)
+		}
+	}
+}
+
+// VerifyImage verifies the signatures of the registry digests of an image.
+// An image without RepoDigests was never pulled from a registry and so has
+// no digest a signature could refer to.
+func (v *SignatureVerifier) VerifyImage(imageInspect *types.ImageInspect) (SignatureResult, error) {
+	var results []SignatureResult
+	seen := make(map[string]bool)
+	for _, repoDigest := range imageInspect.RepoDigests {
+		_, digest, ok := strings.Cut(repoDigest, "@")
+		if !ok || seen[digest] {
+			continue
+		}
+		seen[digest] = true
+
+		result, err := v.Verify(digest)
+		if err != nil {
+			return SignatureResult{}, err
+		}
+		if result.Status == SignatureVerified {
+			return result, nil
+		}
+		results = append(results, result)
+	}
+
+	if len(results) == 0 {
+		return SignatureResult{Status: SignatureUnsigned, Detail: "image has no registry digest to verify"}, nil
+	}
+	for _, status := range []SignatureStatus{SignatureInvalid, SignatureUnverifiable} {
+		for _, result := range results {
+			if result.Status == status {
+				return result, nil
+			}
+		}
+	}
+	return results[0], nil
+}
+
+// Verify checks every signature stored for a manifest digest. The digest is
+// verified when any signature is valid for a trusted key, unverifiable when
+// the only valid signatures were made with certificates that have expired
+// since, and invalid when signatures exist but none of them verify.
+func (v *SignatureVerifier) Verify(digest string) (SignatureResult, error) {
+	info, err := os.Stat(filepath.Join(v.layoutDir, "index.json"))
+	if err != nil {
+		return SignatureResult{Digest: digest, Status: SignatureUnsigned}, fmt.Errorf("error reading signature store %s: %v", v.layoutDir, err)
+	}
+	v.mu.Lock()
+	if !info.ModTime().Equal(v.indexModTime) {
+		v.results = make(map[string]SignatureResult)
+		v.indexModTime = info.ModTime()
+	}
+	result, ok := v.results[digest]
+	v.mu.Unlock()
+	if ok {
+		return result, nil
+	}
+
+	result, err = v.verify(digest)
+	if err != nil {
+		return result, err
+	}
+	v.mu.Lock()
+	v.results[digest] = result
+	v.mu.Unlock()
+	return result, nil
+}
+
+func (v *SignatureVerifier) verify(digest string) (SignatureResult, error) {
+	result := SignatureResult{Digest: digest, Status: SignatureUnsigned}
+
+	signatures, err := v.findSignatures(digest)
+	if err != nil {
+		return result, err
+	}
+
+	var failures []string
+	var unverifiable *unverifiableError
+	for _, sig := range signatures {
+		var signer, format string
+		var err error
+		if sig.isNotation() {
+			format = "notation"
+			signer, err = v.verifyNotation(sig, digest)
+		} else {
+			format = "cosign"
+			signer, err = v.verifyCosign(sig, digest)
+		}
+		if err == nil {
+			result.Status = SignatureVerified
+			result.Format = format
+			result.Signer = signer
+			result.Detail = ""
+			return result, nil
+		}
+		if result.Format == "" {
+			result.Format = format
+		}
+		if errors.As(err, &unverifiable) {
+			result.Format = format
+			continue
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", format, err))
+	}
+
+	if unverifiable != nil {
+		result.Status = SignatureUnverifiable
+		result.Signer = unverifiable.signer
+		result.Detail = unverifiable.reason
+	} else if len(failures) > 0 {
+		result.Status = SignatureInvalid
+		result.Detail = strings.Join(failures, "; ")
+	}
+	return result, nil
+}
+
+// findSignatures returns the signature manifests for a digest: the cosign
+// signature tag and every manifest whose subject is the digest, including
+// those listed by a referrers tag index.
+func (v *SignatureVerifier) findSignatures(digest string) ([]*ociManifest, error) {
+	var index ociManifest
+	if err := v.readJSONFile(filepath.Join(v.layoutDir, "index.json"), &index); err != nil {
+		return nil, err
+	}
+
+	cosignTag := strings.Replace(digest, ":", "-", 1) + ".sig"
+	var descriptors []ociDescriptor
+	for _, desc := range index.Manifests {
+		if desc.MediaType != ociIndexType {
+			descriptors = append(descriptors, desc)
+			continue
+		}
+		var nested ociManifest
+		if err := v.readBlobJSON(desc.Digest, &nested); err != nil {
+			return nil, err
+		}
+		descriptors = append(descriptors, nested.Manifests...)
+	}
+
+	var signatures []*ociManifest
+	seen := make(map[string]bool)
+	for _, desc := range descriptors {
+		if seen[desc.Digest] || desc.Digest == digest {
+			continue
+		}
+		seen[desc.Digest] = true
+
+		isCosignTag := strings.HasSuffix(desc.Annotations[ociRefNameAnnotation], cosignTag)
+		if desc.ArtifactType == "" && !isCosignTag && !strings.HasSuffix(desc.MediaType, "manifest.v1+json") {
+			continue
+		}
+
+		var manifest ociManifest
+		if err := v.readBlobJSON(desc.Digest, &manifest); err != nil {
+			return nil, err
+		}
+		refersToDigest := isCosignTag || (manifest.Subject != nil && manifest.Subject.Digest == digest)
+		if refersToDigest && manifest.isSignature() {
+			signatures = append(signatures, &manifest)
+		}
+	}
+	return signatures, nil
+}
+
+// isNotation reports whether a manifest is a Notary v2 signature.
+func (m *ociManifest) isNotation() bool {
+	return m.ArtifactType == notationArtifactType || m.Config.MediaType == notationArtifactType
+}
+
+// isSignature reports whether a manifest holds a signature, as opposed to
+// other referrers of an image such as SBOMs or attestations.
+func (m *ociManifest) isSignature() bool {
+	if m.isNotation() {
+		return true
+	}
+	for _, layer := range m.Layers {
+		if layer.MediaType == cosignSimpleSigningType {
+			return true
+		}
+	}
+	return false
+}
+
+// simpleSigningPayload is the payload signed by cosign.
+type simpleSigningPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// verifyCosign verifies the simple signing layers of a cosign signature
+// manifest and returns the signer.
+func (v *SignatureVerifier) verifyCosign(manifest *ociManifest, digest string) (string, error) {
+	var lastErr error = errors.New("no signature layers")
+	for _, layer := range manifest.Layers {
+		if layer.MediaType != cosignSimpleSigningType {
+			continue
+		}
+		signer, err := v.verifyCosignLayer(layer, digest)
+		if err == nil {
+			return signer, nil
+		}
+		lastErr = err
+	}
+	return "", lastErr
+}
+
+func (v *SignatureVerifier) verifyCosignLayer(layer ociDescriptor, digest string) (string, error) {
+	payload, err := v.readBlob(layer.Digest)
+	if err != nil {
+		return "", err
+	}
+	signature, err := base64.StdEncoding.DecodeString(layer.Annotations[cosignSignatureAnnotation])
+	if err != nil || len(signature) == 0 {
+		return "", errors.New("missing or malformed signature annotation")
+	}
+
+	var signed simpleSigningPayload
+	if err := json.Unmarshal(payload, &signed); err != nil {
+		return "", fmt.Errorf("malformed payload: %v", err)
+	}
+	if signed.Critical.Image.DockerManifestDigest != digest {
+		return "", fmt.Errorf("payload signs %s, not %s", signed.Critical.Image.DockerManifestDigest, digest)
+	}
+
+	// A signature made with a certificate must chain to a trusted root;
+	// otherwise it must verify with one of the trusted keys.
+	if certPEM := layer.Annotations[cosignCertAnnotation]; certPEM != "" {
+		cert, expired, err := v.verifyCertificateChain(parsePEMCertificates([]byte(certPEM)), parsePEMCertificates([]byte(layer.Annotations[cosignChainAnnotation])))
+		if err != nil {
+			return "", err
+		}
+		if err := verifySignature(cert.PublicKey, signatureAlgorithm{hash: crypto.SHA256}, payload, signature); err != nil {
+			return "", err
+		}
+		if expired != nil {
+			return "", expired
+		}
+		return certificateSigner(cert), nil
+	}
+
+	for _, key := range v.keys {
+		if verifySignature(key, signatureAlgorithm{hash: crypto.SHA256}, payload, signature) == nil {
+			return keyFingerprint(key), nil
+		}
+	}
+	return "", errors.New("signature does not verify with any trusted key")
+}
+
+// jwsEnvelope is a Notary v2 signature in JWS JSON serialization.
+type jwsEnvelope struct {
+	Payload   string `json:"payload"`
+	Protected string `json:"protected"`
+	Header    struct {
+		X5C []string `json:"x5c"`
+	} `json:"header"`
+	Signature string `json:"signature"`
+}
+
+// notationPayload is the payload signed by notation.
+type notationPayload struct {
+	TargetArtifact ociDescriptor `json:"targetArtifact"`
+}
+
+// signatureAlgorithm describes how a signature was computed.
+type signatureAlgorithm struct {
+	hash     crypto.Hash
+	pss      bool // RSA-PSS rather than PKCS #1 v1.5
+	rawECDSA bool // r||s rather than ASN.1
+}
+
+// jwsAlgorithms are the JWS algorithms notation signs with.
+var jwsAlgorithms = map[string]signatureAlgorithm{
+	"PS256": {hash: crypto.SHA256, pss: true},
+	"PS384": {hash: crypto.SHA384, pss: true},
+	"PS512": {hash: crypto.SHA512, pss: true},
+	"ES256": {hash: crypto.SHA256, rawECDSA: true},
+	"ES384": {hash: crypto.SHA384, rawECDSA: true},
+	"ES512": {hash: crypto.SHA512, rawECDSA: true},
+}
+
+// verifyNotation verifies a Notary v2 signature manifest and returns the signer.
+func (v *SignatureVerifier) verifyNotation(manifest *ociManifest, digest string) (string, error) {
+	for _, layer := range manifest.Layers {
+		switch layer.MediaType {
+		case notationJWSType:
+			return v.verifyNotationJWS(layer, digest)
+		case notationCOSEType:
+			return "", errors.New("COSE signature envelopes are not supported")
+		}
+	}
+	return "", errors.New("no signature envelope")
+}
+
+func (v *SignatureVerifier) verifyNotationJWS(layer ociDescriptor, digest string) (string, error) {
+	var envelope jwsEnvelope
+	if err := v.readBlobJSON(layer.Digest, &envelope); err != nil {
+		return "", err
+	}
+
+	protected, err := base64.RawURLEncoding.DecodeString(envelope.Protected)
+	if err != nil {
+		return "", fmt.Errorf("malformed protected header: %v", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(protected, &header); err != nil {
+		return "", fmt.Errorf("malformed protected header: %v", err)
+	}
+	alg, ok := jwsAlgorithms[header.Alg]
+	if !ok {
+		return "", fmt.Errorf("unsupported algorithm %q", header.Alg)
+	}
+
+	rawPayload, err := base64.RawURLEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return "", fmt.Errorf("malformed payload: %v", err)
+	}
+	var payload notationPayload
+	if err := json.Unmarshal(rawPayload, &payload); err != nil {
+		return "", fmt.Errorf("malformed payload: %v", err)
+	}
+	if payload.TargetArtifact.Digest != digest {
+		return "", fmt.Errorf("payload signs %s, not %s", payload.TargetArtifact.Digest, digest)
+	}
+
+	var chain []*x509.Certificate
+	for _, encoded := range envelope.Header.X5C {
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", fmt.Errorf("malformed certificate chain: %v", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return "", fmt.Errorf("malformed certificate chain: %v", err)
+		}
+		chain = append(chain, cert)
+	}
+	leaf, expired, err := v.verifyCertificateChain(chain, nil)
+	if err != nil {
+		return "", err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(envelope.Signature)
+	if err != nil {
+		return "", fmt.Errorf("malformed signature: %v", err)
+	}
+	if err := verifySignature(leaf.PublicKey, alg, []byte(envelope.Protected+"."+envelope.Payload), signature); err != nil {
+		return "", err
+	}
+	if expired != nil {
+		return "", expired
+	}
+	return certificateSigner(leaf), nil
+}
+
+// verifyCertificateChain checks that the first certificate chains to a
+// trusted root, using the rest of the chain and extra as intermediates, and
+// that it belongs to a trusted signer. A certificate that has expired is
+// checked as of its issuance instead, and reported with an unverifiableError
+// once the signature itself has been verified.
+func (v *SignatureVerifier) verifyCertificateChain(chain, extra []*x509.Certificate) (*x509.Certificate, *unverifiableError, error) {
+	if len(chain) == 0 {
+		return nil, nil, errors.New("no signing certificate")
+	}
+	if !v.hasRoots {
+		return nil, nil, errors.New("no trusted certificates configured")
+	}
+
+	leaf := chain[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range append(chain[1:], extra...) {
+		intermediates.AddCert(cert)
+	}
+	// Fulcio and Notary signing certificates carry the code signing usage;
+	// a certificate the same CA issued for TLS must not sign images.
+	opts := x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	var expired *unverifiableError
+	if now := time.Now(); now.After(leaf.NotAfter) {
+		opts.CurrentTime = leaf.NotBefore
+		expired = &unverifiableError{
+			signer: certificateSigner(leaf),
+			reason: fmt.Sprintf("signing certificate of %s expired on %s; the signing time cannot be verified without a transparency log", certificateSigner(leaf), leaf.NotAfter.UTC().Format(time.RFC3339)),
+		}
+	}
+	if _, err := leaf.Verify(opts); err != nil {
+		return nil, nil, fmt.Errorf("untrusted signing certificate: %v", err)
+	}
+	if err := v.policy.allows(leaf); err != nil {
+		return nil, nil, err
+	}
+	return leaf, expired, nil
+}
+
+// verifySignature checks a signature over message with a public key.
+func verifySignature(key crypto.PublicKey, alg signatureAlgorithm, message, signature []byte) error {
+	if k, ok := key.(ed25519.PublicKey); ok {
+		if !ed25519.Verify(k, message, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+
+	h := alg.hash.New()
+	h.Write(message)
+	hashed := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if alg.rawECDSA {
+			half := len(signature) / 2
+			r := new(big.Int).SetBytes(signature[:half])
+			s := new(big.Int).SetBytes(signature[half:])
+			if len(signature)%2 != 0 || !ecdsa.Verify(k, hashed, r, s) {
+				return errors.New("invalid signature")
+			}
+			return nil
+		}
+		if !ecdsa.VerifyASN1(k, hashed, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if alg.pss {
+			return rsa.VerifyPSS(k, alg.hash, hashed, signature, nil)
+		}
+		return rsa.VerifyPKCS1v15(k, alg.hash, hashed, signature)
+	}
+	return fmt.Errorf("unsupported key type %T", key)
+}
+
+// readBlob reads a blob from the layout and checks it matches its digest.
+func (v *SignatureVerifier) readBlob(digest string) ([]byte, error) {
+	algorithm, encoded, ok := strings.Cut(digest, ":")
+	if !ok || algorithm != "sha256" || strings.ContainsAny(encoded, `/\.`) {
+		return nil, fmt.Errorf("unsupported digest %q", digest)
+	}
+
+	path := filepath.Join(v.layoutDir, "blobs", algorithm, encoded)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading blob %s: %v", digest, err)
+	}
+	if info.Size() > maxArchiveMetadataSize {
+		return nil, fmt.Errorf("blob %s is too large", digest)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading blob %s: %v", digest, err)
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != encoded {
+		return nil, fmt.Errorf("blob %s does not match its digest", digest)
+	}
+	return data, nil
+}
+
+func (v *SignatureVerifier) readBlobJSON(digest string, out interface{}) error {
+	data, err := v.readBlob(digest)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("error parsing blob %s: %v", digest, err)
+	}
+	return nil
+}
+
+func (v *SignatureVerifier) readJSONFile(path string, out interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	return nil
+}
+
+// parsePEMCertificates returns the certificates in PEM data, skipping
+// anything that does not parse.
+func parsePEMCertificates(data []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+}
+
+// certificateSigner names the identity of a signing certificate.
+func certificateSigner(cert *x509.Certificate) string {
+	if len(cert.EmailAddresses) > 0 {
+		return cert.EmailAddresses[0]
+	}
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	return cert.Subject.String()
+}
+
+// certificateIssuer returns the OIDC issuer a keyless signing certificate
+// records, or "" for other certificates.
+func certificateIssuer(cert *x509.Certificate) string {
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(fulcioIssuerV2OID):
+			var issuer string
+			if _, err := asn1.Unmarshal(ext.Value, &issuer); err == nil {
+				return issuer
+			}
+		case ext.Id.Equal(fulcioIssuerV1OID):
+			return string(ext.Value)
+		}
+	}
+	return ""
+}
+
+// keyFingerprint identifies a public key by the hash of its encoding.
+func keyFingerprint(key crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "public key"
+	}
+	sum := sha256.Sum256(der)
+	return "key sha256:" + hex.EncodeToString(sum[:8])
+}
+
+func init() {
+	registerContainerRules(
+		ContainerRule{
+			ID:          "image-signature-invalid",
+			Family:      FamilySecurity,
+			Severity:    SeverityCritical,
+			Title:       "Image signature is invalid",
+			Remediation: "Stop the container and investigate: the image was signed, but no signature verifies against the trusted keys.",
+			Check: func(rc *RuleContext) []string {
+				if rc.Signature == nil || rc.Signature.Status != SignatureInvalid {
+					return nil
+				}
+				return []string{fmt.Sprintf("%s: %s", rc.Signature.Digest, rc.Signature.Detail)}
+			},
+		},
+		ContainerRule{
+			ID:          "image-signature-unverifiable",
+			Family:      FamilySecurity,
+			Severity:    SeverityLow,
+			Title:       "Image signature cannot be verified",
+			Remediation: "Verify the signature against the transparency log with cosign verify, or sign with a long-lived key or certificate.",
+			Check: func(rc *RuleContext) []string {
+				if rc.Signature == nil || rc.Signature.Status != SignatureUnverifiable {
+					return nil
+				}
+				return []string{fmt.Sprintf("%s: %s", rc.Signature.Digest, rc.Signature.Detail)}
+			},
+		},
+		ContainerRule{
+			ID:          "image-unsigned",
+			Family:      FamilySecurity,
+			Severity:    SeverityMedium,
+			Title:       "Image is not signed",
+			Remediation: "Sign the image with cosign or notation when it is published, and run only signed images.",
+			Check: func(rc *RuleContext) []string {
+				if rc.Signature == nil || rc.Signature.Status != SignatureUnsigned {
+					return nil
+				}
+				if rc.Signature.Digest == "" {
+					return []string{rc.Signature.Detail}
+				}
+				return []string{fmt.Sprintf("No signature found for %s", rc.Signature.Digest)}
+			},
+		},
+	)
+}
@@ -1 +1,379 @@
 package checks
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Scan is one run of the container checks.
+type Scan struct {
+	ID         uint64          `json:"id"`
+	StartedAt  time.Time       `json:"startedAt"`
+	Duration   time.Duration   `json:"duration"`
+	Daemon     DaemonInfo      `json:"daemon"`
+	Containers []ContainerInfo `json:"containers"`
+	// Partial is set on the scans the monitor publishes after re-checking
+	// only the containers that Docker events concerned.
+	Partial bool `json:"-"`
+}
+
+// ScanSummary describes a stored scan without its container details.
+type ScanSummary struct {
+	ID              uint64        `json:"id"`
+	StartedAt       time.Time     `json:"startedAt"`
+	Duration        time.Duration `json:"duration"`
+	Daemon          string        `json:"daemon"`
+	Containers      int           `json:"containers"`
+	Findings        int           `json:"findings"`
+	HighestSeverity Severity      `json:"highestSeverity"`
+}
+
+// Summary counts the containers and findings of the scan.
+func (s *Scan) Summary() ScanSummary {
+	summary := ScanSummary{
+		ID:         s.ID,
+		StartedAt:  s.StartedAt,
+		Duration:   s.Duration,
+		Daemon:     s.Daemon.Name,
+		Containers: len(s.Containers),
+	}
+	for _, c := range s.Containers {
+		summary.Findings += len(c.Findings)
+		if highest := HighestSeverity(c.Findings); highest > summary.HighestSeverity {
+			summary.HighestSeverity = highest
+		}
+	}
+	return summary
+}
+
+// RetentionPolicy bounds how many scans a store keeps. Zero values disable
+// the corresponding limit.
+type RetentionPolicy struct {
+	MaxScans int
+	MaxAge   time.Duration
+}
+
+// DefaultRetention keeps the last thousand scans from the last 30 days.
+// Scans that change nothing are not stored, so the limit counts changes to
+// the host rather than polls, and both limits matter.
+var DefaultRetention = RetentionPolicy{MaxScans: 1000, MaxAge: 30 * 24 * time.Hour}
+
+// ErrScanNotFound is returned when a scan ID is not in the store.
+var ErrScanNotFound = errors.New("scan not found")
+
+// Store persists scan history.
+type Store interface {
+	// SaveScan stores a scan, assigns its ID and applies the retention
+	// policy. A scan with the same containers, states and findings as the
+	// latest stored one is not stored again and gets that scan's ID.
+	SaveScan(scan *Scan) error
+	// Scan returns a stored scan.
+	Scan(id uint64) (*Scan, error)
+	// LatestScan returns the most recent scan, or ErrScanNotFound.
+	LatestScan() (*Scan, error)
+	// ListScans returns up to limit summaries, newest first. A limit of
+	// zero returns every scan.
+	ListScans(limit int) ([]ScanSummary, error)
+	// ListDrift returns up to limit drift events between consecutive scans,
+	// newest first. A limit of zero returns every event.
+	ListDrift(limit int) ([]DriftEvent, error)
+	// Prune removes the scans the retention policy no longer keeps and
+	// returns how many were removed.
+	Prune() (int, error)
+	Close() error
+}
+
+var (
+	scansBucket     = []byte("scans")
+	summariesBucket = []byte("summaries")
+	driftBucket     = []byte("drift")
+)
+
+// BoltStore is a Store kept in a single bbolt database file. Scans are keyed
+// by their ID, so keys sort in the order the scans were taken.
+type BoltStore struct {
+	db        *bolt.DB
+	retention RetentionPolicy
+}
+
+// OpenBoltStore opens or creates the scan history database at path.
+func OpenBoltStore(path string, retention RetentionPolicy) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening scan history %s: %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{scansBucket, summariesBucket, driftBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error initializing scan history %s: %v", path, err)
+	}
+	return &BoltStore{db: db, retention: retention}, nil
+}
+
+// OpenBoltStoreReadOnly opens an existing scan history database for
+// queries. It fails while another process, such as the web server, holds
+// the database open for writing.
+func OpenBoltStoreReadOnly(path string) (*BoltStore, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("error opening scan history: %v", err)
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("scan history %s is in use by another process; query it through the web server", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening scan history %s: %v", path, err)
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(scansBucket) == nil || tx.Bucket(summariesBucket) == nil {
+			return fmt.Errorf("%s holds no scan history", path)
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func scanKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// SaveScan stores a scan, assigns its ID and applies the retention policy.
+// Unchanged scans are skipped.
+func (s *BoltStore) SaveScan(scan *Scan) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		scans := tx.Bucket(scansBucket)
+
+		// Drift is computed against the previous scan as it is saved, so
+		// listing changes does not need to decode every stored scan.
+		var previous *Scan
+		if _, data := scans.Cursor().Last(); data != nil {
+			previous = &Scan{}
+			if err := json.Unmarshal(data, previous); err != nil {
+				return fmt.Errorf("error decoding previous scan: %v", err)
+			}
+		}
+		var events []DriftEvent
+		if previous != nil {
+			events = DiffScans(previous, scan)
+			if len(events) == 0 && sameFindings(previous, scan) {
+				scan.ID = previous.ID
+				return nil
+			}
+		}
+
+		id, err := scans.NextSequence()
+		if err != nil {
+			return fmt.Errorf("error allocating scan ID: %v", err)
+		}
+		scan.ID = id
+
+		data, err := json.Marshal(scan)
+		if err != nil {
+			return fmt.Errorf("error encoding scan: %v", err)
+		}
+		summary, err := json.Marshal(scan.Summary())
+		if err != nil {
+			return fmt.Errorf("error encoding scan summary: %v", err)
+		}
+		if err := scans.Put(scanKey(id), data); err != nil {
+			return fmt.Errorf("error saving scan %d: %v", id, err)
+		}
+		if err := tx.Bucket(summariesBucket).Put(scanKey(id), summary); err != nil {
+			return fmt.Errorf("error saving scan %d: %v", id, err)
+		}
+
+		if len(events) > 0 {
+			for i := range events {
+				events[i].ToScan = id
+			}
+			data, err := json.Marshal(events)
+			if err != nil {
+				return fmt.Errorf("error encoding drift: %v", err)
+			}
+			if err := tx.Bucket(driftBucket).Put(scanKey(id), data); err != nil {
+				return fmt.Errorf("error saving drift of scan %d: %v", id, err)
+			}
+		}
+
+		_, err = s.prune(tx)
+		return err
+	})
+}
+
+// sameFindings reports whether two scans ran against the same daemon and
+// found every container in the same state with the same findings.
+func sameFindings(previous, current *Scan) bool {
+	if previous.Daemon != current.Daemon || len(previous.Containers) != len(current.Containers) {
+		return false
+	}
+	before := make(map[string]ContainerInfo, len(previous.Containers))
+	for _, c := range previous.Containers {
+		before[c.ID] = c
+	}
+	for _, c := range current.Containers {
+		old, ok := before[c.ID]
+		if !ok || old.State != c.State || len(old.Findings) != len(c.Findings) {
+			return false
+		}
+		for i, f := range c.Findings {
+			if f.RuleID != old.Findings[i].RuleID || f.Severity != old.Findings[i].Severity || !equalStrings(f.Evidence, old.Findings[i].Evidence) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Scan returns a stored scan.
+func (s *BoltStore) Scan(id uint64) (*Scan, error) {
+	var scan *Scan
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(scansBucket).Get(scanKey(id))
+		if data == nil {
+			return ErrScanNotFound
+		}
+		scan = &Scan{}
+		return json.Unmarshal(data, scan)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return scan, nil
+}
+
+// LatestScan returns the most recent scan, or ErrScanNotFound.
+func (s *BoltStore) LatestScan() (*Scan, error) {
+	var scan *Scan
+	err := s.db.View(func(tx *bolt.Tx) error {
+		_, data := tx.Bucket(scansBucket).Cursor().Last()
+		if data == nil {
+			return ErrScanNotFound
+		}
+		scan = &Scan{}
+		return json.Unmarshal(data, scan)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return scan, nil
+}
+
+// ListScans returns up to limit summaries, newest first.
+func (s *BoltStore) ListScans(limit int) ([]ScanSummary, error) {
+	var summaries []ScanSummary
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(summariesBucket).Cursor()
+		for k, v := c.Last(); k != nil && (limit <= 0 || len(summaries) < limit); k, v = c.Prev() {
+			var summary ScanSummary
+			if err := json.Unmarshal(v, &summary); err != nil {
+				return fmt.Errorf("error decoding scan %d: %v", binary.BigEndian.Uint64(k), err)
+			}
+			summaries = append(summaries, summary)
+		}
+		return nil
+	})
+	return summaries, err
+}
+
+// ListDrift returns up to limit drift events, newest first.
+func (s *BoltStore) ListDrift(limit int) ([]DriftEvent, error) {
+	var events []DriftEvent
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(driftBucket)
+		if bucket == nil {
+			return nil // history written before drift was recorded
+		}
+		c := bucket.Cursor()
+		for k, v := c.Last(); k != nil && (limit <= 0 || len(events) < limit); k, v = c.Prev() {
+			var scanEvents []DriftEvent
+			if err := json.Unmarshal(v, &scanEvents); err != nil {
+				return fmt.Errorf("error decoding drift of scan %d: %v", binary.BigEndian.Uint64(k), err)
+			}
+			events = append(events, scanEvents...)
+		}
+		return nil
+	})
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	return events, err
+}
+
+// Prune removes the scans the retention policy no longer keeps.
+func (s *BoltStore) Prune() (int, error) {
+	var removed int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		removed, err = s.prune(tx)
+		return err
+	})
+	return removed, err
+}
+
+// prune deletes scans from the oldest onwards until both limits hold. The
+// latest scan is always kept, since an unchanged host stores no new ones.
+func (s *BoltStore) prune(tx *bolt.Tx) (int, error) {
+	scans, summaries, drift := tx.Bucket(scansBucket), tx.Bucket(summariesBucket), tx.Bucket(driftBucket)
+	count := 0
+	c := summaries.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		count++
+	}
+	cutoff := time.Time{}
+	if s.retention.MaxAge > 0 {
+		cutoff = time.Now().Add(-s.retention.MaxAge)
+	}
+
+	var expired [][]byte
+	for k, v := c.First(); k != nil && count-len(expired) > 1; k, v = c.Next() {
+		tooMany := s.retention.MaxScans > 0 && count-len(expired) > s.retention.MaxScans
+		tooOld := false
+		if !cutoff.IsZero() {
+			var summary ScanSummary
+			if err := json.Unmarshal(v, &summary); err == nil {
+				tooOld = summary.StartedAt.Before(cutoff)
+			}
+		}
+		if !tooMany && !tooOld {
+			break
+		}
+		expired = append(expired, append([]byte(nil), k...))
+	}
+
+	for _, k := range expired {
+		if err := scans.Delete(k); err != nil {
+			return 0, fmt.Errorf("error pruning scan %d: %v", binary.BigEndian.Uint64(k), err)
+		}
+		if err := summaries.Delete(k); err != nil {
+			return 0, fmt.Errorf("error pruning scan %d: %v", binary.BigEndian.Uint64(k), err)
+		}
+		if err := drift.Delete(k); err != nil {
+			return 0, fmt.Errorf("error pruning scan %d: %v", binary.BigEndian.Uint64(k), err)
+		}
+	}
+	return len(expired), nil
+}
+
+// Close closes the database.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
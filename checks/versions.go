@@ -0,0 +1,601 @@
+package checks
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// compareEcosystemVersions compares two package versions using the rules of
+// the package ecosystem they belong to. Ecosystems follow the OSV naming, with
+// any release suffix ("Alpine:v3.18") ignored.
+func compareEcosystemVersions(ecosystem, a, b string) int {
+	base, _, _ := strings.Cut(ecosystem, ":")
+	switch base {
+	case "Alpine", "Wolfi", "Chainguard":
+		return compareAPKVersions(a, b)
+	case "Debian", "Ubuntu":
+		return compareDebianVersions(a, b)
+	case "Red Hat", "Rocky Linux", "AlmaLinux", "openSUSE", "SUSE", "Mageia", "Photon OS", "Fedora", "CentOS", "Oracle Linux", "Amazon Linux":
+		return compareRPMVersions(a, b)
+	case "PyPI":
+		return comparePythonVersions(a, b)
+	case "Maven":
+		return compareMavenVersions(a, b)
+	default:
+		return compareSemver(a, b)
+	}
+}
+
+// sign reduces a comparison result to -1, 0 or 1.
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// compareNumericStrings compares two strings of digits by value.
+func compareNumericStrings(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return sign(len(a) - len(b))
+	}
+	return strings.Compare(a, b)
+}
+
+// splitEpoch separates an "epoch:version" string.
+func splitEpoch(version string) (int, string) {
+	if epoch, rest, ok := strings.Cut(version, ":"); ok {
+		if n, err := strconv.Atoi(epoch); err == nil {
+			return n, rest
+		}
+	}
+	return 0, version
+}
+
+// compareDebianVersions implements dpkg's [epoch:]upstream[-revision] ordering.
+func compareDebianVersions(a, b string) int {
+	epochA, restA := splitEpoch(a)
+	epochB, restB := splitEpoch(b)
+	if epochA != epochB {
+		return sign(epochA - epochB)
+	}
+
+	upstreamA, revisionA := restA, ""
+	if i := strings.LastIndex(restA, "-"); i >= 0 {
+		upstreamA, revisionA = restA[:i], restA[i+1:]
+	}
+	upstreamB, revisionB := restB, ""
+	if i := strings.LastIndex(restB, "-"); i >= 0 {
+		upstreamB, revisionB = restB[:i], restB[i+1:]
+	}
+
+	if c := compareDebianPart(upstreamA, upstreamB); c != 0 {
+		return c
+	}
+	return compareDebianPart(revisionA, revisionB)
+}
+
+// debianOrder ranks a character in the non-digit part of a dpkg version:
+// '~' sorts before everything, letters before other characters.
+func debianOrder(c byte) int {
+	switch {
+	case c == '~':
+		return -1
+	case c >= '0' && c <= '9':
+		return 0
+	case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		return int(c)
+	default:
+		return int(c) + 256
+	}
+}
+
+// compareDebianPart compares an upstream version or revision the way dpkg does.
+func compareDebianPart(a, b string) int {
+	for a != "" || b != "" {
+		// Non-digit prefix
+		for (a != "" && !isDigit(a[0])) || (b != "" && !isDigit(b[0])) {
+			var ca, cb int
+			if a != "" && !isDigit(a[0]) {
+				ca = debianOrder(a[0])
+			}
+			if b != "" && !isDigit(b[0]) {
+				cb = debianOrder(b[0])
+			}
+			if ca != cb {
+				return sign(ca - cb)
+			}
+			if a != "" && !isDigit(a[0]) {
+				a = a[1:]
+			}
+			if b != "" && !isDigit(b[0]) {
+				b = b[1:]
+			}
+		}
+
+		// Digit prefix
+		digitsA, digitsB := leadingDigits(a), leadingDigits(b)
+		if c := compareNumericStrings(digitsA, digitsB); c != 0 {
+			return c
+		}
+		a, b = a[len(digitsA):], b[len(digitsB):]
+	}
+	return 0
+}
+
+// compareRPMVersions implements rpmvercmp over [epoch:]version[-release].
+func compareRPMVersions(a, b string) int {
+	epochA, restA := splitEpoch(a)
+	epochB, restB := splitEpoch(b)
+	if epochA != epochB {
+		return sign(epochA - epochB)
+	}
+
+	versionA, releaseA, _ := strings.Cut(restA, "-")
+	versionB, releaseB, _ := strings.Cut(restB, "-")
+	if c := rpmvercmp(versionA, versionB); c != 0 {
+		return c
+	}
+	if releaseA == "" || releaseB == "" {
+		return 0
+	}
+	return rpmvercmp(releaseA, releaseB)
+}
+
+// rpmvercmp compares alternating numeric and alphabetic segments; '~' sorts
+// before anything and '^' after the base version.
+func rpmvercmp(a, b string) int {
+	isSeparator := func(c byte) bool {
+		return !isDigit(c) && !isLetter(c) && c != '~' && c != '^'
+	}
+
+	for a != "" || b != "" {
+		a = strings.TrimLeftFunc(a, func(r rune) bool { return r < 128 && isSeparator(byte(r)) })
+		b = strings.TrimLeftFunc(b, func(r rune) bool { return r < 128 && isSeparator(byte(r)) })
+
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			if a == "" {
+				return -1
+			}
+			if b == "" {
+				return 1
+			}
+			if !strings.HasPrefix(a, "^") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "^") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		if a == "" || b == "" {
+			break
+		}
+
+		var segA, segB string
+		numeric := isDigit(a[0])
+		if numeric {
+			segA, segB = leadingDigits(a), leadingDigits(b)
+		} else {
+			segA, segB = leadingLetters(a), leadingLetters(b)
+		}
+		if segB == "" {
+			// Numeric segments are newer than alphabetic ones.
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+		var c int
+		if numeric {
+			c = compareNumericStrings(segA, segB)
+		} else {
+			c = strings.Compare(segA, segB)
+		}
+		if c != 0 {
+			return c
+		}
+		a, b = a[len(segA):], b[len(segB):]
+	}
+
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	default:
+		return 1
+	}
+}
+
+// apkSuffixOrder ranks Alpine pre- and post-release suffixes around a plain release.
+var apkSuffixOrder = map[string]int{
+	"alpha": -4, "beta": -3, "pre": -2, "rc": -1,
+	"": 0, "cvs": 1, "svn": 2, "git": 3, "hg": 4, "p": 5,
+}
+
+// apkVersion is a parsed Alpine package version: 1.2.3a_rc1_p2-r4.
+type apkVersion struct {
+	numbers  []string
+	letter   string
+	suffixes [][2]string
+	revision int
+}
+
+func parseAPKVersion(version string) apkVersion {
+	var v apkVersion
+	if i := strings.LastIndex(version, "-r"); i >= 0 {
+		if n, err := strconv.Atoi(version[i+2:]); err == nil {
+			v.revision = n
+			version = version[:i]
+		}
+	}
+
+	main, suffixes, _ := strings.Cut(version, "_")
+	for _, part := range strings.Split(main, ".") {
+		digits := leadingDigits(part)
+		v.numbers = append(v.numbers, digits)
+		if len(digits) < len(part) {
+			v.letter = part[len(digits):]
+			break
+		}
+	}
+	if suffixes != "" {
+		for _, s := range strings.Split(suffixes, "_") {
+			name := leadingLetters(s)
+			v.suffixes = append(v.suffixes, [2]string{name, s[len(name):]})
+		}
+	}
+	return v
+}
+
+// compareAPKVersions implements the ordering used by apk-tools.
+func compareAPKVersions(a, b string) int {
+	va, vb := parseAPKVersion(a), parseAPKVersion(b)
+
+	for i := 0; i < len(va.numbers) || i < len(vb.numbers); i++ {
+		if i >= len(va.numbers) {
+			return -1
+		}
+		if i >= len(vb.numbers) {
+			return 1
+		}
+		if c := compareNumericStrings(va.numbers[i], vb.numbers[i]); c != 0 {
+			return c
+		}
+	}
+	if c := strings.Compare(va.letter, vb.letter); c != 0 {
+		return c
+	}
+
+	for i := 0; i < len(va.suffixes) || i < len(vb.suffixes); i++ {
+		var sa, sb [2]string
+		if i < len(va.suffixes) {
+			sa = va.suffixes[i]
+		}
+		if i < len(vb.suffixes) {
+			sb = vb.suffixes[i]
+		}
+		if c := sign(apkSuffixOrder[sa[0]] - apkSuffixOrder[sb[0]]); c != 0 {
+			return c
+		}
+		if c := compareNumericStrings(sa[1], sb[1]); c != 0 {
+			return c
+		}
+	}
+
+	return sign(va.revision - vb.revision)
+}
+
+// compareSemver compares semantic versions, with or without a "v" prefix.
+// Build metadata is ignored and a pre-release sorts before its release.
+func compareSemver(a, b string) int {
+	a, _, _ = strings.Cut(strings.TrimPrefix(a, "v"), "+")
+	b, _, _ = strings.Cut(strings.TrimPrefix(b, "v"), "+")
+	coreA, preA, _ := strings.Cut(a, "-")
+	coreB, preB, _ := strings.Cut(b, "-")
+
+	partsA, partsB := strings.Split(coreA, "."), strings.Split(coreB, ".")
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		x, y := "0", "0"
+		if i < len(partsA) {
+			x = partsA[i]
+		}
+		if i < len(partsB) {
+			y = partsB[i]
+		}
+		if c := compareNumericStrings(leadingDigits(x), leadingDigits(y)); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+	idsA, idsB := strings.Split(preA, "."), strings.Split(preB, ".")
+	for i := 0; i < len(idsA) && i < len(idsB); i++ {
+		x, y := idsA[i], idsB[i]
+		numX, numY := isNumeric(x), isNumeric(y)
+		var c int
+		switch {
+		case numX && numY:
+			c = compareNumericStrings(x, y)
+		case numX:
+			c = -1
+		case numY:
+			c = 1
+		default:
+			c = strings.Compare(x, y)
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return sign(len(idsA) - len(idsB))
+}
+
+// pythonVersion is a simplified PEP 440 version.
+type pythonVersion struct {
+	epoch   int
+	release []string
+	pre     int // 0 alpha, 1 beta, 2 release candidate
+	preNum  string
+	post    string
+	dev     string
+	hasPre  bool
+	hasPost bool
+	hasDev  bool
+}
+
+func parsePythonVersion(version string) pythonVersion {
+	var v pythonVersion
+	version = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(version), "v"))
+	if epoch, rest, ok := strings.Cut(version, "!"); ok {
+		v.epoch, _ = strconv.Atoi(epoch)
+		version = rest
+	}
+	version, _, _ = strings.Cut(version, "+")
+
+	for version != "" {
+		digits := leadingDigits(version)
+		if digits == "" {
+			break
+		}
+		v.release = append(v.release, digits)
+		version = version[len(digits):]
+		if !strings.HasPrefix(version, ".") || len(version) < 2 || !isDigit(version[1]) {
+			break
+		}
+		version = version[1:]
+	}
+
+	for version != "" {
+		version = strings.TrimLeft(version, ".-_")
+		label := leadingLetters(version)
+		version = version[len(label):]
+		version = strings.TrimLeft(version, ".-_")
+		number := leadingDigits(version)
+		version = version[len(number):]
+
+		switch label {
+		case "a", "alpha":
+			v.hasPre, v.pre, v.preNum = true, 0, number
+		case "b", "beta":
+			v.hasPre, v.pre, v.preNum = true, 1, number
+		case "rc", "c", "pre", "preview":
+			v.hasPre, v.pre, v.preNum = true, 2, number
+		case "post", "rev", "r":
+			v.hasPost, v.post = true, number
+		case "dev":
+			v.hasDev, v.dev = true, number
+		case "":
+			if number == "" {
+				return v
+			}
+			v.hasPost, v.post = true, number
+		default:
+			return v
+		}
+	}
+	return v
+}
+
+// comparePythonVersions orders versions following PEP 440: dev releases come
+// before pre-releases, which come before the release and its post-releases.
+func comparePythonVersions(a, b string) int {
+	va, vb := parsePythonVersion(a), parsePythonVersion(b)
+	if va.epoch != vb.epoch {
+		return sign(va.epoch - vb.epoch)
+	}
+	for i := 0; i < len(va.release) || i < len(vb.release); i++ {
+		x, y := "0", "0"
+		if i < len(va.release) {
+			x = va.release[i]
+		}
+		if i < len(vb.release) {
+			y = vb.release[i]
+		}
+		if c := compareNumericStrings(x, y); c != 0 {
+			return c
+		}
+	}
+
+	// Key for the pre-release phase: dev-only < pre < final.
+	phase := func(v pythonVersion) int {
+		switch {
+		case v.hasPre:
+			return v.pre
+		case v.hasDev && !v.hasPost:
+			return -1
+		default:
+			return 3
+		}
+	}
+	if c := sign(phase(va) - phase(vb)); c != 0 {
+		return c
+	}
+	if va.hasPre {
+		if c := compareNumericStrings(va.preNum, vb.preNum); c != 0 {
+			return c
+		}
+	}
+	if va.hasPost != vb.hasPost {
+		if va.hasPost {
+			return 1
+		}
+		return -1
+	}
+	if c := compareNumericStrings(va.post, vb.post); c != 0 {
+		return c
+	}
+	if va.hasDev != vb.hasDev {
+		if va.hasDev {
+			return -1
+		}
+		return 1
+	}
+	return compareNumericStrings(va.dev, vb.dev)
+}
+
+// mavenQualifierOrder ranks well-known Maven qualifiers around a release.
+var mavenQualifierOrder = map[string]int{
+	"alpha": -5, "a": -5, "beta": -4, "b": -4, "milestone": -3, "m": -3,
+	"rc": -2, "cr": -2, "snapshot": -1, "": 0, "ga": 0, "final": 0, "release": 0, "sp": 1,
+}
+
+// compareMavenVersions compares Maven versions token by token, ordering
+// numbers numerically and known qualifiers by release stage.
+func compareMavenVersions(a, b string) int {
+	tokensA, tokensB := mavenTokens(a), mavenTokens(b)
+	for i := 0; i < len(tokensA) || i < len(tokensB); i++ {
+		x, y := "", ""
+		if i < len(tokensA) {
+			x = tokensA[i]
+		}
+		if i < len(tokensB) {
+			y = tokensB[i]
+		}
+		numX, numY := isNumeric(x), isNumeric(y)
+		var c int
+		switch {
+		case numX && numY:
+			c = compareNumericStrings(x, y)
+		case numX:
+			c = sign(1 - mavenQualifierRank(y))
+			if y == "" {
+				c = compareNumericStrings(x, "0")
+			}
+		case numY:
+			c = sign(mavenQualifierRank(x) - 1)
+			if x == "" {
+				c = compareNumericStrings("0", y)
+			}
+		default:
+			c = sign(mavenQualifierRank(x) - mavenQualifierRank(y))
+			if c == 0 {
+				c = strings.Compare(x, y)
+			}
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func mavenQualifierRank(qualifier string) int {
+	if rank, ok := mavenQualifierOrder[qualifier]; ok {
+		return rank
+	}
+	// Unknown qualifiers sort after the release, alphabetically.
+	return 2
+}
+
+// mavenTokens splits a Maven version on separators and digit/letter transitions.
+func mavenTokens(version string) []string {
+	var tokens []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+	var previous rune
+	for _, r := range strings.ToLower(version) {
+		switch {
+		case r == '.' || r == '-' || r == '_':
+			flush()
+		case current.Len() > 0 && unicode.IsDigit(r) != unicode.IsDigit(previous):
+			flush()
+			current.WriteRune(r)
+		default:
+			current.WriteRune(r)
+		}
+		previous = r
+	}
+	flush()
+
+	// Trailing zeros and release qualifiers do not change the version.
+	for len(tokens) > 0 {
+		last := tokens[len(tokens)-1]
+		if (isNumeric(last) && strings.Trim(last, "0") == "") || (!isNumeric(last) && mavenQualifierRank(last) == 0) {
+			tokens = tokens[:len(tokens)-1]
+			continue
+		}
+		break
+	}
+	return tokens
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNumeric(s string) bool {
+	return s != "" && strings.TrimLeft(s, "0123456789") == ""
+}
+
+// leadingDigits returns the run of digits at the start of s.
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i]
+}
+
+// leadingLetters returns the run of ASCII letters at the start of s.
+func leadingLetters(s string) string {
+	i := 0
+	for i < len(s) && isLetter(s[i]) {
+		i++
+	}
+	return s[:i]
+}
@@ -0,0 +1,68 @@
+package checks
+
+import "testing"
+
+func TestCompareEcosystemVersions(t *testing.T) {
+	tests := []struct {
+		ecosystem string
+		a, b      string
+		want      int
+	}{
+		// dpkg: epochs, tildes sorting before anything, revisions.
+		{"Debian:12", "1.2.3-1", "1.2.3-1", 0},
+		{"Debian:12", "1.2.3-1", "1.2.3-2", -1},
+		{"Debian:12", "1.2.10-1", "1.2.9-1", 1},
+		{"Debian:12", "1:1.0-1", "2.0-1", 1},
+		{"Debian:12", "1.0~rc1-1", "1.0-1", -1},
+		{"Debian:12", "1.0-1", "1.0+deb12u1-1", -1},
+		{"Ubuntu:22.04", "3.0.2-0ubuntu1.10", "3.0.2-0ubuntu1.9", 1},
+
+		// rpmvercmp: epochs, alphabetic segments, tilde and caret.
+		{"Red Hat", "1.1.1k-12.el8", "1.1.1k-12.el8", 0},
+		{"Red Hat", "1.1.1k-12.el8", "1.1.1k-9.el8", 1},
+		{"Red Hat", "1:1.0-1", "2.0-1", 1},
+		{"Rocky Linux:9", "1.0~rc1-1", "1.0-1", -1},
+		{"AlmaLinux", "1.0^git1-1", "1.0-1", 1},
+		{"Fedora", "1.10-1", "1.9-1", 1},
+
+		// apk: letters, suffixes and revisions.
+		{"Alpine:v3.18", "1.2.3-r0", "1.2.3-r1", -1},
+		{"Alpine:v3.18", "1.2.3a-r0", "1.2.3-r0", 1},
+		{"Alpine:v3.18", "1.2.3_rc1-r0", "1.2.3-r0", -1},
+		{"Alpine:v3.18", "1.2.3_p1-r0", "1.2.3-r0", 1},
+		{"Alpine:v3.18", "3.1.4-r5", "3.1.10-r0", -1},
+		{"Wolfi", "1.0-r1", "1.0-r1", 0},
+
+		// PEP 440: dev < pre < release < post.
+		{"PyPI", "1.0", "1.0.0", 0},
+		{"PyPI", "1.0.dev1", "1.0a1", -1},
+		{"PyPI", "1.0a1", "1.0b1", -1},
+		{"PyPI", "1.0rc1", "1.0", -1},
+		{"PyPI", "1.0", "1.0.post1", -1},
+		{"PyPI", "1!0.5", "2.0", 1},
+		{"PyPI", "2.10", "2.9", 1},
+
+		// Maven qualifiers.
+		{"Maven", "1.0", "1.0.0", 0},
+		{"Maven", "1.0-alpha1", "1.0-beta1", -1},
+		{"Maven", "1.0-rc1", "1.0", -1},
+		{"Maven", "1.0-SNAPSHOT", "1.0", -1},
+		{"Maven", "1.0", "1.0-sp1", -1},
+		{"Maven", "2.17.1", "2.15.0", 1},
+
+		// Semantic versions for Go, npm and anything else.
+		{"Go", "v1.2.3", "1.2.3", 0},
+		{"Go", "v1.2.3-rc.1", "v1.2.3", -1},
+		{"npm", "1.10.0", "1.9.0", 1},
+		{"npm", "1.0.0+build.5", "1.0.0", 0},
+		{"npm", "1.0.0-alpha", "1.0.0-alpha.1", -1},
+	}
+	for _, tt := range tests {
+		if got := compareEcosystemVersions(tt.ecosystem, tt.a, tt.b); got != tt.want {
+			t.Errorf("compareEcosystemVersions(%q, %q, %q) = %d, want %d", tt.ecosystem, tt.a, tt.b, got, tt.want)
+		}
+		if got := compareEcosystemVersions(tt.ecosystem, tt.b, tt.a); got != -tt.want {
+			t.Errorf("compareEcosystemVersions(%q, %q, %q) = %d, want %d", tt.ecosystem, tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
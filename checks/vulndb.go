@@ -0,0 +1,299 @@
+package checks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Vulnerability is an advisory that affects an installed package.
+type Vulnerability struct {
+	ID               string   `json:"id"`
+	Aliases          []string `json:"aliases,omitempty"`
+	Summary          string   `json:"summary"`
+	Severity         Severity `json:"severity"`
+	Package          string   `json:"package"`
+	InstalledVersion string   `json:"installedVersion"`
+	FixedVersion     string   `json:"fixedVersion,omitempty"`
+	Ecosystem        string   `json:"ecosystem"`
+	Location         string   `json:"location,omitempty"`
+}
+
+// osvAdvisory is the subset of the OSV schema used for matching.
+// See https://ossf.github.io/osv-schema/.
+type osvAdvisory struct {
+	ID               string                 `json:"id"`
+	Aliases          []string               `json:"aliases"`
+	Summary          string                 `json:"summary"`
+	Details          string                 `json:"details"`
+	Severity         []osvSeverity          `json:"severity"`
+	Affected         []osvAffected          `json:"affected"`
+	DatabaseSpecific map[string]interface{} `json:"database_specific"`
+}
+
+type osvSeverity struct {
+	Type  string `json:"type"`
+	Score string `json:"score"`
+}
+
+type osvAffected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"`
+		Name      string `json:"name"`
+	} `json:"package"`
+	Severity          []osvSeverity          `json:"severity"`
+	Ranges            []osvRange             `json:"ranges"`
+	Versions          []string               `json:"versions"`
+	EcosystemSpecific map[string]interface{} `json:"ecosystem_specific"`
+	DatabaseSpecific  map[string]interface{} `json:"database_specific"`
+}
+
+type osvRange struct {
+	Type   string              `json:"type"`
+	Events []map[string]string `json:"events"`
+}
+
+// VulnerabilityDB is an offline vulnerability feed loaded from OSV JSON files.
+type VulnerabilityDB struct {
+	advisories map[string][]*osvAdvisory // "<ecosystem>/<package>" -> advisories
+	count      int
+}
+
+// LoadVulnerabilityDB reads every OSV JSON file under dir. A file may hold a
+// single advisory or a list of advisories.
+func LoadVulnerabilityDB(dir string) (*VulnerabilityDB, error) {
+	db := &VulnerabilityDB{advisories: make(map[string][]*osvAdvisory)}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".json") {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		var advisories []*osvAdvisory
+		if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+			err = json.Unmarshal(data, &advisories)
+		} else {
+			var advisory osvAdvisory
+			err = json.Unmarshal(data, &advisory)
+			advisories = append(advisories, &advisory)
+		}
+		if err != nil {
+			return fmt.Errorf("error parsing %s: %v", path, err)
+		}
+
+		for _, advisory := range advisories {
+			db.add(advisory)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error loading vulnerability database from %s: %v", dir, err)
+	}
+
+	return db, nil
+}
+
+// add indexes an advisory under every package it affects.
+func (db *VulnerabilityDB) add(advisory *osvAdvisory) {
+	if advisory.ID == "" {
+		return
+	}
+	seen := make(map[string]bool)
+	for _, affected := range advisory.Affected {
+		key := advisoryKey(affected.Package.Ecosystem, affected.Package.Name)
+		if !seen[key] {
+			db.advisories[key] = append(db.advisories[key], advisory)
+			seen[key] = true
+		}
+	}
+	db.count++
+}
+
+// Len returns the number of advisories loaded.
+func (db *VulnerabilityDB) Len() int {
+	return db.count
+}
+
+// advisoryKey indexes advisories by ecosystem without its release suffix.
+func advisoryKey(ecosystem, name string) string {
+	base, _, _ := strings.Cut(ecosystem, ":")
+	return base + "/" + normalizePackageName(ecosystem, name)
+}
+
+// Match returns the advisories affecting the packages, most severe first.
+func (db *VulnerabilityDB) Match(packages []Package) []Vulnerability {
+	if db == nil {
+		return nil
+	}
+
+	var vulnerabilities []Vulnerability
+	for _, pkg := range packages {
+		names := []string{pkg.Name}
+		if pkg.Source != "" && pkg.Source != pkg.Name {
+			names = append([]string{pkg.Source}, names...)
+		}
+
+		reported := make(map[string]bool)
+		for _, name := range names {
+			for _, advisory := range db.advisories[advisoryKey(pkg.Ecosystem, name)] {
+				if reported[advisory.ID] {
+					continue
+				}
+				for _, affected := range advisory.Affected {
+					if advisoryKey(affected.Package.Ecosystem, affected.Package.Name) != advisoryKey(pkg.Ecosystem, name) ||
+						!ecosystemMatches(affected.Package.Ecosystem, pkg.Ecosystem) {
+						continue
+					}
+					isAffected, fixed := affectsVersion(affected, pkg.Ecosystem, pkg.Version)
+					if !isAffected {
+						continue
+					}
+					vulnerabilities = append(vulnerabilities, Vulnerability{
+						ID:               advisory.ID,
+						Aliases:          advisory.Aliases,
+						Summary:          advisory.summary(),
+						Severity:         advisory.severity(affected),
+						Package:          pkg.Name,
+						InstalledVersion: pkg.Version,
+						FixedVersion:     fixed,
+						Ecosystem:        pkg.Ecosystem,
+						Location:         pkg.Location,
+					})
+					reported[advisory.ID] = true
+					break
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(vulnerabilities, func(i, j int) bool {
+		if vulnerabilities[i].Severity != vulnerabilities[j].Severity {
+			return vulnerabilities[i].Severity > vulnerabilities[j].Severity
+		}
+		return vulnerabilities[i].ID < vulnerabilities[j].ID
+	})
+	return vulnerabilities
+}
+
+// ecosystemMatches compares an advisory ecosystem such as "Alpine:v3.18" or
+// "Debian:12" with a package ecosystem. An advisory without a release applies
+// to every release; a package without a known release matches any advisory.
+func ecosystemMatches(advisoryEcosystem, packageEcosystem string) bool {
+	advisoryBase, advisoryRelease, _ := strings.Cut(advisoryEcosystem, ":")
+	packageBase, packageRelease, _ := strings.Cut(packageEcosystem, ":")
+	if advisoryBase != packageBase {
+		return false
+	}
+	if advisoryRelease == "" || packageRelease == "" {
+		return true
+	}
+
+	advisoryRelease, _, _ = strings.Cut(strings.TrimPrefix(advisoryRelease, "v"), ":")
+	packageRelease = strings.TrimPrefix(packageRelease, "v")
+	return packageRelease == advisoryRelease || strings.HasPrefix(packageRelease, advisoryRelease+".")
+}
+
+// affectsVersion evaluates the affected versions and ranges of an advisory
+// entry and returns the first fixed version above the installed one.
+func affectsVersion(affected osvAffected, ecosystem, version string) (bool, string) {
+	for _, v := range affected.Versions {
+		if v == version {
+			return true, ""
+		}
+	}
+
+	for _, r := range affected.Ranges {
+		if r.Type != "ECOSYSTEM" && r.Type != "SEMVER" {
+			continue
+		}
+
+		inRange := false
+		for _, event := range r.Events {
+			if introduced, ok := event["introduced"]; ok {
+				if introduced == "0" || compareEcosystemVersions(ecosystem, version, introduced) >= 0 {
+					inRange = true
+				}
+			}
+			if fixed, ok := event["fixed"]; ok {
+				if compareEcosystemVersions(ecosystem, version, fixed) >= 0 {
+					inRange = false
+				} else if inRange {
+					return true, fixed
+				}
+			}
+			if lastAffected, ok := event["last_affected"]; ok {
+				if compareEcosystemVersions(ecosystem, version, lastAffected) > 0 {
+					inRange = false
+				} else if inRange {
+					return true, ""
+				}
+			}
+		}
+		if inRange {
+			return true, ""
+		}
+	}
+	return false, ""
+}
+
+// summary returns the advisory summary, falling back to the first line of its details.
+func (a *osvAdvisory) summary() string {
+	if a.Summary != "" {
+		return a.Summary
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(a.Details), "\n")
+	return line
+}
+
+// osvSeverityNames maps the textual severities used by OSV sources.
+var osvSeverityNames = map[string]Severity{
+	"critical":    SeverityCritical,
+	"high":        SeverityHigh,
+	"important":   SeverityHigh,
+	"moderate":    SeverityMedium,
+	"medium":      SeverityMedium,
+	"low":         SeverityLow,
+	"negligible":  SeverityInfo,
+	"unimportant": SeverityInfo,
+}
+
+// severity derives the severity of an advisory for one affected package from
+// a CVSS v3 vector when there is one, then from database-specific ratings.
+// Advisories with no usable rating are reported as medium.
+func (a *osvAdvisory) severity(affected osvAffected) Severity {
+	for _, scores := range [][]osvSeverity{affected.Severity, a.Severity} {
+		for _, s := range scores {
+			switch s.Type {
+			case "CVSS_V3":
+				if score, err := cvss3BaseScore(s.Score); err == nil {
+					return severityFromCVSS(score)
+				}
+			case "Ubuntu":
+				if severity, ok := osvSeverityNames[strings.ToLower(s.Score)]; ok {
+					return severity
+				}
+			}
+		}
+	}
+
+	for _, specific := range []map[string]interface{}{affected.EcosystemSpecific, affected.DatabaseSpecific, a.DatabaseSpecific} {
+		if name, ok := specific["severity"].(string); ok {
+			if severity, ok := osvSeverityNames[strings.ToLower(name)]; ok {
+				return severity
+			}
+		}
+	}
+	return SeverityMedium
+}
@@ -1,39 +1,662 @@
 package main
 
 import (
-	//"container-checker/checks"
-
-	"container-checker/web"
+	"container-checker/checks"
+	"encoding/json"
+	"flag"
 	"fmt"
-	// Import the checks package
-	//	"github.com/docker/docker/api/types/container"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// Exit codes used by the commands, so CI jobs can tell findings from failures.
+const (
+	exitOK       = 0
+	exitFindings = 1
+	exitError    = 2
 )
 
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: container-checker <command> [flags] [arguments]
+
+Commands:
+  dockerfile   analyze Dockerfiles for security and hygiene issues
+  compose      run the container checks against compose files before deployment
+  kubernetes   run the container checks and Pod Security Standards against manifests
+  scan         check the running containers, optionally reporting only findings not in a baseline
+  baseline     write or update a baseline file from the findings of the running containers
+  remediate    print the docker run command of running containers and a hardened variant
+  history      list the scans saved by the web server, or show one of them
+  changes      list the configuration changes detected between saved scans
+
+Run "container-checker <command> -h" for the flags of a command.
+The web dashboard is started with "go run ./web".
+`)
+}
+
 func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitError)
+	}
+
+	switch os.Args[1] {
+	case "dockerfile":
+		os.Exit(runDockerfile(os.Args[2:]))
+	case "compose":
+		os.Exit(runCompose(os.Args[2:]))
+	case "kubernetes", "k8s":
+		os.Exit(runKubernetes(os.Args[2:]))
+	case "scan":
+		os.Exit(runScan(os.Args[2:]))
+	case "baseline":
+		os.Exit(runBaseline(os.Args[2:]))
+	case "remediate":
+		os.Exit(runRemediate(os.Args[2:]))
+	case "history":
+		os.Exit(runHistory(os.Args[2:]))
+	case "changes":
+		os.Exit(runChanges(os.Args[2:]))
+	case "help", "-h", "--help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(exitError)
+	}
+}
+
+// runDockerfile analyzes the Dockerfiles given as arguments, or ./Dockerfile.
+func runDockerfile(args []string) int {
+	fs := flag.NewFlagSet("dockerfile", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text or json")
+	failOn := fs.String("fail-on", "medium", "exit with status 1 when a finding is at least this severe (info, low, medium, high, critical or none)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: container-checker dockerfile [flags] [Dockerfile...]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	threshold, err := parseFailOn(*failOn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"Dockerfile"}
+	}
+
+	var all []checks.DockerfileFinding
+	for _, path := range paths {
+		var df *checks.Dockerfile
+		if path == "-" {
+			df, err = checks.ParseDockerfile(os.Stdin)
+			if df != nil {
+				df.Path = "<stdin>"
+			}
+		} else {
+			df, err = checks.ParseDockerfileFile(path)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+
+		findings := checks.EvaluateDockerfile(df)
+		if *format == "text" {
+			checks.PrintDockerfileFindings(df.Path, findings)
+		}
+		all = append(all, findings...)
+	}
+
+	if *format == "json" {
+		if all == nil {
+			all = []checks.DockerfileFinding{}
+		}
+		if err := writeJSON(all); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+
+	var severities []checks.Severity
+	for _, f := range all {
+		severities = append(severities, f.Severity)
+	}
+	return exitStatus(severities, threshold)
+}
+
+// composeFileNames are the default compose file names, in the order docker
+// compose looks for them.
+var composeFileNames = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+// runCompose evaluates the services of the compose files given as arguments,
+// or of the compose file in the current directory.
+func runCompose(args []string) int {
+	fs := flag.NewFlagSet("compose", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text or json")
+	failOn := fs.String("fail-on", "medium", "exit with status 1 when a finding is at least this severe (info, low, medium, high, critical or none)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: container-checker compose [flags] [compose file...]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	threshold, err := parseFailOn(*failOn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		for _, name := range composeFileNames {
+			if _, err := os.Stat(name); err == nil {
+				paths = []string{name}
+				break
+			}
+		}
+		if len(paths) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: no compose file found in the current directory")
+			return exitError
+		}
+	}
+
+	var all []checks.ComposeFinding
+	for _, path := range paths {
+		project, err := checks.LoadComposeFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+
+		findings := checks.EvaluateComposeProject(project)
+		if *format == "text" {
+			checks.PrintComposeFindings(project, findings)
+		}
+		all = append(all, findings...)
+	}
+
+	if *format == "json" {
+		if all == nil {
+			all = []checks.ComposeFinding{}
+		}
+		if err := writeJSON(all); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+
+	var severities []checks.Severity
+	for _, f := range all {
+		severities = append(severities, f.Severity)
+	}
+	return exitStatus(severities, threshold)
+}
+
+// runKubernetes evaluates the workloads in the manifests given as arguments.
+// Directories are searched for .yaml and .yml files.
+func runKubernetes(args []string) int {
+	fs := flag.NewFlagSet("kubernetes", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text or json")
+	failOn := fs.String("fail-on", "medium", "exit with status 1 when a finding is at least this severe (info, low, medium, high, critical or none)")
+	requireLevel := fs.String("pss", "", "exit with status 1 when a workload does not meet this Pod Security Standards level (baseline or restricted)")
+	seccompDefault := fs.Bool("seccomp-default", false, "the kubelet runs with seccompDefault, so containers without a seccompProfile get RuntimeDefault rather than Unconfined")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: container-checker kubernetes [flags] manifest|directory...\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	threshold, err := parseFailOn(*failOn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	var required checks.PodSecurityLevel
+	if *requireLevel != "" {
+		if required, err = checks.ParsePodSecurityLevel(*requireLevel); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -pss: %v\n", err)
+			return exitError
+		}
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitError
+	}
+
+	paths, err := manifestFiles(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	reports := []checks.KubernetesReport{}
+	for _, path := range paths {
+		workloads, err := checks.LoadKubernetesFile(path, checks.KubernetesOptions{SeccompDefault: *seccompDefault})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		for _, workload := range workloads {
+			report := checks.EvaluateKubernetesWorkload(workload)
+			if *format == "text" {
+				checks.PrintKubernetesReport(report)
+			}
+			reports = append(reports, report)
+		}
+	}
+
+	if *format == "json" {
+		if err := writeJSON(reports); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+
+	var severities []checks.Severity
+	status := exitOK
+	for _, report := range reports {
+		for _, f := range report.Findings {
+			severities = append(severities, f.Severity)
+		}
+		if required != "" && !report.PodSecurity.Level.AtLeast(required) {
+			status = exitFindings
+		}
+	}
+	if status == exitOK {
+		status = exitStatus(severities, threshold)
+	}
+	return status
+}
+
+// runRemediate prints the reconstructed and hardened docker run commands of
+// the containers named as arguments, or of every container.
+func runRemediate(args []string) int {
+	fs := flag.NewFlagSet("remediate", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text or json")
+	compose := fs.Bool("compose", false, "print hardening patches for the compose services of the containers, one per project")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: container-checker remediate [flags] [container...]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating Docker client: %v\n", err)
+		return exitError
+	}
+	containerInfo, err := checks.CheckAllContainers(cli, nil, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	wanted := make(map[string]bool)
+	for _, arg := range fs.Args() {
+		wanted[strings.TrimPrefix(arg, "/")] = true
+	}
+	var selected []checks.ContainerInfo
+	for _, info := range containerInfo {
+		name := strings.TrimPrefix(info.ContainerName, "/")
+		if len(wanted) == 0 || wanted[name] || wanted[info.ID] {
+			selected = append(selected, info)
+		}
+	}
+
+	if *compose {
+		patches := checks.GroupComposePatches(selected)
+		if *format == "json" {
+			if patches == nil {
+				patches = []checks.ComposeProjectPatch{}
+			}
+			if err := writeJSON(patches); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return exitError
+			}
+		} else {
+			checks.PrintComposePatches(patches)
+		}
+		return exitOK
+	}
+
+	remediations := map[string]*checks.RunRemediation{}
+	for _, info := range selected {
+		name := strings.TrimPrefix(info.ContainerName, "/")
+		if *format == "text" {
+			checks.PrintRunRemediation(name, *info.Remediation)
+			fmt.Println()
+		}
+		remediations[name] = info.Remediation
+	}
+
+	if *format == "json" {
+		if err := writeJSON(remediations); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+	return exitOK
+}
+
+// runScan checks the running containers. With -baseline, findings recorded in
+// the baseline are suppressed and only new and resolved findings are reported.
+func runScan(args []string) int {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text or json")
+	failOn := fs.String("fail-on", "medium", "exit with status 1 when a reported finding is at least this severe (info, low, medium, high, critical or none)")
+	baselinePath := fs.String("baseline", "", "baseline file whose findings are suppressed")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: container-checker scan [flags]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	threshold, err := parseFailOn(*failOn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	// The baseline is read before scanning so a bad path fails fast.
+	var baseline *checks.Baseline
+	if *baselinePath != "" {
+		if baseline, err = checks.LoadBaseline(*baselinePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+
+	scan, err := scanContainers()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	var severities []checks.Severity
+	if baseline == nil {
+		for _, c := range scan.Containers {
+			for _, f := range c.Findings {
+				severities = append(severities, f.Severity)
+			}
+		}
+		if *format == "json" {
+			if err := writeJSON(scan); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return exitError
+			}
+		} else {
+			printContainerFindings(scan.Containers)
+		}
+		return exitStatus(severities, threshold)
+	}
+
+	comparison := baseline.Compare(scan.Containers)
+	for _, f := range comparison.New {
+		severities = append(severities, f.Severity)
+	}
+	if *format == "json" {
+		if err := writeJSON(comparison); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+	} else {
+		checks.PrintBaselineComparison(comparison)
+	}
+	return exitStatus(severities, threshold)
+}
+
+// runBaseline writes the findings of the running containers to a baseline
+// file. Findings already in an existing baseline keep their first-seen time,
+// and findings that no longer occur are dropped.
+func runBaseline(args []string) int {
+	fs := flag.NewFlagSet("baseline", flag.ExitOnError)
+	output := fs.String("o", "container-checker-baseline.json", "baseline file to write or update")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: container-checker baseline [flags]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var previous *checks.Baseline
+	if _, err := os.Stat(*output); err == nil {
+		if previous, err = checks.LoadBaseline(*output); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+
+	scan, err := scanContainers()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	baseline := checks.NewBaseline(scan.Containers, previous)
+	if err := baseline.Save(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if previous != nil {
+		comparison := previous.Compare(scan.Containers)
+		fmt.Printf("Updated %s: %d findings, %d added, %d removed.\n", *output, len(baseline.Findings), len(comparison.New), len(comparison.Resolved))
+	} else {
+		fmt.Printf("Wrote %s with %d findings.\n", *output, len(baseline.Findings))
+	}
+	return exitOK
+}
+
+// scanContainers runs the container checks against the Docker daemon from
+// the environment. Image contents are matched against the OSV feed in
+// $CONTAINER_CHECKER_VULN_DB when it is set, as in the web server.
+func scanContainers() (*checks.Scan, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, fmt.Errorf("error creating Docker client: %v", err)
+	}
+
+	var imageScanner *checks.ImageScanner
+	if vulnDBDir := os.Getenv("CONTAINER_CHECKER_VULN_DB"); vulnDBDir != "" {
+		vulnDB, err := checks.LoadVulnerabilityDB(vulnDBDir)
+		if err != nil {
+			return nil, fmt.Errorf("error loading vulnerability database: %v", err)
+		}
+		imageScanner = checks.NewImageScanner(cli, vulnDB)
+	}
+	return checks.RunScan(cli, imageScanner, nil)
+}
+
+// printContainerFindings prints the findings of each container.
+func printContainerFindings(containers []checks.ContainerInfo) {
+	total := 0
+	for _, c := range containers {
+		if len(c.Findings) == 0 {
+			continue
+		}
+		fmt.Printf("%s (%s)\n", strings.TrimPrefix(c.ContainerName, "/"), c.PrivilegedContainerImage)
+		for _, f := range c.Findings {
+			fmt.Printf("  [%s] %s (%s)\n", f.Severity, f.Title, f.RuleID)
+			for _, e := range f.Evidence {
+				fmt.Printf("      %s\n", e)
+			}
+		}
+		total += len(c.Findings)
+	}
+	fmt.Printf("%d findings in %d containers.\n", total, len(containers))
+}
+
+// runHistory lists the stored scans, or prints the scan whose ID is given.
+func runHistory(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text or json")
+	dbPath := fs.String("db", os.Getenv("CONTAINER_CHECKER_DB"), "scan history database (defaults to $CONTAINER_CHECKER_DB)")
+	limit := fs.Int("limit", 20, "number of scans to list; 0 lists all")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: container-checker history [flags] [scan ID]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
 
-	fmt.Println("Starting Web server...")
-	if err := web.StartWebServer(); err != nil {
-		panic(err)
+	store, err := openHistory(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
 	}
+	defer store.Close()
 
-	fmt.Println("Starting container checks...")
-	/*
-		// Initialize Docker client
-		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if fs.NArg() == 0 {
+		summaries, err := store.ListScans(*limit)
 		if err != nil {
-			log.Fatal(err)
-		}
-
-		//utils.InspectDockerImages(cli)
-		//utils.PrintContainerJSON(cli)
-		fmt.Println("Checking for containers running with root priviledges...")
-		checks.CheckPrivilegedContainers(cli)
-		//utils.PrintContainerJSON(cli)
-		fmt.Println("Printing Security options...")
-		//checks.CheckSecurityOptions(cli)
-		//utils.PrintAllNetworks(cli)
-		//checks.CheckContainerNetworks(cli)
-		//checks.CheckAdvancedCapabilities(cli)
-		//checks.PrintCapabilityRecommendations(checks.CheckAdvancedCapabilities(cli))
-	*/
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		if *format == "json" {
+			if summaries == nil {
+				summaries = []checks.ScanSummary{}
+			}
+			if err := writeJSON(summaries); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return exitError
+			}
+			return exitOK
+		}
+		for _, summary := range summaries {
+			fmt.Printf("#%d  %s  %s  %d containers, %d findings (highest %s)\n", summary.ID, summary.StartedAt.Format(time.RFC3339), summary.Daemon, summary.Containers, summary.Findings, summary.HighestSeverity)
+		}
+		return exitOK
+	}
+
+	id, err := strconv.ParseUint(strings.TrimPrefix(fs.Arg(0), "#"), 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid scan ID %q\n", fs.Arg(0))
+		return exitError
+	}
+	scan, err := store.Scan(id)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: scan %d: %v\n", id, err)
+		return exitError
+	}
+	if *format == "json" {
+		if err := writeJSON(scan); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+	fmt.Printf("Scan #%d at %s on %s (Docker %s), took %s\n", scan.ID, scan.StartedAt.Format(time.RFC3339), scan.Daemon.Name, scan.Daemon.ServerVersion, scan.Duration)
+	for _, c := range scan.Containers {
+		fmt.Printf("\n%s (%s) %s\n", strings.TrimPrefix(c.ContainerName, "/"), c.ID, c.PrivilegedContainerImage)
+		for _, f := range c.Findings {
+			fmt.Printf("  [%s] %s (%s)\n", f.Severity, f.Title, f.RuleID)
+		}
+	}
+	return exitOK
+}
+
+// runChanges lists the drift events recorded between consecutive scans.
+func runChanges(args []string) int {
+	fs := flag.NewFlagSet("changes", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text or json")
+	dbPath := fs.String("db", os.Getenv("CONTAINER_CHECKER_DB"), "scan history database (defaults to $CONTAINER_CHECKER_DB)")
+	limit := fs.Int("limit", 50, "number of changes to list; 0 lists all")
+	fs.Parse(args)
+
+	store, err := openHistory(*dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	defer store.Close()
+
+	events, err := store.ListDrift(*limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if *format == "json" {
+		if events == nil {
+			events = []checks.DriftEvent{}
+		}
+		if err := writeJSON(events); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+	checks.PrintDriftEvents(events)
+	return exitOK
+}
+
+// openHistory opens the scan history database for queries.
+func openHistory(dbPath string) (*checks.BoltStore, error) {
+	if dbPath == "" {
+		return nil, fmt.Errorf("no scan history database; set -db or CONTAINER_CHECKER_DB")
+	}
+	return checks.OpenBoltStoreReadOnly(dbPath)
+}
+
+// manifestFiles expands directories into the YAML files below them.
+func manifestFiles(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if ext := filepath.Ext(path); !d.IsDir() && (ext == ".yaml" || ext == ".yml") {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// writeJSON writes v to standard output as indented JSON.
+func writeJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// exitStatus returns exitFindings when a severity reaches the threshold.
+func exitStatus(severities []checks.Severity, threshold *checks.Severity) int {
+	for _, severity := range severities {
+		if threshold != nil && severity >= *threshold {
+			return exitFindings
+		}
+	}
+	return exitOK
+}
+
+// parseFailOn reads the -fail-on flag. "none" never fails.
+func parseFailOn(value string) (*checks.Severity, error) {
+	if strings.EqualFold(value, "none") {
+		return nil, nil
+	}
+	severity, err := checks.ParseSeverity(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -fail-on: %v", err)
+	}
+	return &severity, nil
 }
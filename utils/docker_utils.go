@@ -68,7 +68,7 @@ func InspectDockerImages(cli *client.Client) {
 		fmt.Printf("Docker Version: %s\n", imageInspect.DockerVersion)
 
 		// Call the function to check for security risks
-		//checks.CheckForSecurityRisks(imageInspect)
+		//checks.PrintImageFindings(imageInspect, checks.EvaluateImage(imageInspect))
 
 		// Print raw JSON for additional manual inspection
 		fmt.Printf("Raw JSON: %s\n", string(rawJSON))
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"container-checker/checks"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// apiFinding is a finding together with the container it was found in.
+type apiFinding struct {
+	checks.Finding
+	ContainerID string `json:"containerId"`
+	Container   string `json:"container"`
+	Image       string `json:"image"`
+}
+
+// apiImage describes an image and the containers running it.
+type apiImage struct {
+	ID              string                  `json:"id"`
+	References      []string                `json:"references"`
+	OS              string                  `json:"os,omitempty"`
+	BaseImage       *checks.BaseImage       `json:"baseImage,omitempty"`
+	Signature       *checks.SignatureResult `json:"signature,omitempty"`
+	SBOM            *checks.SBOMReference   `json:"sbom,omitempty"`
+	Vulnerabilities []checks.Vulnerability  `json:"vulnerabilities"`
+	Containers      []string                `json:"containers"`
+}
+
+// registerAPIHandlers serves the latest scan as JSON under /api/v1. Scans
+// are listed from the store when one is given.
+func registerAPIHandlers(latest *latestScan, store checks.Store, rescan func(ctx context.Context) error) {
+	http.HandleFunc("GET /api/v1/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		http.ServeFile(w, r, "web/openapi.json")
+	})
+
+	http.HandleFunc("GET /api/v1/containers", func(w http.ResponseWriter, r *http.Request) {
+		query, err := checks.ParseContainerQuery(r.URL.Query())
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		scan := latestOrUnavailable(w, latest)
+		if scan == nil {
+			return
+		}
+		page := query.Apply(scan.Containers)
+		setPaginationHeaders(w, r, page.Pagination)
+		writeAPIJSON(w, http.StatusOK, page.Containers)
+	})
+
+	http.HandleFunc("GET /api/v1/containers/{id}", func(w http.ResponseWriter, r *http.Request) {
+		scan := latestOrUnavailable(w, latest)
+		if scan == nil {
+			return
+		}
+		c, ok := findContainer(scan.Containers, r.PathValue("id"))
+		if !ok {
+			writeAPIError(w, http.StatusNotFound, fmt.Sprintf("container %s not found", r.PathValue("id")))
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, c)
+	})
+
+	http.HandleFunc("GET /api/v1/findings", func(w http.ResponseWriter, r *http.Request) {
+		// The container filters of the dashboard narrow down the containers,
+		// then severity and rule apply to each finding.
+		query, err := checks.ParseContainerQuery(r.URL.Query())
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		scan := latestOrUnavailable(w, latest)
+		if scan == nil {
+			return
+		}
+
+		findings := []apiFinding{}
+		for _, c := range scan.Containers {
+			name := strings.TrimPrefix(c.ContainerName, "/")
+			if wanted := r.URL.Query().Get("container"); wanted != "" && wanted != name && wanted != c.ID {
+				continue
+			}
+			if !query.Matches(c) {
+				continue
+			}
+			for _, f := range c.Findings {
+				if f.Severity < query.Severity {
+					continue
+				}
+				if query.Rule != "" && query.Rule != f.RuleID {
+					continue
+				}
+				findings = append(findings, apiFinding{Finding: f, ContainerID: c.ID, Container: name, Image: c.PrivilegedContainerImage})
+			}
+		}
+		pagination, start, end := checks.Paginate(len(findings), query.Page, query.PerPage)
+		setPaginationHeaders(w, r, pagination)
+		writeAPIJSON(w, http.StatusOK, findings[start:end])
+	})
+
+	http.HandleFunc("GET /api/v1/images", func(w http.ResponseWriter, r *http.Request) {
+		scan := latestOrUnavailable(w, latest)
+		if scan == nil {
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, imagesOf(scan.Containers))
+	})
+
+	http.HandleFunc("GET /api/v1/scans", func(w http.ResponseWriter, r *http.Request) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		if store == nil {
+			// Without a history only the latest scan is known.
+			summaries := []checks.ScanSummary{}
+			if scan := latest.Get(); scan != nil {
+				summaries = append(summaries, scan.Summary())
+			}
+			writeAPIJSON(w, http.StatusOK, summaries)
+			return
+		}
+		summaries, err := store.ListScans(limit)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if summaries == nil {
+			summaries = []checks.ScanSummary{}
+		}
+		writeAPIJSON(w, http.StatusOK, summaries)
+	})
+
+	http.HandleFunc("POST /api/v1/scans", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), rescanTimeout)
+		defer cancel()
+		if err := rescan(ctx); errors.Is(err, context.DeadlineExceeded) {
+			writeAPIError(w, http.StatusGatewayTimeout, "timed out waiting for the scan")
+			return
+		} else if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, fmt.Sprintf("error scanning containers: %v", err))
+			return
+		}
+		writeAPIJSON(w, http.StatusCreated, latest.Get().Summary())
+	})
+}
+
+// latestOrUnavailable returns the latest scan, or answers 503 when the first
+// scan has not completed yet.
+func latestOrUnavailable(w http.ResponseWriter, latest *latestScan) *checks.Scan {
+	scan := latest.Get()
+	if scan == nil {
+		w.Header().Set("Retry-After", "10")
+		writeAPIError(w, http.StatusServiceUnavailable, "the first scan is still running")
+	}
+	return scan
+}
+
+// setPaginationHeaders reports the total count and links to the first,
+// previous, next and last pages.
+func setPaginationHeaders(w http.ResponseWriter, r *http.Request, p checks.Pagination) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(p.Total))
+	link := func(page int, rel string) string {
+		values := r.URL.Query()
+		values.Set("page", strconv.Itoa(page))
+		values.Set("per_page", strconv.Itoa(p.PerPage))
+		return fmt.Sprintf("<%s?%s>; rel=\"%s\"", r.URL.Path, values.Encode(), rel)
+	}
+	links := []string{link(1, "first")}
+	if p.Page > 1 {
+		links = append(links, link(p.Page-1, "prev"))
+	}
+	if p.Page < p.Pages {
+		links = append(links, link(p.Page+1, "next"))
+	}
+	links = append(links, link(p.Pages, "last"))
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
+
+// findContainer looks a container up by name, short ID or ID prefix.
+func findContainer(containers []checks.ContainerInfo, id string) (checks.ContainerInfo, bool) {
+	for _, c := range containers {
+		if strings.TrimPrefix(c.ContainerName, "/") == strings.TrimPrefix(id, "/") || c.ID == id {
+			return c, true
+		}
+	}
+	if len(id) >= 4 {
+		for _, c := range containers {
+			if strings.HasPrefix(c.ID, id) || strings.HasPrefix(id, c.ID) {
+				return c, true
+			}
+		}
+	}
+	return checks.ContainerInfo{}, false
+}
+
+// imagesOf groups the containers by image.
+func imagesOf(containers []checks.ContainerInfo) []apiImage {
+	byID := make(map[string]*apiImage)
+	var ids []string
+	for _, c := range containers {
+		image, ok := byID[c.ImageID]
+		if !ok {
+			image = &apiImage{
+				ID:              c.ImageID,
+				References:      []string{},
+				OS:              c.ImageOS,
+				BaseImage:       c.BaseImage,
+				Signature:       c.Signature,
+				SBOM:            c.SBOM,
+				Vulnerabilities: c.ImageVulnerabilities,
+				Containers:      []string{},
+			}
+			if image.Vulnerabilities == nil {
+				image.Vulnerabilities = []checks.Vulnerability{}
+			}
+			byID[c.ImageID] = image
+			ids = append(ids, c.ImageID)
+		}
+		if !containsString(image.References, c.PrivilegedContainerImage) {
+			image.References = append(image.References, c.PrivilegedContainerImage)
+		}
+		image.Containers = append(image.Containers, strings.TrimPrefix(c.ContainerName, "/"))
+	}
+
+	sort.Strings(ids)
+	images := make([]apiImage, 0, len(ids))
+	for _, id := range ids {
+		images = append(images, *byID[id])
+	}
+	return images
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing API response: %v", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeAPIJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"container-checker/checks"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sseKeepAlive is how often an idle event stream sends a comment, so proxies
+// do not close it.
+const sseKeepAlive = 30 * time.Second
+
+// sseEvent is one server-sent event.
+type sseEvent struct {
+	Name string
+	Data []byte
+}
+
+// eventHub fans server-sent events out to the connected browsers. A browser
+// that falls behind is disconnected rather than blocking the scans; its
+// stream ends with a resync event so that the page reloads.
+type eventHub struct {
+	mu      sync.Mutex
+	clients map[chan sseEvent]bool
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{clients: make(map[chan sseEvent]bool)}
+}
+
+func (h *eventHub) subscribe() chan sseEvent {
+	ch := make(chan sseEvent, 64)
+	h.mu.Lock()
+	h.clients[ch] = true
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan sseEvent) {
+	h.mu.Lock()
+	delete(h.clients, ch)
+	h.mu.Unlock()
+}
+
+func (h *eventHub) broadcast(events []sseEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.clients {
+		for _, e := range events {
+			select {
+			case ch <- e:
+				continue
+			default:
+			}
+			delete(h.clients, ch)
+			close(ch)
+			break
+		}
+	}
+}
+
+// ServeHTTP streams the events to a browser until it disconnects.
+func (h *eventHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	ch := h.subscribe()
+	defer h.unsubscribe(ch)
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e, ok := <-ch:
+			if !ok {
+				fmt.Fprint(w, "event: resync\ndata: {}\n\n")
+				flusher.Flush()
+				return
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Name, e.Data)
+		}
+		flusher.Flush()
+	}
+}
+
+// scanStatusEvent is sent when a scan completes.
+type scanStatusEvent struct {
+	checks.ScanSummary
+	Status string `json:"status"`
+}
+
+// containerEvent is sent when a container appears or its row changes. HTML
+// is the rendered table row that replaces the old one.
+type containerEvent struct {
+	ID        string           `json:"id"`
+	Container string           `json:"container"`
+	Added     []checks.Finding `json:"added"`
+	Resolved  []checks.Finding `json:"resolved"`
+	HTML      string           `json:"html"`
+}
+
+// scanEvents describes what changed between two consecutive scans: a scan
+// event, then one event per container that appeared, changed or disappeared.
+func scanEvents(previous, current *checks.Scan, tmpl *template.Template) []sseEvent {
+	var events []sseEvent
+	emit := func(name string, v interface{}) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			log.Printf("Error encoding %s event: %v", name, err)
+			return
+		}
+		events = append(events, sseEvent{Name: name, Data: data})
+	}
+
+	emit("scan", scanStatusEvent{ScanSummary: current.Summary(), Status: scanStatus(current)})
+
+	before := make(map[string]checks.ContainerInfo)
+	if previous != nil {
+		for _, c := range previous.Containers {
+			before[c.ID] = c
+		}
+	}
+	for _, c := range current.Containers {
+		row, err := renderRow(tmpl, c)
+		if err != nil {
+			log.Printf("Error rendering container %s: %v", c.ID, err)
+			continue
+		}
+		event := containerEvent{ID: c.ID, Container: strings.TrimPrefix(c.ContainerName, "/"), HTML: row}
+
+		old, ok := before[c.ID]
+		delete(before, c.ID)
+		if !ok {
+			event.Added, event.Resolved = c.Findings, []checks.Finding{}
+			if event.Added == nil {
+				event.Added = []checks.Finding{}
+			}
+			emit("container-added", event)
+			continue
+		}
+		// Rows also change when only the status or settings do.
+		oldRow, _ := renderRow(tmpl, old)
+		event.Added, event.Resolved = diffFindings(old, c)
+		if len(event.Added) > 0 || len(event.Resolved) > 0 || oldRow != row {
+			emit("container-changed", event)
+		}
+	}
+	for id, c := range before {
+		event := containerEvent{ID: id, Container: strings.TrimPrefix(c.ContainerName, "/"), Added: []checks.Finding{}, Resolved: c.Findings}
+		if event.Resolved == nil {
+			event.Resolved = []checks.Finding{}
+		}
+		emit("container-removed", event)
+	}
+	return events
+}
+
+// diffFindings returns the findings only in current and those only in old.
+func diffFindings(old, current checks.ContainerInfo) (added, resolved []checks.Finding) {
+	fingerprints := func(c checks.ContainerInfo) map[string]bool {
+		set := make(map[string]bool)
+		for _, f := range c.Findings {
+			set[checks.FindingFingerprint(f, "", "")] = true
+		}
+		return set
+	}
+	oldSet, currentSet := fingerprints(old), fingerprints(current)
+
+	added, resolved = []checks.Finding{}, []checks.Finding{}
+	for _, f := range current.Findings {
+		if !oldSet[checks.FindingFingerprint(f, "", "")] {
+			added = append(added, f)
+		}
+	}
+	for _, f := range old.Findings {
+		if !currentSet[checks.FindingFingerprint(f, "", "")] {
+			resolved = append(resolved, f)
+		}
+	}
+	return added, resolved
+}
+
+// renderRow renders the dashboard table row of a container.
+func renderRow(tmpl *template.Template, c checks.ContainerInfo) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "container-row", c); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// scanStatus is the status line the dashboard shows for a scan.
+func scanStatus(scan *checks.Scan) string {
+	return fmt.Sprintf("Scanned %s in %s", scan.StartedAt.Format("2006-01-02 15:04:05 MST"), scan.Duration.Round(time.Millisecond))
+}
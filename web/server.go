@@ -1,57 +1,319 @@
 package main
 
 import (
+	"bytes"
 	"container-checker/checks"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
 )
 
-// StartWebServer starts the web server and handles the container checking.
-func StartWebServer(cli *client.Client) {
-	// Start periodic container checks
-	containerInfoChan := make(chan []checks.ContainerInfo)
-	go periodicContainerCheck(cli, containerInfoChan)
+// rescanTimeout bounds how long a rescan request waits for its scan.
+const rescanTimeout = 2 * time.Minute
+
+// latestScan holds the most recent scan, which every page load renders.
+type latestScan struct {
+	mu   sync.RWMutex
+	scan *checks.Scan
+}
+
+func (l *latestScan) Set(scan *checks.Scan) {
+	l.mu.Lock()
+	l.scan = scan
+	l.mu.Unlock()
+}
+
+// Get returns the latest scan, or nil before the first scan completes.
+func (l *latestScan) Get() *checks.Scan {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.scan
+}
+
+// indexPage is the data of the dashboard template. Scan is nil until the
+// first scan completes, and Live is false for scans read from the history.
+// Page holds the containers of the scan that Query selects.
+type indexPage struct {
+	Scan  *checks.Scan
+	Live  bool
+	Path  string
+	Query checks.ContainerQuery
+	Page  checks.ContainerPage
+	Error string
+}
+
+// newIndexPage applies the filters, sort order and page in the request's URL
+// to the containers of a scan.
+func newIndexPage(r *http.Request, scan *checks.Scan, live bool) indexPage {
+	page := indexPage{Scan: scan, Live: live, Path: r.URL.Path}
+	query, err := checks.ParseContainerQuery(r.URL.Query())
+	if err != nil {
+		page.Error = err.Error()
+	}
+	page.Query = query
+	var containers []checks.ContainerInfo
+	if scan != nil {
+		containers = scan.Containers
+	}
+	page.Page = query.Apply(containers)
+	return page
+}
 
+// renderIndex renders the dashboard, answering 400 when the query is invalid.
+func renderIndex(w http.ResponseWriter, tmpl *template.Template, page indexPage) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, page); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if page.Error != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	buf.WriteTo(w)
+}
+
+// pageURL links to another page of the same query.
+func pageURL(path string, query checks.ContainerQuery, page int) string {
+	query.Page = page
+	if values := query.Values().Encode(); values != "" {
+		return path + "?" + values
+	}
+	return path
+}
+
+// StartWebServer starts the web server and handles the container checking.
+// When a store is given, full scans are saved and past scans are served under /history.
+// When reconcileInterval is positive, containers are re-checked as Docker events
+// report changes to them and fully rescanned at that interval; otherwise all
+// containers are polled every 10 seconds.
+func StartWebServer(cli *client.Client, imageScanner *checks.ImageScanner, signatureVerifier *checks.SignatureVerifier, store checks.Store, reconcileInterval time.Duration) {
 	// Define template functions
 	funcMap := template.FuncMap{
 		"split": func(s, sep string) []string {
 			return strings.Split(s, sep)
 		},
+		"family":     checks.FilterFamily,
+		"scanStatus": scanStatus,
+		"pageURL":    pageURL,
+		"list": func(items ...string) []string {
+			return items
+		},
+		"add": func(a, b int) int {
+			return a + b
+		},
 	}
 
 	// Parse template with function map
 	tmpl := template.Must(template.New("index.html").Funcs(funcMap).ParseFiles("web/index.html"))
+	historyTmpl := template.Must(template.New("history.html").ParseFiles("web/history.html"))
+	changesTmpl := template.Must(template.New("changes.html").ParseFiles("web/changes.html"))
+	containerTmpl := template.Must(template.New("container.html").ParseFiles("web/container.html"))
+
+	// Start the container checks, which publish every scan to latest and
+	// push what changed to the browsers listening on /events
+	latest := &latestScan{}
+	hub := newEventHub()
+	publish := func(scan *checks.Scan) {
+		// Scans after Docker events are only pushed to the browsers, so
+		// that a container restarting in a loop does not fill the history;
+		// the next reconciliation records what changed.
+		if store != nil && !scan.Partial {
+			if err := store.SaveScan(scan); err != nil {
+				log.Printf("Error saving scan: %v", err)
+			}
+		}
+		previous := latest.Get()
+		latest.Set(scan)
+		hub.broadcast(scanEvents(previous, scan, tmpl))
+	}
+	var rescan func(ctx context.Context) error
+	if reconcileInterval > 0 {
+		monitor := checks.NewMonitor(cli, imageScanner, signatureVerifier)
+		go monitor.Run(context.Background(), reconcileInterval, publish)
+		rescan = monitor.Rescan
+	} else {
+		rescans := make(chan chan error)
+		go periodicContainerCheck(cli, imageScanner, signatureVerifier, publish, rescans)
+		rescan = func(ctx context.Context) error {
+			reply := make(chan error, 1)
+			select {
+			case rescans <- reply:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			select {
+			case err := <-reply:
+				return err
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
 
 	// Start web server and define handler
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		containerInfo := <-containerInfoChan
+		renderIndex(w, tmpl, newIndexPage(r, latest.Get(), true))
+	})
 
-		if err := tmpl.Execute(w, containerInfo); err != nil {
+	// Rescan now: run a full scan and wait for it before showing the results
+	http.HandleFunc("POST /rescan", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), rescanTimeout)
+		defer cancel()
+		if err := rescan(ctx); errors.Is(err, context.DeadlineExceeded) {
+			http.Error(w, "Timed out waiting for the scan; its results are shown once it completes", http.StatusGatewayTimeout)
+			return
+		} else if err != nil {
+			http.Error(w, fmt.Sprintf("Error scanning containers: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(latest.Get().Summary()); err != nil {
+				log.Printf("Error writing rescan result: %v", err)
+			}
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+
+	// Container detail page, inspected live so it shows the current settings
+	http.HandleFunc("GET /containers/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var info checks.ContainerInfo
+		found := false
+		if scan := latest.Get(); scan != nil {
+			info, found = findContainer(scan.Containers, r.PathValue("id"))
+		}
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		containerJSON, err := cli.ContainerInspect(r.Context(), info.ID)
+		if client.IsErrNotFound(err) {
+			http.Error(w, fmt.Sprintf("Container %s no longer exists", info.ID), http.StatusNotFound)
+			return
+		}
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		var imageInspect *types.ImageInspect
+		if inspect, _, err := cli.ImageInspectWithRaw(r.Context(), containerJSON.Image); err != nil {
+			log.Printf("Error inspecting image %s: %v", containerJSON.Image, err)
+		} else {
+			imageInspect = &inspect
+		}
+		detail, err := checks.BuildContainerDetail(containerJSON, imageInspect, info.Findings)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := containerTmpl.Execute(w, detail); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 	})
 
+	// Live updates for the dashboard
+	http.Handle("GET /events", hub)
+
+	// JSON API over the same scans
+	registerAPIHandlers(latest, store, rescan)
+
+	if store != nil {
+		http.HandleFunc("GET /history", func(w http.ResponseWriter, r *http.Request) {
+			summaries, err := store.ListScans(0)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if err := historyTmpl.Execute(w, summaries); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+		})
+		http.HandleFunc("GET /changes", func(w http.ResponseWriter, r *http.Request) {
+			events, err := store.ListDrift(500)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if err := changesTmpl.Execute(w, events); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+		})
+		http.HandleFunc("GET /changes.json", func(w http.ResponseWriter, r *http.Request) {
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			events, err := store.ListDrift(limit)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if events == nil {
+				events = []checks.DriftEvent{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(events); err != nil {
+				log.Printf("Error writing changes feed: %v", err)
+			}
+		})
+		http.HandleFunc("GET /history/{id}", func(w http.ResponseWriter, r *http.Request) {
+			id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+			if err != nil {
+				http.Error(w, "invalid scan ID", http.StatusBadRequest)
+				return
+			}
+			scan, err := store.Scan(id)
+			if errors.Is(err, checks.ErrScanNotFound) {
+				http.NotFound(w, r)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			renderIndex(w, tmpl, newIndexPage(r, scan, false))
+		})
+	}
+
+	// Serve the SBOM documents written by the image scanner
+	if sbomDir := os.Getenv("CONTAINER_CHECKER_SBOM_DIR"); sbomDir != "" {
+		http.Handle("/sbom/", http.StripPrefix("/sbom/", http.FileServer(http.Dir(sbomDir))))
+	}
+
 	fmt.Println("Starting web server on http://localhost:8081")
 	log.Fatal(http.ListenAndServe(":8081", nil))
 }
 
-// periodicContainerCheck periodically checks the containers and sends data to the web server.
-func periodicContainerCheck(cli *client.Client, containerInfoChan chan<- []checks.ContainerInfo) {
+// periodicContainerCheck checks the containers every 10 seconds, or as soon
+// as a rescan is requested, and publishes each scan.
+func periodicContainerCheck(cli *client.Client, imageScanner *checks.ImageScanner, signatureVerifier *checks.SignatureVerifier, publish func(*checks.Scan), rescans <-chan chan error) {
+	var reply chan error
 	for {
-		containerInfo, err := checks.CheckAllContainers(cli)
+		scan, err := checks.RunScan(cli, imageScanner, signatureVerifier)
 		if err != nil {
 			log.Printf("Error checking containers: %v", err)
 		} else {
-			containerInfoChan <- containerInfo
+			publish(scan)
+		}
+		if reply != nil {
+			reply <- err
+		}
+
+		select {
+		case reply = <-rescans:
+		case <-time.After(10 * time.Second): // Check containers every 10 seconds
+			reply = nil
 		}
-		time.Sleep(10 * time.Second) // Check containers every 10 seconds
 	}
 }
 
@@ -61,5 +323,88 @@ func main() {
 		log.Fatalf("Error creating Docker client: %v", err)
 	}
 
-	StartWebServer(cli)
+	if eolTable := os.Getenv("CONTAINER_CHECKER_EOL_TABLE"); eolTable != "" {
+		if err := checks.LoadEOLTable(eolTable); err != nil {
+			log.Fatalf("Error loading EOL table: %v", err)
+		}
+	}
+
+	// Image contents are only scanned when an offline OSV feed or an SBOM
+	// directory is configured, since saving every image is expensive on the daemon.
+	var imageScanner *checks.ImageScanner
+	vulnDBDir := os.Getenv("CONTAINER_CHECKER_VULN_DB")
+	sbomDir := os.Getenv("CONTAINER_CHECKER_SBOM_DIR")
+	if vulnDBDir != "" || sbomDir != "" {
+		var vulnDB *checks.VulnerabilityDB
+		if vulnDBDir != "" {
+			vulnDB, err = checks.LoadVulnerabilityDB(vulnDBDir)
+			if err != nil {
+				log.Fatalf("Error loading vulnerability database: %v", err)
+			}
+			fmt.Printf("Loaded %d advisories from %s\n", vulnDB.Len(), vulnDBDir)
+		}
+		imageScanner = checks.NewImageScanner(cli, vulnDB)
+		if sbomDir != "" {
+			imageScanner.EnableSBOMs(sbomDir)
+		}
+	}
+
+	// Signatures are verified against a local OCI layout holding the
+	// signatures and the keys or certificates trusted to make them.
+	// Certificate signers must also be one of the listed identities.
+	var signatureVerifier *checks.SignatureVerifier
+	if signatureStore := os.Getenv("CONTAINER_CHECKER_SIGNATURE_STORE"); signatureStore != "" {
+		policy := checks.SignerPolicy{Issuer: os.Getenv("CONTAINER_CHECKER_SIGNER_ISSUER")}
+		for _, identity := range strings.Split(os.Getenv("CONTAINER_CHECKER_SIGNER_IDENTITY"), ",") {
+			if identity = strings.TrimSpace(identity); identity != "" {
+				policy.Identities = append(policy.Identities, identity)
+			}
+		}
+		signatureVerifier, err = checks.NewSignatureVerifier(signatureStore, os.Getenv("CONTAINER_CHECKER_TRUST"), policy)
+		if err != nil {
+			log.Fatalf("Error loading signature verification: %v", err)
+		}
+	}
+
+	// Scan history is kept in a bbolt database when a path is configured.
+	var store checks.Store
+	if dbPath := os.Getenv("CONTAINER_CHECKER_DB"); dbPath != "" {
+		retention := checks.DefaultRetention
+		if maxScans := os.Getenv("CONTAINER_CHECKER_RETENTION_SCANS"); maxScans != "" {
+			if retention.MaxScans, err = strconv.Atoi(maxScans); err != nil {
+				log.Fatalf("Invalid CONTAINER_CHECKER_RETENTION_SCANS: %v", err)
+			}
+		}
+		if maxAge := os.Getenv("CONTAINER_CHECKER_RETENTION_AGE"); maxAge != "" {
+			if retention.MaxAge, err = time.ParseDuration(maxAge); err != nil {
+				log.Fatalf("Invalid CONTAINER_CHECKER_RETENTION_AGE: %v", err)
+			}
+		}
+		boltStore, err := checks.OpenBoltStore(dbPath, retention)
+		if err != nil {
+			log.Fatalf("Error opening scan history: %v", err)
+		}
+		defer boltStore.Close()
+		store = boltStore
+	}
+
+	// Containers are re-checked on Docker events unless CONTAINER_CHECKER_EVENTS
+	// is false, in which case they are polled.
+	reconcileInterval := 5 * time.Minute
+	if interval := os.Getenv("CONTAINER_CHECKER_RECONCILE_INTERVAL"); interval != "" {
+		if reconcileInterval, err = time.ParseDuration(interval); err != nil {
+			log.Fatalf("Invalid CONTAINER_CHECKER_RECONCILE_INTERVAL: %v", err)
+		}
+	}
+	if useEvents := os.Getenv("CONTAINER_CHECKER_EVENTS"); useEvents != "" {
+		enabled, err := strconv.ParseBool(useEvents)
+		if err != nil {
+			log.Fatalf("Invalid CONTAINER_CHECKER_EVENTS: %v", err)
+		}
+		if !enabled {
+			reconcileInterval = 0
+		}
+	}
+
+	StartWebServer(cli, imageScanner, signatureVerifier, store, reconcileInterval)
 }